@@ -4,14 +4,21 @@ type Node struct {
     Name     string
     Children []*Node
     Text     string
+    Span     Span
+    Value    interface{}    // decoded value of a literal
+    Doc      string         // doc comment of a declaration
 }
 
+//
+// Nodes built with children initially span all of their children.
+// The parser widens the span to the tokens of the rule (see WithSpan).
+//
 func NewNode0(name string, nodes...*Node) *Node {
-    return &Node{Name: name, Text: "", Children: []*Node(nodes)}
+    return &Node{Name: name, Text: "", Children: []*Node(nodes), Span: cover(nodes)}
 }
 
 func NewNode1(name string, nodes []*Node) *Node {
-    return &Node{Name: name, Text: "", Children: nodes}
+    return &Node{Name: name, Text: "", Children: nodes, Span: cover(nodes)}
 }
 
 func NewNode2(name string, text string) *Node {
@@ -19,7 +26,21 @@ func NewNode2(name string, text string) *Node {
 }
 
 func NewNode3(name string, text string, nodes...*Node) *Node {
-    return &Node{Name: name, Text: text, Children: []*Node(nodes)}
+    return &Node{Name: name, Text: text, Children: []*Node(nodes), Span: cover(nodes)}
+}
+
+func cover(nodes []*Node) (r Span) {
+    for i := 0; i < len(nodes); i++ {
+        if nodes[i] != nil {
+            r = Cover(r, nodes[i].Span)
+        }
+    }
+    return
+}
+
+func (this *Node) WithSpan(span Span) *Node {
+    this.Span = span
+    return this
 }
 
 func f(nodes []*Node) (r string) {
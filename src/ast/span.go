@@ -0,0 +1,56 @@
+package ast
+
+import "fmt"
+
+//
+// Position is a location in a source file.
+// Line and Column are 1-based, Column counts characters (utf-8),
+// Offset is the 0-based byte offset into the input.
+//
+type Position struct {
+    Line   int
+    Column int
+    Offset int
+}
+
+func (p Position) IsValid() bool {
+    return p.Line > 0
+}
+
+func (p Position) String() string {
+    return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+//
+// Span is the source range [Start, End) covered by a token or a node.
+//
+type Span struct {
+    File  string
+    Start Position
+    End   Position
+}
+
+func (s Span) IsValid() bool {
+    return s.Start.IsValid()
+}
+
+func (s Span) String() string {
+    if !s.IsValid() { return "-" }
+    if len(s.File) == 0 {
+        return s.Start.String()
+    }
+    return s.File + ":" + s.Start.String()
+}
+
+//
+// Cover returns the smallest span containing both a and b.
+// An invalid span is ignored.
+//
+func Cover(a, b Span) Span {
+    if !a.IsValid() { return b }
+    if !b.IsValid() { return a }
+    r := a
+    if b.Start.Offset < r.Start.Offset { r.Start = b.Start }
+    if b.End.Offset   > r.End.Offset   { r.End   = b.End   }
+    return r
+}
@@ -0,0 +1,108 @@
+package classfile
+
+import "fmt"
+import "strconv"
+import "strings"
+
+//
+// The decoded forms of the standard attributes, as found in
+// Attribute.Value after Parse:
+//
+//   SourceFile, Signature           string
+//   ConstantValue                   int32, float32, int64, float64 or string
+//   LineNumberTable                 []LineNumber, into Code.Lines() for code
+//   LocalVariableTable              []LocalVariable
+//   LocalVariableTypeTable          []LocalVariable, Desc holding the signature
+//   InnerClasses                    []InnerClass
+//   EnclosingMethod                 *EnclosingMethod
+//   StackMapTable                   []*Frame
+//   Runtime(In)VisibleAnnotations   []*Annotation
+//   Runtime(In)VisibleParameterAnnotations
+//                                   [][]*Annotation, by parameter
+//   AnnotationDefault               *ElementValue
+//   Deprecated, Synthetic           nil
+//
+// Code and Exceptions go to Method.Code and Method.Exceptions. Other
+// attributes are kept as they are, with a nil Value.
+//
+
+type LineNumber struct {
+    StartPC, Line int
+}
+
+type LocalVariable struct {
+    StartPC, Length int
+    Name, Desc      string
+    Index           int
+}
+
+// Outer and Name are empty for local and anonymous classes
+type InnerClass struct {
+    Inner, Outer, Name string
+    Access             int
+}
+
+// Name and Desc are empty for a class enclosed by an initializer
+type EnclosingMethod struct {
+    Class, Name, Desc string
+}
+
+type Annotation struct {
+    Type     string     // a field descriptor
+    Elements []*ElementPair
+}
+
+type ElementPair struct {
+    Name  string
+    Value *ElementValue
+}
+
+//
+// ElementValue is the value of an annotation element. Tag is one of
+// BCDFIJSZs for constants, e for enums, c for classes, @ for nested
+// annotations and [ for arrays.
+//
+type ElementValue struct {
+    Tag        byte
+    Const      interface{}          // int32, int64, float32, float64 or string
+    Type, Name string               // the enum type and constant, or the class descriptor in Type
+    Annotation *Annotation
+    Values     []*ElementValue
+}
+
+// @Ljava/lang/Deprecated;(since="1.2", forRemoval=false)
+func (this *Annotation) String() string {
+    elements := []string{}
+    for _, e := range this.Elements {
+        elements = append(elements, e.Name + "=" + e.Value.String())
+    }
+    return "@" + this.Type + "(" + strings.Join(elements, ", ") + ")"
+}
+
+func (this *ElementValue) String() string {
+    switch this.Tag {
+        case 's':
+            return strconv.Quote(this.Const.(string))
+        case 'C':
+            return fmt.Sprintf("'%c'", this.Const)
+        case 'Z':
+            return strconv.Btoa(this.Const.(int32) != 0)
+        case 'J':
+            return fmt.Sprintf("%dL", this.Const)
+        case 'F':
+            return fmt.Sprintf("%vf", this.Const)
+        case 'e':
+            return this.Type + "." + this.Name
+        case 'c':
+            return this.Type + ".class"
+        case '@':
+            return this.Annotation.String()
+        case '[':
+            values := []string{}
+            for _, v := range this.Values {
+                values = append(values, v.String())
+            }
+            return "{" + strings.Join(values, ", ") + "}"
+    }
+    return fmt.Sprint(this.Const)
+}
@@ -0,0 +1,61 @@
+package classfile
+
+//
+// buffer collects big-endian output.
+//
+type buffer struct {
+    b []byte
+}
+
+func (this *buffer) u1(v int) {
+    this.b = append(this.b, byte(v))
+}
+
+func (this *buffer) u2(v int) {
+    this.b = append(this.b, byte(v >> 8), byte(v))
+}
+
+func (this *buffer) u4(v int) {
+    this.b = append(this.b, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v))
+}
+
+func (this *buffer) write(b []byte) {
+    this.b = append(this.b, b...)
+}
+
+func (this *buffer) size() int {
+    return len(this.b)
+}
+
+func u2(v int) []byte {
+    return []byte{byte(v >> 8), byte(v)}
+}
+
+func u4(v uint32) []byte {
+    return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func u8(v uint64) []byte {
+    return append(u4(uint32(v >> 32)), u4(uint32(v))...)
+}
+
+func put2(b []byte, v int) {
+    b[0], b[1] = byte(v >> 8), byte(v)
+}
+
+func put4(b []byte, v int) {
+    b[0], b[1], b[2], b[3] = byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)
+}
+
+func get2(b []byte) int {
+    return int(b[0]) << 8 | int(b[1])
+}
+
+// a signed big-endian int
+func get4(b []byte) int {
+    return int(int32(uint32(b[0]) << 24 | uint32(b[1]) << 16 | uint32(b[2]) << 8 | uint32(b[3])))
+}
+
+func get8(b []byte) uint64 {
+    return uint64(uint32(get4(b))) << 32 | uint64(uint32(get4(b[4:])))
+}
@@ -0,0 +1,189 @@
+package classfile
+
+import "os"
+import "io/ioutil"
+
+//
+// Attribute is a named blob. Constant pool indexes inside Info
+// must come from the pool of the class it is written to.
+//
+// Value is the decoded attribute when read by Parse (see reader.go),
+// it is not written.
+//
+type Attribute struct {
+    Name  string
+    Info  []byte
+    Value interface{}
+}
+
+type Field struct {
+    Access     int
+    Name       string
+    Desc       string
+    Attributes []*Attribute
+}
+
+type Method struct {
+    Access     int
+    Name       string
+    Desc       string
+    Code       *Code        // nil for abstract and native methods
+    Exceptions []string     // the throws clause, as internal names
+    Attributes []*Attribute
+}
+
+//
+// ClassFile is a class being built. Names are internal names
+// (java/lang/String) and types are descriptors (Ljava/lang/String;).
+//
+type ClassFile struct {
+    Major, Minor int
+    Access       int
+    Name         string
+    Super        string
+    Interfaces   []string
+    Fields       []*Field
+    Methods      []*Method
+    Attributes   []*Attribute
+    Pool         *ConstantPool
+    Hierarchy    Hierarchy      // for the frames of Java 7 classes, may be nil
+}
+
+func NewClassFile(access int, name, super string) *ClassFile {
+    return &ClassFile{Major: JAVA_6, Access: access, Name: name, Super: super, Pool: NewConstantPool()}
+}
+
+func (this *ClassFile) AddInterface(name string) {
+    this.Interfaces = append(this.Interfaces, name)
+}
+
+func (this *ClassFile) AddField(access int, name, desc string) *Field {
+    f := &Field{Access: access, Name: name, Desc: desc}
+    this.Fields = append(this.Fields, f)
+    return f
+}
+
+func (this *ClassFile) AddMethod(access int, name, desc string) *Method {
+    m := &Method{Access: access, Name: name, Desc: desc}
+    this.Methods = append(this.Methods, m)
+    return m
+}
+
+func (this *Method) NewCode() *Code {
+    this.Code = new(Code)
+    return this.Code
+}
+
+// ConstantValue of a static final field, value being a pool index
+func (this *Field) SetConstantValue(index int) {
+    this.Attributes = append(this.Attributes, &Attribute{Name: "ConstantValue", Info: u2(index)})
+}
+
+func (this *ClassFile) SetSourceFile(name string) {
+    info := u2(this.Pool.Utf8(name))
+    this.Attributes = append(this.Attributes, &Attribute{Name: "SourceFile", Info: info})
+}
+
+//
+// Bytes serializes the class. Members are written first so that
+// every name they use is in the pool before the pool is written.
+//
+func (this *ClassFile) Bytes() ([]byte, os.Error) {
+    pool := this.Pool
+    body := new(buffer)
+    body.u2(this.Access)
+    body.u2(pool.Class(this.Name))
+    if this.Super == "" {
+        body.u2(0)  // java/lang/Object only
+    } else {
+        body.u2(pool.Class(this.Super))
+    }
+    body.u2(len(this.Interfaces))
+    for _, i := range this.Interfaces {
+        body.u2(pool.Class(i))
+    }
+    body.u2(len(this.Fields))
+    for _, f := range this.Fields {
+        body.u2(f.Access)
+        body.u2(pool.Utf8(f.Name))
+        body.u2(pool.Utf8(f.Desc))
+        writeAttributes(body, pool, f.Attributes)
+    }
+    body.u2(len(this.Methods))
+    for _, m := range this.Methods {
+        attrs, err := m.attributes(this)
+        if err != nil {
+            return nil, os.NewError(this.Name + "." + m.Name + m.Desc + ": " + err.String())
+        }
+        body.u2(m.Access)
+        body.u2(pool.Utf8(m.Name))
+        body.u2(pool.Utf8(m.Desc))
+        writeAttributes(body, pool, attrs)
+    }
+    writeAttributes(body, pool, this.Attributes)
+
+    out := new(buffer)
+    out.write(u4(MAGIC))
+    out.u2(this.Minor)
+    out.u2(this.Major)
+    if err := pool.write(out); err != nil {
+        return nil, err
+    }
+    out.write(body.b)
+    return out.b, nil
+}
+
+func (this *ClassFile) WriteFile(path string) os.Error {
+    b, err := this.Bytes()
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(path, b, 0644)
+}
+
+//
+// attributes of the method. From Java 7 on, the Code attribute
+// must come with a StackMapTable, computed from the code.
+//
+func (this *Method) attributes(cf *ClassFile) ([]*Attribute, os.Error) {
+    pool := cf.Pool
+    attrs := []*Attribute{}
+    if this.Code != nil {
+        if err := this.Code.patch(); err != nil {
+            return nil, err
+        }
+        var stackMap *Attribute
+        if cf.Major >= JAVA_7 && this.Code.attributeNamed("StackMapTable") == nil {
+            initial, frames, err := computeFrames(cf, this)
+            if err != nil {
+                return nil, err
+            }
+            if len(frames) > 0 {
+                stackMap = stackMapTable(pool, initial, frames)
+            }
+        }
+        code, err := this.Code.attribute(pool, stackMap)
+        if err != nil {
+            return nil, err
+        }
+        attrs = append(attrs, code)
+    }
+    if len(this.Exceptions) > 0 {
+        info := new(buffer)
+        info.u2(len(this.Exceptions))
+        for _, e := range this.Exceptions {
+            info.u2(pool.Class(e))
+        }
+        attrs = append(attrs, &Attribute{Name: "Exceptions", Info: info.b})
+    }
+    return append(attrs, this.Attributes...), nil
+}
+
+func writeAttributes(out *buffer, pool *ConstantPool, attrs []*Attribute) {
+    out.u2(len(attrs))
+    for _, a := range attrs {
+        out.u2(pool.Utf8(a.Name))
+        out.u4(len(a.Info))
+        out.write(a.Info)
+    }
+}
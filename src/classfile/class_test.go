@@ -0,0 +1,83 @@
+package classfile_test
+
+import "testing"
+import "bytes"
+import . "classfile"
+
+// public class Hello { public static void main(String[] args) { ... } }
+func hello() *ClassFile {
+    cf := NewClassFile(ACC_PUBLIC | ACC_SUPER, "Hello", "java/lang/Object")
+    m := cf.AddMethod(ACC_PUBLIC | ACC_STATIC, "main", "([Ljava/lang/String;)V")
+    code := m.NewCode()
+    code.MaxStack, code.MaxLocals = 2, 1
+    code.Op2(GETSTATIC, cf.Pool.FieldRef("java/lang/System", "out", "Ljava/io/PrintStream;"))
+    code.Op1(LDC, cf.Pool.String("Hello"))
+    code.Op2(INVOKEVIRTUAL, cf.Pool.MethodRef("java/io/PrintStream", "println", "(Ljava/lang/String;)V"))
+    code.Op(RETURN)
+    cf.SetSourceFile("Hello.kt")
+    return cf
+}
+
+func TestClassHeader(t *testing.T) {
+    b, err := hello().Bytes()
+    if err != nil {
+        t.Fatalf("%s", err)
+    }
+    if !bytes.Equal(b[0:8], []byte{0xCA, 0xFE, 0xBA, 0xBE, 0, 0, 0, JAVA_6}) {
+        t.Fatalf("wrong header % x", b[0:8])
+    }
+    // the class ends with one SourceFile attribute
+    n := len(b)
+    if !bytes.Equal(b[n-10:n-8], []byte{0, 1}) || !bytes.Equal(b[n-6:n-2], []byte{0, 0, 0, 2}) {
+        t.Fatalf("wrong class attributes % x", b[n-10:])
+    }
+}
+
+func TestCodeAttribute(t *testing.T) {
+    cf := hello()
+    b, _ := cf.Bytes()
+    code := []byte{GETSTATIC, 0, 0, LDC, 0, INVOKEVIRTUAL, 0, 0, RETURN}
+    code[2] = byte(cf.Pool.FieldRef("java/lang/System", "out", "Ljava/io/PrintStream;"))
+    code[4] = byte(cf.Pool.String("Hello"))
+    code[7] = byte(cf.Pool.MethodRef("java/io/PrintStream", "println", "(Ljava/lang/String;)V"))
+    // max_stack, max_locals, code_length, code, no handlers, no attributes
+    expect := append([]byte{0, 2, 0, 1, 0, 0, 0, byte(len(code))}, code...)
+    expect = append(expect, 0, 0, 0, 0)
+    if bytes.Index(b, expect) < 0 {
+        t.Fatalf("Code attribute not found in % x", b)
+    }
+}
+
+func TestBranchPatching(t *testing.T) {
+    code := new(Code)
+    loop, end := code.NewLabel(), code.NewLabel()
+    code.Bind(loop)
+    code.Op(ILOAD_0)
+    code.Jump(IFEQ, end)
+    code.Iinc(0, -1)
+    code.Jump(GOTO, loop)
+    code.Bind(end)
+    code.Op(RETURN)
+    code.AddHandler(loop, end, end, "")
+
+    cf := NewClassFile(ACC_SUPER, "Loop", "java/lang/Object")
+    m := cf.AddMethod(ACC_STATIC, "f", "(I)V")
+    m.Code = code
+    b, err := cf.Bytes()
+    if err != nil {
+        t.Fatalf("%s", err)
+    }
+    expect := []byte{ILOAD_0, IFEQ, 0, 9, IINC, 0, 0xFF, GOTO, 0xFF, 0xF9, RETURN, 0, 1, 0, 0, 0, 10, 0, 10, 0, 0}
+    if bytes.Index(b, expect) < 0 {
+        t.Fatalf("wrong branches in % x", b)
+    }
+}
+
+func TestUnboundLabel(t *testing.T) {
+    cf := NewClassFile(ACC_SUPER, "A", "java/lang/Object")
+    code := cf.AddMethod(ACC_STATIC, "f", "()V").NewCode()
+    code.Jump(GOTO, code.NewLabel())
+    if _, err := cf.Bytes(); err == nil {
+        t.Fatalf("expect an error for a label never bound")
+    }
+}
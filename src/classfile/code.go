@@ -0,0 +1,263 @@
+package classfile
+
+import "os"
+import "strconv"
+
+//
+// Label is a position in the code, possibly not known yet.
+// Branches to a label are patched once it is bound.
+//
+type Label struct {
+    offset int      // -1 until bound
+    refs   []labelRef
+}
+
+// a branch offset at code[at:at+size], relative to the instruction at base
+type labelRef struct {
+    at, base, size int
+}
+
+func (this *Label) Offset() int {
+    return this.offset
+}
+
+func (this *Label) IsBound() bool {
+    return this.offset >= 0
+}
+
+//
+// Handler is an entry of the exception table. An empty CatchType
+// catches everything, as for finally.
+//
+type Handler struct {
+    Start, End, Target *Label
+    CatchType string
+}
+
+//
+// Code is the body of a method. Instructions are appended with the
+// Op* methods; MaxStack and MaxLocals are left to the caller.
+//
+type Code struct {
+    MaxStack   int
+    MaxLocals  int
+    Handlers   []*Handler
+    Attributes []*Attribute
+
+    code   buffer
+    labels []*Label
+    lines  []int    // pairs of start pc and line number
+}
+
+func (this *Code) Offset() int {
+    return this.code.size()
+}
+
+func (this *Code) Bytes() []byte {
+    return this.code.b
+}
+
+func (this *Code) NewLabel() *Label {
+    l := &Label{offset: -1}
+    this.labels = append(this.labels, l)
+    return l
+}
+
+// Bind sets l at the current offset.
+func (this *Code) Bind(l *Label) {
+    l.offset = this.Offset()
+}
+
+// Lines gives the line number table, in the order lines were recorded.
+func (this *Code) Lines() []LineNumber {
+    r := make([]LineNumber, 0, len(this.lines) / 2)
+    for i := 0; i < len(this.lines); i += 2 {
+        r = append(r, LineNumber{StartPC: this.lines[i], Line: this.lines[i+1]})
+    }
+    return r
+}
+
+func (this *Code) attributeNamed(name string) *Attribute {
+    for _, a := range this.Attributes {
+        if a.Name == name { return a }
+    }
+    return nil
+}
+
+// Line records that the code from here on comes from source line n.
+func (this *Code) Line(n int) {
+    if k := len(this.lines); k > 0 && this.lines[k-2] == this.Offset() {
+        this.lines[k-1] = n
+        return
+    }
+    this.lines = append(this.lines, this.Offset(), n)
+}
+
+func (this *Code) Op(op int) {
+    this.code.u1(op)
+}
+
+// an instruction with a one byte operand, as bipush, ldc or newarray
+func (this *Code) Op1(op, v int) {
+    this.code.u1(op)
+    this.code.u1(v)
+}
+
+// an instruction with a two byte operand, as sipush or a constant pool index
+func (this *Code) Op2(op, v int) {
+    this.code.u1(op)
+    this.code.u2(v)
+}
+
+// Local loads or stores local variable n, with 'wide' when n > 255.
+func (this *Code) Local(op, n int) {
+    if n > 0xFF {
+        this.code.u1(WIDE)
+        this.Op2(op, n)
+        return
+    }
+    this.Op1(op, n)
+}
+
+func (this *Code) Iinc(n, delta int) {
+    if n > 0xFF || delta < -128 || delta > 127 {
+        this.code.u1(WIDE)
+        this.Op2(IINC, n)
+        this.code.u2(delta)
+        return
+    }
+    this.Op1(IINC, n)
+    this.code.u1(delta)
+}
+
+func (this *Code) InvokeInterface(index, nargs int) {
+    this.Op2(INVOKEINTERFACE, index)
+    this.code.u1(nargs)
+    this.code.u1(0)
+}
+
+func (this *Code) MultiANewArray(index, dims int) {
+    this.Op2(MULTIANEWARRAY, index)
+    this.code.u1(dims)
+}
+
+// Jump emits a branch instruction to l.
+func (this *Code) Jump(op int, l *Label) {
+    size := 2
+    if op == GOTO_W || op == JSR_W { size = 4 }
+    base := this.Offset()
+    this.code.u1(op)
+    this.ref(l, base, size)
+}
+
+func (this *Code) TableSwitch(dflt *Label, low int, targets []*Label) {
+    base := this.switchHeader(TABLESWITCH, dflt)
+    this.code.u4(low)
+    this.code.u4(low + len(targets) - 1)
+    for _, l := range targets {
+        this.ref(l, base, 4)
+    }
+}
+
+// keys must be sorted
+func (this *Code) LookupSwitch(dflt *Label, keys []int, targets []*Label) {
+    base := this.switchHeader(LOOKUPSWITCH, dflt)
+    this.code.u4(len(keys))
+    for i, k := range keys {
+        this.code.u4(k)
+        this.ref(targets[i], base, 4)
+    }
+}
+
+// the opcode, padding up to a multiple of 4 and the default target
+func (this *Code) switchHeader(op int, dflt *Label) int {
+    base := this.Offset()
+    this.code.u1(op)
+    for this.Offset() % 4 != 0 {
+        this.code.u1(0)
+    }
+    this.ref(dflt, base, 4)
+    return base
+}
+
+func (this *Code) ref(l *Label, base, size int) {
+    l.refs = append(l.refs, labelRef{at: this.Offset(), base: base, size: size})
+    for i := 0; i < size; i++ {
+        this.code.u1(0)
+    }
+}
+
+func (this *Code) AddHandler(start, end, target *Label, catchType string) *Handler {
+    h := &Handler{Start: start, End: end, Target: target, CatchType: catchType}
+    this.Handlers = append(this.Handlers, h)
+    return h
+}
+
+// patch fills in the branch offsets of all labels.
+func (this *Code) patch() os.Error {
+    for _, l := range this.labels {
+        if len(l.refs) == 0 { continue }
+        if !l.IsBound() {
+            return os.NewError("branch to a label never bound")
+        }
+        for _, r := range l.refs {
+            d := l.offset - r.base
+            if r.size == 2 {
+                if d < -0x8000 || d > 0x7FFF {
+                    return os.NewError("branch offset too large: " + strconv.Itoa(d))
+                }
+                put2(this.code.b[r.at:], d)
+            } else {
+                put4(this.code.b[r.at:], d)
+            }
+        }
+    }
+    return nil
+}
+
+//
+// attribute builds the Code attribute of patched code, with the
+// stack map if any and the LineNumberTable attribute when lines
+// were recorded.
+//
+func (this *Code) attribute(pool *ConstantPool, stackMap *Attribute) (*Attribute, os.Error) {
+    if this.Offset() == 0 || this.Offset() > 0xFFFF {
+        return nil, os.NewError("code length out of range: " + strconv.Itoa(this.Offset()))
+    }
+    out := new(buffer)
+    out.u2(this.MaxStack)
+    out.u2(this.MaxLocals)
+    out.u4(this.Offset())
+    out.write(this.code.b)
+    out.u2(len(this.Handlers))
+    for _, h := range this.Handlers {
+        if !h.Start.IsBound() || !h.End.IsBound() || !h.Target.IsBound() {
+            return nil, os.NewError("exception handler with a label never bound")
+        }
+        out.u2(h.Start.offset)
+        out.u2(h.End.offset)
+        out.u2(h.Target.offset)
+        if h.CatchType == "" {
+            out.u2(0)
+        } else {
+            out.u2(pool.Class(h.CatchType))
+        }
+    }
+    attrs := this.Attributes
+    if stackMap != nil {
+        attrs = append([]*Attribute{stackMap}, attrs...)
+    }
+    for k := len(this.lines); k > 0 && this.lines[k-2] >= this.Offset(); k -= 2 {
+        this.lines = this.lines[0:k-2]  // lines left without code
+    }
+    if len(this.lines) > 0 {
+        lines := new(buffer)
+        lines.u2(len(this.lines) / 2)
+        for _, v := range this.lines {
+            lines.u2(v)
+        }
+        attrs = append(attrs, &Attribute{Name: "LineNumberTable", Info: lines.b})
+    }
+    writeAttributes(out, pool, attrs)
+    return &Attribute{Name: "Code", Info: out.b}, nil
+}
@@ -0,0 +1,50 @@
+package classfile
+
+const MAGIC = 0xCAFEBABE
+
+// class file versions, major.minor
+const (
+    JAVA_6 = 50
+    JAVA_7 = 51
+)
+
+const (
+    ACC_PUBLIC       = 0x0001
+    ACC_PRIVATE      = 0x0002
+    ACC_PROTECTED    = 0x0004
+    ACC_STATIC       = 0x0008
+    ACC_FINAL        = 0x0010
+    ACC_SUPER        = 0x0020   // class
+    ACC_SYNCHRONIZED = 0x0020   // method
+    ACC_VOLATILE     = 0x0040   // field
+    ACC_BRIDGE       = 0x0040   // method
+    ACC_TRANSIENT    = 0x0080   // field
+    ACC_VARARGS      = 0x0080   // method
+    ACC_NATIVE       = 0x0100
+    ACC_INTERFACE    = 0x0200
+    ACC_ABSTRACT     = 0x0400
+    ACC_STRICT       = 0x0800
+    ACC_SYNTHETIC    = 0x1000
+    ACC_ANNOTATION   = 0x2000
+    ACC_ENUM         = 0x4000
+)
+
+const (
+    CONST_Utf8                  = 1
+    CONST_Integer               = 3
+    CONST_Float                 = 4
+    CONST_Long                  = 5
+    CONST_Double                = 6
+    CONST_Class                 = 7
+    CONST_String                = 8
+    CONST_FieldRef              = 9
+    CONST_MethodRef             = 10
+    CONST_InterfaceMethodRef    = 11
+    CONST_NameAndType           = 12
+    CONST_MethodHandle          = 15    // Java 7 on, read but never written
+    CONST_MethodType            = 16
+    CONST_Dynamic               = 17
+    CONST_InvokeDynamic         = 18
+    CONST_Module                = 19
+    CONST_Package               = 20
+)
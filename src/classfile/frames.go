@@ -0,0 +1,859 @@
+package classfile
+
+import "os"
+import "fmt"
+
+// verification type tags of the StackMapTable attribute
+const (
+    ITEM_Top               = 0
+    ITEM_Integer           = 1
+    ITEM_Float             = 2
+    ITEM_Double            = 3
+    ITEM_Long              = 4
+    ITEM_Null              = 5
+    ITEM_UninitializedThis = 6
+    ITEM_Object            = 7
+    ITEM_Uninitialized     = 8
+)
+
+//
+// VerificationType is the type of a local or of a stack entry as the
+// verifier sees it. Class is set for ITEM_Object: an internal name or
+// an array descriptor. Offset is set for ITEM_Uninitialized: the offset
+// of the NEW instruction that created the object.
+//
+type VerificationType struct {
+    Tag    int
+    Class  string
+    Offset int
+}
+
+func (t VerificationType) String() string {
+    switch t.Tag {
+        case ITEM_Integer:           return "int"
+        case ITEM_Float:             return "float"
+        case ITEM_Double:            return "double"
+        case ITEM_Long:              return "long"
+        case ITEM_Null:              return "null"
+        case ITEM_UninitializedThis: return "uninitialized this"
+        case ITEM_Object:            return t.Class
+        case ITEM_Uninitialized:     return fmt.Sprintf("uninitialized %d", t.Offset)
+    }
+    return "top"
+}
+
+//
+// Frame gives the types of the locals and of the stack at Offset.
+// Long and Double take a single entry, as in the attribute.
+//
+type Frame struct {
+    Offset int
+    Locals []VerificationType
+    Stack  []VerificationType
+}
+
+//
+// Hierarchy answers questions about classes outside the class being
+// written, to find the common superclass of two types where branches
+// join. Unknown classes are merged into java/lang/Object.
+//
+type Hierarchy interface {
+    // the superclass of class name, false if name is unknown
+    SuperClass(name string) (string, bool)
+    IsInterface(name string) bool
+}
+
+var (
+    topType    = VerificationType{Tag: ITEM_Top}
+    intType    = VerificationType{Tag: ITEM_Integer}
+    floatType  = VerificationType{Tag: ITEM_Float}
+    longType   = VerificationType{Tag: ITEM_Long}
+    doubleType = VerificationType{Tag: ITEM_Double}
+    nullType   = VerificationType{Tag: ITEM_Null}
+    throwable  = object("java/lang/Throwable")
+)
+
+func object(class string) VerificationType {
+    return VerificationType{Tag: ITEM_Object, Class: class}
+}
+
+// the verification type of a field descriptor
+func descriptorType(desc string) VerificationType {
+    switch desc[0] {
+        case 'Z', 'B', 'C', 'S', 'I': return intType
+        case 'F': return floatType
+        case 'J': return longType
+        case 'D': return doubleType
+        case 'L': return object(desc[1:len(desc)-1])
+    }
+    return object(desc)
+}
+
+// types of the ILOAD, LLOAD, FLOAD, DLOAD, ALOAD family, by offset
+var kinds = []VerificationType{intType, longType, floatType, doubleType, nullType}
+
+func (t VerificationType) isWide() bool {
+    return t.Tag == ITEM_Long || t.Tag == ITEM_Double
+}
+
+func (t VerificationType) isReference() bool {
+    return t.Tag == ITEM_Object || t.Tag == ITEM_Null ||
+           t.Tag == ITEM_Uninitialized || t.Tag == ITEM_UninitializedThis
+}
+
+// the parameter and return descriptors of a method descriptor
+func splitDescriptor(desc string) ([]string, string, os.Error) {
+    params := []string{}
+    if len(desc) < 3 || desc[0] != '(' {
+        return nil, "", os.NewError("bad method descriptor " + desc)
+    }
+    i := 1
+    for i < len(desc) && desc[i] != ')' {
+        start := i
+        for i < len(desc) && desc[i] == '[' { i++ }
+        if i < len(desc) && desc[i] == 'L' {
+            for i < len(desc) && desc[i] != ';' { i++ }
+        }
+        i++
+        if i > len(desc) {
+            return nil, "", os.NewError("bad method descriptor " + desc)
+        }
+        params = append(params, desc[start:i])
+    }
+    if i+1 >= len(desc) {
+        return nil, "", os.NewError("bad method descriptor " + desc)
+    }
+    return params, desc[i+1:], nil
+}
+
+//
+// state holds the types at an instruction, one entry per word:
+// the second word of a long or a double is top.
+//
+type state struct {
+    locals []VerificationType
+    stack  []VerificationType
+}
+
+func (this *state) copy() *state {
+    s := &state{locals: make([]VerificationType, len(this.locals)), stack: make([]VerificationType, len(this.stack))}
+    copy(s.locals, this.locals)
+    copy(s.stack, this.stack)
+    return s
+}
+
+// the frame, with longs and doubles as one entry and no trailing tops
+func (this *state) frame(offset int) *Frame {
+    locals := compact(this.locals)
+    for len(locals) > 0 && locals[len(locals)-1] == topType {
+        locals = locals[0:len(locals)-1]
+    }
+    return &Frame{Offset: offset, Locals: locals, Stack: compact(this.stack)}
+}
+
+func compact(words []VerificationType) []VerificationType {
+    r := []VerificationType{}
+    for i := 0; i < len(words); i++ {
+        r = append(r, words[i])
+        if words[i].isWide() { i++ }
+    }
+    return r
+}
+
+//
+// analysis computes the frames of a method by data flow: the types
+// at each instruction are propagated to the instructions that may
+// follow it, merging where paths join, until nothing changes.
+//
+type analysis struct {
+    cf      *ClassFile
+    method  *Method
+    code    []byte
+    lengths map[int]int        // the instructions, by offset
+    in      map[int]*state     // the types before each instruction reached
+    work    []int
+    pc      int                // the instruction being executed
+}
+
+// analysisError is raised inside the analysis and returned by computeFrames
+type analysisError struct {
+    err os.Error
+}
+
+func (this *analysis) fail(format string, args...interface{}) {
+    msg := fmt.Sprintf(format, args...)
+    panic(analysisError{os.NewError(fmt.Sprintf("pc %d: %s", this.pc, msg))})
+}
+
+func (this *analysis) check(err os.Error) {
+    if err != nil { this.fail("%s", err.String()) }
+}
+
+//
+// computeFrames gives the frame on entry of method m, at offset -1,
+// then its frames
+// sorted by offset at each branch target, exception handler and
+// instruction following an unconditional branch. Code that cannot be
+// reached is replaced by NOPs and a final ATHROW, and left out of the
+// exception handlers, so that it verifies with any frame.
+//
+func computeFrames(cf *ClassFile, m *Method) (initial *Frame, frames []*Frame, err os.Error) {
+    this := &analysis{
+        cf:      cf,
+        method:  m,
+        code:    m.Code.code.b,
+        lengths: map[int]int{},
+        in:      map[int]*state{},
+    }
+    defer func() {
+        if e := recover(); e != nil {
+            ae, ok := e.(analysisError)
+            if !ok { panic(e) }
+            initial, frames, err = nil, nil, ae.err
+        }
+    }()
+    points := this.scan()
+    entry := this.initial()
+    if len(this.code) == 0 {
+        return entry.frame(-1), nil, nil
+    }
+    this.merge(0, entry)
+    for len(this.work) > 0 {
+        pc := this.work[len(this.work)-1]
+        this.work = this.work[0:len(this.work)-1]
+        this.execute(pc)
+    }
+    dead := this.removeDeadCode()
+    for pc, _ := range dead {
+        points[pc] = true
+    }
+    offsets := []int{}
+    for pc, _ := range points {
+        if this.in[pc] == nil && !dead[pc] { continue }
+        // insertion sort
+        i := len(offsets)
+        offsets = append(offsets, pc)
+        for ; i > 0 && offsets[i-1] > pc; i-- {
+            offsets[i] = offsets[i-1]
+        }
+        offsets[i] = pc
+    }
+    for _, pc := range offsets {
+        if dead[pc] {
+            frames = append(frames, &Frame{Offset: pc, Stack: []VerificationType{throwable}})
+        } else {
+            frames = append(frames, this.in[pc].frame(pc))
+        }
+    }
+    return entry.frame(-1), frames, nil
+}
+
+//
+// scan finds the instructions and the offsets needing a frame:
+// branch targets, handlers and the instructions after a goto,
+// a return, a throw or a switch.
+//
+func (this *analysis) scan() map[int]bool {
+    points := map[int]bool{}
+    for pc := 0; pc < len(this.code); {
+        this.pc = pc
+        n := InstructionLength(this.code, pc)
+        if n == 0 { this.fail("truncated instruction") }
+        this.lengths[pc] = n
+        targets, falls := this.targets(pc)
+        for _, t := range targets {
+            points[t] = true
+        }
+        if !falls && pc + n < len(this.code) {
+            points[pc+n] = true
+        }
+        pc += n
+    }
+    for _, h := range this.method.Code.Handlers {
+        points[h.Target.offset] = true
+    }
+    for pc, _ := range points {
+        if _, exists := this.lengths[pc]; !exists {
+            this.pc = pc
+            this.fail("branch into the middle of an instruction")
+        }
+    }
+    return points
+}
+
+// the branch targets of the instruction at pc, and whether it falls through
+func (this *analysis) targets(pc int) ([]int, bool) {
+    code := this.code
+    switch op := int(code[pc]); {
+        case op >= IFEQ && op <= IF_ACMPNE || op == IFNULL || op == IFNONNULL:
+            return []int{pc + int(int16(get2(code[pc+1:])))}, true
+        case op == GOTO:
+            return []int{pc + int(int16(get2(code[pc+1:])))}, false
+        case op == GOTO_W:
+            return []int{pc + get4(code[pc+1:])}, false
+        case op == JSR || op == JSR_W || op == RET:
+            this.fail("jsr and ret are not supported")
+        case op == TABLESWITCH || op == LOOKUPSWITCH:
+            at := (pc + 4) &^ 3
+            targets := []int{pc + get4(code[at:])}
+            if op == TABLESWITCH {
+                for i := at + 12; i < pc + this.lengths[pc]; i += 4 {
+                    targets = append(targets, pc + get4(code[i:]))
+                }
+            } else {
+                for i := at + 8; i < pc + this.lengths[pc]; i += 8 {
+                    targets = append(targets, pc + get4(code[i+4:]))
+                }
+            }
+            return targets, false
+        case op >= IRETURN && op <= RETURN || op == ATHROW:
+            return nil, false
+    }
+    return nil, true
+}
+
+func (this *analysis) initial() *state {
+    s, err := entryState(this.cf, this.method)
+    this.check(err)
+    return s
+}
+
+// the types on entry of method m: this and the parameters
+func entryState(cf *ClassFile, m *Method) (*state, os.Error) {
+    s := new(state)
+    if m.Access & ACC_STATIC == 0 {
+        if m.Name == "<init>" && cf.Name != "java/lang/Object" {
+            s.locals = append(s.locals, VerificationType{Tag: ITEM_UninitializedThis})
+        } else {
+            s.locals = append(s.locals, object(cf.Name))
+        }
+    }
+    params, _, err := splitDescriptor(m.Desc)
+    if err != nil {
+        return nil, err
+    }
+    for _, p := range params {
+        t := descriptorType(p)
+        s.locals = append(s.locals, t)
+        if t.isWide() { s.locals = append(s.locals, topType) }
+    }
+    return s, nil
+}
+
+//
+// merge joins s into the types known at pc, queueing pc again if
+// they changed. Locals that disagree become unusable, while the
+// stacks must agree but for references, merged into a common class.
+//
+func (this *analysis) merge(pc int, s *state) {
+    old, seen := this.in[pc]
+    if !seen {
+        this.in[pc] = s.copy()
+        this.work = append(this.work, pc)
+        return
+    }
+    if len(old.stack) != len(s.stack) {
+        this.fail("stack heights %d and %d differ at %d", len(old.stack), len(s.stack), pc)
+    }
+    changed := false
+    for i, t := range old.stack {
+        m := this.mergeType(t, s.stack[i])
+        if m == topType && t != topType {
+            this.fail("incompatible stack types %s and %s at %d", t, s.stack[i], pc)
+        }
+        if m != t {
+            old.stack[i] = m
+            changed = true
+        }
+    }
+    if len(s.locals) < len(old.locals) {
+        old.locals = old.locals[0:len(s.locals)]
+        changed = true
+    }
+    for i, t := range old.locals {
+        if m := this.mergeType(t, s.locals[i]); m != t {
+            old.locals[i] = m
+            changed = true
+        }
+    }
+    if changed {
+        this.work = append(this.work, pc)
+    }
+}
+
+func (this *analysis) mergeType(a, b VerificationType) VerificationType {
+    switch {
+        case a == b:
+            return a
+        case a.Tag == ITEM_Null && b.Tag == ITEM_Object:
+            return b
+        case a.Tag == ITEM_Object && b.Tag == ITEM_Null:
+            return a
+        case a.Tag == ITEM_Object && b.Tag == ITEM_Object:
+            return object(this.commonSuperclass(a.Class, b.Class))
+    }
+    return topType
+}
+
+//
+// commonSuperclass is the nearest class both a and b extend. Arrays of
+// references merge by their elements; interfaces merge into Object,
+// which the verifier accepts wherever an interface is expected.
+//
+func (this *analysis) commonSuperclass(a, b string) string {
+    const OBJECT = "java/lang/Object"
+    if a[0] == '[' || b[0] == '[' {
+        if a[0] == '[' && b[0] == '[' && isClassDescriptor(a[1:]) && isClassDescriptor(b[1:]) {
+            c := this.commonSuperclass(descriptorType(a[1:]).Class, descriptorType(b[1:]).Class)
+            if c[0] == '[' {
+                return "[" + c
+            }
+            return "[L" + c + ";"
+        }
+        return OBJECT
+    }
+    if this.isInterface(a) || this.isInterface(b) {
+        return OBJECT
+    }
+    supers := map[string]bool{}
+    for c, ok := a, true; ok; c, ok = this.superClass(c) {
+        supers[c] = true
+    }
+    for c, ok := b, true; ok; c, ok = this.superClass(c) {
+        if supers[c] { return c }
+    }
+    return OBJECT
+}
+
+func isClassDescriptor(desc string) bool {
+    return desc[0] == 'L' || desc[0] == '['
+}
+
+func (this *analysis) superClass(name string) (string, bool) {
+    switch {
+        case name == this.cf.Name:
+            return this.cf.Super, this.cf.Super != ""
+        case this.cf.Hierarchy != nil:
+            return this.cf.Hierarchy.SuperClass(name)
+    }
+    return "", false
+}
+
+func (this *analysis) isInterface(name string) bool {
+    switch {
+        case name == this.cf.Name:
+            return this.cf.Access & ACC_INTERFACE != 0
+        case this.cf.Hierarchy != nil:
+            return this.cf.Hierarchy.IsInterface(name)
+    }
+    return false
+}
+
+//
+// the stack and the locals, by words
+//
+
+func (this *analysis) push(s *state, t VerificationType) {
+    s.stack = append(s.stack, t)
+    if t.isWide() { s.stack = append(s.stack, topType) }
+}
+
+func (this *analysis) pop(s *state, words int) []VerificationType {
+    n := len(s.stack)
+    if words > n { this.fail("stack underflow") }
+    r := s.stack[n-words:n]
+    s.stack = s.stack[0:n-words]
+    return r
+}
+
+// pops a value of one word, or of two for a long or a double
+func (this *analysis) popValue(s *state) VerificationType {
+    n := len(s.stack)
+    if n >= 2 && s.stack[n-1] == topType && s.stack[n-2].isWide() {
+        return this.pop(s, 2)[0]
+    }
+    return this.pop(s, 1)[0]
+}
+
+func (this *analysis) load(s *state, kind, n int) {
+    if n >= len(s.locals) { this.fail("load of an unset local %d", n) }
+    t := s.locals[n]
+    if kind == 4 {
+        if !t.isReference() { this.fail("aload of %s", t) }
+        this.push(s, t)
+        return
+    }
+    if t != kinds[kind] { this.fail("load of %s as %s", t, kinds[kind]) }
+    this.push(s, t)
+}
+
+func (this *analysis) store(s *state, n int, t VerificationType) {
+    words := 1
+    if t.isWide() { words = 2 }
+    for len(s.locals) < n + words {
+        s.locals = append(s.locals, topType)
+    }
+    if n > 0 && s.locals[n-1].isWide() {
+        s.locals[n-1] = topType  // overwrites the second word of a long
+    }
+    s.locals[n] = t
+    if words == 2 { s.locals[n+1] = topType }
+}
+
+// replace makes every occurrence of an uninitialized object initialized
+func replace(s *state, from, to VerificationType) {
+    for i, t := range s.locals {
+        if t == from { s.locals[i] = to }
+    }
+    for i, t := range s.stack {
+        if t == from { s.stack[i] = to }
+    }
+}
+
+// the class of a constant pool Class entry, as a verification type
+func (this *analysis) classType(index int) VerificationType {
+    name, err := this.cf.Pool.ClassAt(index)
+    this.check(err)
+    return object(name)
+}
+
+func (this *analysis) constantType(index int) VerificationType {
+    c, err := this.cf.Pool.entry(index, CONST_Integer, CONST_Float, CONST_Long, CONST_Double, CONST_String, CONST_Class)
+    this.check(err)
+    switch c.Tag {
+        case CONST_Integer: return intType
+        case CONST_Float:   return floatType
+        case CONST_Long:    return longType
+        case CONST_Double:  return doubleType
+        case CONST_String:  return object("java/lang/String")
+    }
+    return object("java/lang/Class")
+}
+
+// the element types of NEWARRAY, by atype
+var arrayTypes = map[int]string{4: "[Z", 5: "[C", 6: "[F", 7: "[D", 8: "[B", 9: "[S", 10: "[I", 11: "[J"}
+
+// the types converted by I2L up to I2S, as kinds
+var conversions = [][2]int{
+    {0, 1}, {0, 2}, {0, 3}, {1, 0}, {1, 2}, {1, 3}, {2, 0}, {2, 1},
+    {2, 3}, {3, 0}, {3, 1}, {3, 2}, {0, 0}, {0, 0}, {0, 0},
+}
+
+func words(t VerificationType) int {
+    if t.isWide() { return 2 }
+    return 1
+}
+
+//
+// execute runs the instruction at pc over the types before it,
+// and merges the result into every instruction that may follow.
+//
+func (this *analysis) execute(pc int) {
+    this.pc = pc
+    s := this.in[pc].copy()
+    code := this.code
+    u2 := func() int { return get2(code[pc+1:]) }
+    op := int(code[pc])
+    switch {
+        case op == NOP || op == IINC:
+        case op == ACONST_NULL:
+            this.push(s, nullType)
+        case op >= ICONST_M1 && op <= ICONST_5 || op == BIPUSH || op == SIPUSH:
+            this.push(s, intType)
+        case op == LCONST_0 || op == LCONST_1:
+            this.push(s, longType)
+        case op >= FCONST_0 && op <= FCONST_2:
+            this.push(s, floatType)
+        case op == DCONST_0 || op == DCONST_1:
+            this.push(s, doubleType)
+        case op == LDC:
+            this.push(s, this.constantType(int(code[pc+1])))
+        case op == LDC_W || op == LDC2_W:
+            this.push(s, this.constantType(u2()))
+        case op >= ILOAD && op <= ALOAD:
+            this.load(s, op - ILOAD, int(code[pc+1]))
+        case op >= ILOAD_0 && op <= ALOAD_3:
+            this.load(s, (op - ILOAD_0) / 4, (op - ILOAD_0) % 4)
+        case op >= IALOAD && op <= SALOAD:
+            this.pop(s, 1)
+            array := this.pop(s, 1)[0]
+            switch {
+                case op != AALOAD:
+                    this.push(s, kinds[[]int{0, 1, 2, 3, 4, 0, 0, 0}[op - IALOAD]])
+                case array.Tag == ITEM_Null:
+                    this.push(s, nullType)
+                case array.Tag == ITEM_Object && len(array.Class) > 1 && array.Class[0] == '[':
+                    this.push(s, descriptorType(array.Class[1:]))
+                default:
+                    this.fail("aaload from %s", array)
+            }
+        case op >= ISTORE && op <= ASTORE:
+            this.store(s, int(code[pc+1]), this.popValue(s))
+        case op >= ISTORE_0 && op <= ASTORE_3:
+            this.store(s, (op - ISTORE_0) % 4, this.popValue(s))
+        case op >= IASTORE && op <= SASTORE:
+            this.popValue(s)
+            this.pop(s, 2)
+        case op == POP:
+            this.pop(s, 1)
+        case op == POP2:
+            this.pop(s, 2)
+        case op >= DUP && op <= DUP2_X2:
+            // the words on top, and how many words below them they go
+            n, depth := (op - DUP) / 3 + 1, (op - DUP) % 3
+            values := this.pop(s, n)
+            below := this.pop(s, depth)
+            values, below = append([]VerificationType{}, values...), append([]VerificationType{}, below...)
+            s.stack = append(append(append(s.stack, values...), below...), values...)
+        case op == SWAP:
+            v := this.pop(s, 2)
+            s.stack = append(s.stack, v[1], v[0])
+        case op >= IADD && op <= DREM:
+            t := kinds[(op - IADD) % 4]
+            this.pop(s, 2 * words(t))
+            this.push(s, t)
+        case op >= INEG && op <= DNEG:
+            t := kinds[op - INEG]
+            this.pop(s, words(t))
+            this.push(s, t)
+        case op >= ISHL && op <= LUSHR:
+            t := kinds[(op - ISHL) % 2]
+            this.pop(s, 1 + words(t))
+            this.push(s, t)
+        case op >= IAND && op <= LXOR:
+            t := kinds[(op - IAND) % 2]
+            this.pop(s, 2 * words(t))
+            this.push(s, t)
+        case op >= I2L && op <= I2S:
+            c := conversions[op - I2L]
+            this.pop(s, words(kinds[c[0]]))
+            this.push(s, kinds[c[1]])
+        case op == LCMP || op == DCMPL || op == DCMPG:
+            this.pop(s, 4)
+            this.push(s, intType)
+        case op == FCMPL || op == FCMPG:
+            this.pop(s, 2)
+            this.push(s, intType)
+        case op >= IFEQ && op <= IFLE || op == IFNULL || op == IFNONNULL ||
+             op == TABLESWITCH || op == LOOKUPSWITCH:
+            this.pop(s, 1)
+        case op >= IF_ICMPEQ && op <= IF_ACMPNE:
+            this.pop(s, 2)
+        case op == GOTO || op == GOTO_W || op == RETURN:
+        case op >= IRETURN && op <= ARETURN:
+            this.popValue(s)
+        case op == GETSTATIC || op == PUTSTATIC || op == GETFIELD || op == PUTFIELD:
+            _, _, desc, err := this.cf.Pool.RefAt(u2())
+            this.check(err)
+            t := descriptorType(desc)
+            switch op {
+                case GETSTATIC:
+                    this.push(s, t)
+                case PUTSTATIC:
+                    this.pop(s, words(t))
+                case GETFIELD:
+                    this.pop(s, 1)
+                    this.push(s, t)
+                case PUTFIELD:
+                    this.pop(s, words(t) + 1)
+            }
+        case op >= INVOKEVIRTUAL && op <= INVOKEINTERFACE:
+            this.invoke(s, op, u2())
+        case op == NEW:
+            this.classType(u2())
+            this.push(s, VerificationType{Tag: ITEM_Uninitialized, Offset: pc})
+        case op == NEWARRAY:
+            this.pop(s, 1)
+            desc, exists := arrayTypes[int(code[pc+1])]
+            if !exists { this.fail("bad newarray type %d", code[pc+1]) }
+            this.push(s, object(desc))
+        case op == ANEWARRAY:
+            this.pop(s, 1)
+            element := this.classType(u2()).Class
+            if element[0] == '[' {
+                this.push(s, object("[" + element))
+            } else {
+                this.push(s, object("[L" + element + ";"))
+            }
+        case op == ARRAYLENGTH || op == INSTANCEOF:
+            this.pop(s, 1)
+            this.push(s, intType)
+        case op == ATHROW || op == MONITORENTER || op == MONITOREXIT:
+            this.pop(s, 1)
+        case op == CHECKCAST:
+            this.pop(s, 1)
+            this.push(s, this.classType(u2()))
+        case op == MULTIANEWARRAY:
+            this.pop(s, int(code[pc+3]))
+            this.push(s, this.classType(u2()))
+        case op == WIDE:
+            op, n := int(code[pc+1]), get2(code[pc+2:])
+            switch {
+                case op >= ILOAD && op <= ALOAD:
+                    this.load(s, op - ILOAD, n)
+                case op >= ISTORE && op <= ASTORE:
+                    this.store(s, n, this.popValue(s))
+                case op != IINC:
+                    this.fail("bad wide instruction")
+            }
+        default:
+            this.fail("unsupported opcode 0x%02x", op)
+    }
+    // handlers see the locals both before and after the instruction
+    for _, h := range this.method.Code.Handlers {
+        if pc < h.Start.offset || pc >= h.End.offset { continue }
+        catch := throwable
+        if h.CatchType != "" { catch = object(h.CatchType) }
+        for _, locals := range [][]VerificationType{this.in[pc].locals, s.locals} {
+            this.merge(h.Target.offset, &state{locals: locals, stack: []VerificationType{catch}})
+        }
+    }
+    targets, falls := this.targets(pc)
+    for _, t := range targets {
+        this.merge(t, s)
+    }
+    if falls {
+        if pc + this.lengths[pc] >= len(code) { this.fail("falling off the end of the code") }
+        this.merge(pc + this.lengths[pc], s)
+    }
+}
+
+func (this *analysis) invoke(s *state, op, index int) {
+    _, name, desc, err := this.cf.Pool.RefAt(index)
+    this.check(err)
+    params, ret, err := splitDescriptor(desc)
+    this.check(err)
+    for _, p := range params {
+        this.pop(s, words(descriptorType(p)))
+    }
+    if op != INVOKESTATIC {
+        receiver := this.pop(s, 1)[0]
+        if op == INVOKESPECIAL && name == "<init>" {
+            switch receiver.Tag {
+                case ITEM_UninitializedThis:
+                    replace(s, receiver, object(this.cf.Name))
+                case ITEM_Uninitialized:
+                    replace(s, receiver, this.classType(get2(this.code[receiver.Offset+1:])))
+                default:
+                    this.fail("<init> called on %s", receiver)
+            }
+        }
+    }
+    if ret != "V" {
+        this.push(s, descriptorType(ret))
+    }
+}
+
+//
+// removeDeadCode turns each run of instructions never reached into
+// NOPs ending with ATHROW, and takes it out of the exception handlers.
+// It gives the offsets where the runs start.
+//
+func (this *analysis) removeDeadCode() map[int]bool {
+    dead := map[int]bool{}
+    ranges := [][2]int{}
+    for pc := 0; pc < len(this.code); pc += this.lengths[pc] {
+        if this.in[pc] != nil { continue }
+        start := pc
+        for pc + this.lengths[pc] < len(this.code) && this.in[pc + this.lengths[pc]] == nil {
+            pc += this.lengths[pc]
+        }
+        end := pc + this.lengths[pc]
+        for i := start; i < end - 1; i++ {
+            this.code[i] = NOP
+        }
+        this.code[end-1] = ATHROW
+        dead[start] = true
+        ranges = append(ranges, [2]int{start, end})
+    }
+    if len(ranges) == 0 { return dead }
+
+    code := this.method.Code
+    handlers := []*Handler{}
+    for _, h := range code.Handlers {
+        start := h.Start.offset
+        for _, r := range ranges {
+            if r[1] <= start || r[0] >= h.End.offset { continue }
+            if r[0] > start {
+                handlers = append(handlers, &Handler{Start: &Label{offset: start}, End: &Label{offset: r[0]}, Target: h.Target, CatchType: h.CatchType})
+            }
+            start = r[1]
+        }
+        if start < h.End.offset {
+            handlers = append(handlers, &Handler{Start: &Label{offset: start}, End: h.End, Target: h.Target, CatchType: h.CatchType})
+        }
+    }
+    code.Handlers = handlers
+    return dead
+}
+
+//
+// stackMapTable encodes frames, each one relative to the one before,
+// the first one to the frame on entry, which is at offset -1.
+//
+func stackMapTable(pool *ConstantPool, initial *Frame, frames []*Frame) *Attribute {
+    out := new(buffer)
+    out.u2(len(frames))
+    prev := initial
+    for _, f := range frames {
+        delta := f.Offset - prev.Offset - 1
+        k := len(f.Locals) - len(prev.Locals)
+        switch {
+            case len(f.Stack) == 0 && k == 0 && sameTypes(f.Locals, prev.Locals):
+                if delta < 64 {
+                    out.u1(delta)  // same_frame
+                } else {
+                    out.u1(251)
+                    out.u2(delta)
+                }
+            case len(f.Stack) == 1 && k == 0 && sameTypes(f.Locals, prev.Locals):
+                if delta < 64 {
+                    out.u1(64 + delta)
+                } else {
+                    out.u1(247)
+                    out.u2(delta)
+                }
+                writeType(out, pool, f.Stack[0])
+            case len(f.Stack) == 0 && k < 0 && k >= -3 && sameTypes(f.Locals, prev.Locals[0:len(f.Locals)]):
+                out.u1(251 + k)  // chop
+                out.u2(delta)
+            case len(f.Stack) == 0 && k > 0 && k <= 3 && sameTypes(f.Locals[0:len(prev.Locals)], prev.Locals):
+                out.u1(251 + k)  // append
+                out.u2(delta)
+                for _, t := range f.Locals[len(prev.Locals):] {
+                    writeType(out, pool, t)
+                }
+            default:
+                out.u1(255)
+                out.u2(delta)
+                out.u2(len(f.Locals))
+                for _, t := range f.Locals {
+                    writeType(out, pool, t)
+                }
+                out.u2(len(f.Stack))
+                for _, t := range f.Stack {
+                    writeType(out, pool, t)
+                }
+        }
+        prev = f
+    }
+    return &Attribute{Name: "StackMapTable", Info: out.b}
+}
+
+func sameTypes(a, b []VerificationType) bool {
+    if len(a) != len(b) { return false }
+    for i, t := range a {
+        if t != b[i] { return false }
+    }
+    return true
+}
+
+func writeType(out *buffer, pool *ConstantPool, t VerificationType) {
+    out.u1(t.Tag)
+    switch t.Tag {
+        case ITEM_Object:
+            out.u2(pool.Class(t.Class))
+        case ITEM_Uninitialized:
+            out.u2(t.Offset)
+    }
+}
@@ -0,0 +1,169 @@
+package classfile_test
+
+import "testing"
+import "bytes"
+import . "classfile"
+
+// the info of the StackMapTable attribute of the only method of cf
+func stackMap(t *testing.T, cf *ClassFile) []byte {
+    b, err := cf.Bytes()
+    if err != nil {
+        t.Fatalf("%s", err)
+    }
+    name := cf.Pool.Utf8("StackMapTable")
+    at := bytes.Index(b, []byte{byte(name >> 8), byte(name), 0, 0})
+    if at < 0 {
+        t.Fatalf("no StackMapTable in % x", b)
+    }
+    n := int(b[at+4]) << 8 | int(b[at+5])
+    return b[at+6:at+6+n]
+}
+
+func java7(name string) *ClassFile {
+    cf := NewClassFile(ACC_SUPER, name, "java/lang/Object")
+    cf.Major = JAVA_7
+    return cf
+}
+
+// static void f(int a) { Object x = a != 0 ? "x" : null; }
+func TestFrames(t *testing.T) {
+    cf := java7("A")
+    code := cf.AddMethod(ACC_STATIC, "f", "(I)V").NewCode()
+    code.MaxStack, code.MaxLocals = 1, 2
+    other, join := code.NewLabel(), code.NewLabel()
+    code.Op(ILOAD_0)
+    code.Jump(IFEQ, other)
+    code.Op1(LDC, cf.Pool.String("x"))
+    code.Jump(GOTO, join)
+    code.Bind(other)
+    code.Op(ACONST_NULL)
+    code.Bind(join)
+    code.Op(ASTORE_1)
+    code.Op(RETURN)
+
+    info := stackMap(t, cf)
+    str := cf.Pool.Class("java/lang/String")
+    // same_frame at 9, then a String on the stack at 10
+    expect := []byte{0, 2, 9, 64, ITEM_Object, byte(str >> 8), byte(str)}
+    if !bytes.Equal(info, expect) {
+        t.Fatalf("wrong frames % x", info)
+    }
+}
+
+type hierarchy map[string]string
+
+func (this hierarchy) SuperClass(name string) (string, bool) {
+    s, exists := this[name]
+    return s, exists
+}
+
+func (this hierarchy) IsInterface(name string) bool {
+    return false
+}
+
+// void f(boolean b) { C c = b ? new A() : new B(); }, A and B extending C
+func TestCommonSuperclass(t *testing.T) {
+    cf := java7("T")
+    cf.Hierarchy = hierarchy{"A": "C", "B": "C", "C": "java/lang/Object"}
+    code := cf.AddMethod(0, "f", "(Z)V").NewCode()
+    code.MaxStack, code.MaxLocals = 2, 3
+    other, join := code.NewLabel(), code.NewLabel()
+    code.Op(ILOAD_1)
+    code.Jump(IFEQ, other)
+    newObject := func(class string) {
+        code.Op2(NEW, cf.Pool.Class(class))
+        code.Op(DUP)
+        code.Op2(INVOKESPECIAL, cf.Pool.MethodRef(class, "<init>", "()V"))
+    }
+    newObject("A")
+    code.Jump(GOTO, join)
+    code.Bind(other)
+    newObject("B")
+    code.Bind(join)
+    code.Op(ASTORE_2)
+    code.Op(RETURN)
+
+    info := stackMap(t, cf)
+    c := cf.Pool.Class("C")
+    // same_frame at 14, then a C on the stack at 21
+    expect := []byte{0, 2, 14, 64 + 6, ITEM_Object, byte(c >> 8), byte(c)}
+    if !bytes.Equal(info, expect) {
+        t.Fatalf("wrong frames % x", info)
+    }
+}
+
+//
+// static void f(long a, double b, boolean c) { new StringBuilder(c ? "x" : "y"); },
+// the new object staying uninitialized on the stack across the branch
+//
+func TestWideLocalsAndUninitialized(t *testing.T) {
+    cf := java7("W")
+    code := cf.AddMethod(ACC_STATIC, "f", "(JDZ)V").NewCode()
+    code.MaxStack, code.MaxLocals = 3, 5
+    other, join := code.NewLabel(), code.NewLabel()
+    sb := cf.Pool.Class("java/lang/StringBuilder")
+    code.Op2(NEW, sb)
+    code.Op(DUP)
+    code.Local(ILOAD, 4)
+    code.Jump(IFEQ, other)
+    code.Op1(LDC, cf.Pool.String("x"))
+    code.Jump(GOTO, join)
+    code.Bind(other)
+    code.Op1(LDC, cf.Pool.String("y"))
+    code.Bind(join)
+    code.Op2(INVOKESPECIAL, cf.Pool.MethodRef("java/lang/StringBuilder", "<init>", "(Ljava/lang/String;)V"))
+    code.Op(POP)
+    code.Op(RETURN)
+
+    info := stackMap(t, cf)
+    str := cf.Pool.Class("java/lang/String")
+    locals := []byte{0, 3, ITEM_Long, ITEM_Double, ITEM_Integer}
+    uninitialized := []byte{ITEM_Uninitialized, 0, 0, ITEM_Uninitialized, 0, 0}
+    // full frames at 14 and 16, a long and a double taking one entry each
+    expect := []byte{0, 2, 255, 0, 14}
+    expect = append(expect, locals...)
+    expect = append(expect, 0, 2)
+    expect = append(expect, uninitialized...)
+    expect = append(expect, 255, 0, 1)
+    expect = append(expect, locals...)
+    expect = append(expect, 0, 3)
+    expect = append(expect, uninitialized...)
+    expect = append(expect, ITEM_Object, byte(str >> 8), byte(str))
+    if !bytes.Equal(info, expect) {
+        t.Fatalf("wrong frames % x", info)
+    }
+}
+
+func TestDeadCode(t *testing.T) {
+    cf := java7("D")
+    code := cf.AddMethod(ACC_STATIC, "f", "()V").NewCode()
+    code.MaxStack = 1
+    code.Op(RETURN)
+    code.Op(ICONST_1)
+    code.Op(POP)
+    code.Op(RETURN)
+
+    info := stackMap(t, cf)
+    throwable := cf.Pool.Class("java/lang/Throwable")
+    if !bytes.Equal(info, []byte{0, 1, 64 + 1, ITEM_Object, byte(throwable >> 8), byte(throwable)}) {
+        t.Fatalf("wrong frames % x", info)
+    }
+    if !bytes.Equal(code.Bytes(), []byte{RETURN, NOP, NOP, ATHROW}) {
+        t.Fatalf("dead code left in % x", code.Bytes())
+    }
+}
+
+func TestStackHeightsDiffer(t *testing.T) {
+    cf := java7("E")
+    code := cf.AddMethod(ACC_STATIC, "f", "(I)V").NewCode()
+    join := code.NewLabel()
+    code.Op(ICONST_1)
+    code.Op(ILOAD_0)
+    code.Jump(IFEQ, join)
+    code.Op(POP)
+    code.Bind(join)
+    code.Op(RETURN)
+    if _, err := cf.Bytes(); err == nil || err.String() != "E.f(I)V: pc 5: stack heights 1 and 0 differ at 6" {
+        t.Fatalf("expect an error for different stack heights, found %v", err)
+    }
+}
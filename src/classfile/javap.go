@@ -0,0 +1,524 @@
+package classfile
+
+import "io"
+import "fmt"
+import "strconv"
+import "strings"
+
+//
+// Disassemble writes a listing of cf in the manner of javap -v: the
+// constant pool, then each member with its flags, its signature, its
+// bytecode and its attributes. Constants are shown as they resolve,
+// or as what is wrong with them. The code of a class being generated
+// is shown unpatched, so read it back with Parse first.
+//
+func Disassemble(out io.Writer, cf *ClassFile) {
+    this := &disassembler{out: out, cf: cf, pool: cf.Pool}
+    this.header()
+    this.constantPool()
+    this.printf("{\n")
+    for i, f := range cf.Fields {
+        if i > 0 { this.printf("\n") }
+        this.printf("  %s%s %s;\n", modifiers(f.Access, fieldFlags), javaType(f.Desc), f.Name)
+        this.printf("    descriptor: %s\n", f.Desc)
+        this.printf("    flags: %s\n", flags(f.Access, fieldFlags))
+        this.attributes(f.Attributes, "    ")
+    }
+    for i, m := range cf.Methods {
+        if i > 0 || len(cf.Fields) > 0 { this.printf("\n") }
+        this.method(m)
+    }
+    this.printf("}\n")
+    this.attributes(cf.Attributes, "")
+}
+
+type disassembler struct {
+    out  io.Writer
+    cf   *ClassFile
+    pool *ConstantPool
+}
+
+func (this *disassembler) printf(format string, args...interface{}) {
+    fmt.Fprintf(this.out, format, args...)
+}
+
+type flagName struct {
+    flag    int
+    name    string
+    keyword string      // the modifier, if there is one
+}
+
+var classFlags = []flagName{
+    {ACC_PUBLIC, "ACC_PUBLIC", "public"},
+    {ACC_FINAL, "ACC_FINAL", "final"},
+    {ACC_SUPER, "ACC_SUPER", ""},
+    {ACC_INTERFACE, "ACC_INTERFACE", ""},
+    {ACC_ABSTRACT, "ACC_ABSTRACT", "abstract"},
+    {ACC_SYNTHETIC, "ACC_SYNTHETIC", ""},
+    {ACC_ANNOTATION, "ACC_ANNOTATION", ""},
+    {ACC_ENUM, "ACC_ENUM", ""},
+}
+
+var fieldFlags = []flagName{
+    {ACC_PUBLIC, "ACC_PUBLIC", "public"},
+    {ACC_PRIVATE, "ACC_PRIVATE", "private"},
+    {ACC_PROTECTED, "ACC_PROTECTED", "protected"},
+    {ACC_STATIC, "ACC_STATIC", "static"},
+    {ACC_FINAL, "ACC_FINAL", "final"},
+    {ACC_VOLATILE, "ACC_VOLATILE", "volatile"},
+    {ACC_TRANSIENT, "ACC_TRANSIENT", "transient"},
+    {ACC_SYNTHETIC, "ACC_SYNTHETIC", ""},
+    {ACC_ENUM, "ACC_ENUM", ""},
+}
+
+var methodFlags = []flagName{
+    {ACC_PUBLIC, "ACC_PUBLIC", "public"},
+    {ACC_PRIVATE, "ACC_PRIVATE", "private"},
+    {ACC_PROTECTED, "ACC_PROTECTED", "protected"},
+    {ACC_STATIC, "ACC_STATIC", "static"},
+    {ACC_FINAL, "ACC_FINAL", "final"},
+    {ACC_SYNCHRONIZED, "ACC_SYNCHRONIZED", "synchronized"},
+    {ACC_BRIDGE, "ACC_BRIDGE", ""},
+    {ACC_VARARGS, "ACC_VARARGS", ""},
+    {ACC_NATIVE, "ACC_NATIVE", "native"},
+    {ACC_ABSTRACT, "ACC_ABSTRACT", "abstract"},
+    {ACC_STRICT, "ACC_STRICT", "strictfp"},
+    {ACC_SYNTHETIC, "ACC_SYNTHETIC", ""},
+}
+
+// (0x0021) ACC_PUBLIC, ACC_SUPER
+func flags(access int, table []flagName) string {
+    names := []string{}
+    for _, f := range table {
+        if access & f.flag != 0 { names = append(names, f.name) }
+    }
+    return fmt.Sprintf("(0x%04x) %s", access, strings.Join(names, ", "))
+}
+
+// the modifiers of access with a trailing space, as "public static "
+func modifiers(access int, table []flagName) string {
+    s := ""
+    for _, f := range table {
+        if access & f.flag != 0 && f.keyword != "" { s += f.keyword + " " }
+    }
+    return s
+}
+
+func javaName(internal string) string {
+    return strings.Replace(internal, "/", ".", -1)
+}
+
+var primitiveNames = map[string]string{
+    "B": "byte", "C": "char", "D": "double", "F": "float", "I": "int",
+    "J": "long", "S": "short", "Z": "boolean", "V": "void",
+}
+
+// javaType gives the source form of a field descriptor, as java.lang.String[]
+func javaType(desc string) string {
+    dims := 0
+    for dims < len(desc) && desc[dims] == '[' { dims++ }
+    t := desc[dims:]
+    if name, exists := primitiveNames[t]; exists {
+        t = name
+    } else if len(t) > 2 && t[0] == 'L' && t[len(t)-1] == ';' {
+        t = javaName(t[1:len(t)-1])
+    } else {
+        return desc
+    }
+    return t + strings.Repeat("[]", dims)
+}
+
+func (this *disassembler) header() {
+    cf := this.cf
+    kind := "class "
+    access := cf.Access
+    if access & ACC_INTERFACE != 0 {
+        kind = "interface "
+        access &^= ACC_ABSTRACT
+    }
+    this.printf("%s%s%s", modifiers(access, classFlags), kind, javaName(cf.Name))
+    if cf.Super != "" && cf.Access & ACC_INTERFACE == 0 { this.printf(" extends %s", javaName(cf.Super)) }
+    if len(cf.Interfaces) > 0 {
+        names := []string{}
+        for _, i := range cf.Interfaces {
+            names = append(names, javaName(i))
+        }
+        this.printf(" implements %s", strings.Join(names, ", "))
+    }
+    this.printf("\n  minor version: %d\n  major version: %d\n", cf.Minor, cf.Major)
+    this.printf("  flags: %s\n", flags(cf.Access, classFlags))
+}
+
+var constantNames = map[int]string{
+    CONST_Utf8: "Utf8", CONST_Integer: "Integer", CONST_Float: "Float",
+    CONST_Long: "Long", CONST_Double: "Double", CONST_Class: "Class",
+    CONST_String: "String", CONST_FieldRef: "Fieldref", CONST_MethodRef: "Methodref",
+    CONST_InterfaceMethodRef: "InterfaceMethodref", CONST_NameAndType: "NameAndType",
+    CONST_MethodHandle: "MethodHandle", CONST_MethodType: "MethodType",
+    CONST_Dynamic: "Dynamic", CONST_InvokeDynamic: "InvokeDynamic",
+    CONST_Module: "Module", CONST_Package: "Package",
+}
+
+// the kinds of constants as instructions refer to them
+var constantKinds = map[int]string{
+    CONST_Integer: "int", CONST_Float: "float", CONST_Long: "long",
+    CONST_Double: "double", CONST_Class: "class", CONST_String: "String",
+    CONST_FieldRef: "Field", CONST_MethodRef: "Method",
+    CONST_InterfaceMethodRef: "InterfaceMethod", CONST_MethodHandle: "MethodHandle",
+    CONST_MethodType: "MethodType", CONST_Dynamic: "Dynamic",
+    CONST_InvokeDynamic: "InvokeDynamic",
+}
+
+var handleKinds = []string{
+    "", "REF_getField", "REF_getStatic", "REF_putField", "REF_putStatic", "REF_invokeVirtual",
+    "REF_invokeStatic", "REF_invokeSpecial", "REF_newInvokeSpecial", "REF_invokeInterface",
+}
+
+func (this *disassembler) constantPool() {
+    this.printf("Constant pool:\n")
+    for i := 1; i < this.pool.Count(); i++ {
+        c := this.pool.At(i)
+        if c == nil { continue }
+        index := "#" + strconv.Itoa(i)
+        switch c.Tag {
+            case CONST_Utf8, CONST_Integer, CONST_Float, CONST_Long, CONST_Double:
+                this.printf("%5s = %-18s %s\n", index, constantNames[c.Tag], this.constant(i))
+            default:
+                this.printf("%5s = %-18s %-15s // %s\n", index, constantNames[c.Tag], operands(c), this.constant(i))
+        }
+    }
+}
+
+// the indexes c refers to, as #1.#2
+func operands(c *Constant) string {
+    d := c.Data
+    switch c.Tag {
+        case CONST_FieldRef, CONST_MethodRef, CONST_InterfaceMethodRef:
+            return fmt.Sprintf("#%d.#%d", get2(d), get2(d[2:]))
+        case CONST_NameAndType, CONST_Dynamic, CONST_InvokeDynamic:
+            return fmt.Sprintf("#%d:#%d", get2(d), get2(d[2:]))
+        case CONST_MethodHandle:
+            return fmt.Sprintf("%d:#%d", d[0], get2(d[1:]))
+    }
+    return fmt.Sprintf("#%d", get2(d))
+}
+
+func escape(s string) string {
+    q := strconv.Quote(s)
+    return q[1:len(q)-1]
+}
+
+// member names as <init> are quoted, as javap does
+func memberName(name string) string {
+    if strings.HasPrefix(name, "<") { return "\"" + name + "\"" }
+    return name
+}
+
+//
+// constant resolves the constant at i, as java/lang/Object."<init>":()V
+// for a method reference, or tells what is wrong with it.
+//
+func (this *disassembler) constant(i int) string {
+    c, err := this.pool.entry(i, CONST_Utf8, CONST_Integer, CONST_Float, CONST_Long, CONST_Double,
+                              CONST_Class, CONST_String, CONST_FieldRef, CONST_MethodRef,
+                              CONST_InterfaceMethodRef, CONST_NameAndType, CONST_MethodHandle,
+                              CONST_MethodType, CONST_Dynamic, CONST_InvokeDynamic,
+                              CONST_Module, CONST_Package)
+    if err != nil {
+        return err.String()
+    }
+    var s, name, desc string
+    switch c.Tag {
+        case CONST_Utf8:
+            s, err = this.pool.Utf8At(i)
+            s = escape(s)
+        case CONST_Integer, CONST_Float, CONST_Long, CONST_Double:
+            var v interface{}
+            v, err = this.pool.Value(i)
+            s = value(v)
+        case CONST_Class:
+            s, err = this.pool.ClassAt(i)
+        case CONST_String, CONST_MethodType, CONST_Module, CONST_Package:
+            s, err = this.pool.Utf8At(get2(c.Data))
+            if c.Tag == CONST_String { s = escape(s) }
+        case CONST_FieldRef, CONST_MethodRef, CONST_InterfaceMethodRef:
+            s, name, desc, err = this.pool.RefAt(i)
+            s += "." + memberName(name) + ":" + desc
+        case CONST_NameAndType:
+            name, desc, err = this.pool.NameAndTypeAt(i)
+            s = memberName(name) + ":" + desc
+        case CONST_Dynamic, CONST_InvokeDynamic:
+            name, desc, err = this.pool.NameAndTypeAt(get2(c.Data[2:]))
+            s = fmt.Sprintf("#%d:%s:%s", get2(c.Data), memberName(name), desc)
+        case CONST_MethodHandle:
+            kind := int(c.Data[0])
+            if kind >= len(handleKinds) { kind = 0 }
+            s, name, desc, err = this.pool.RefAt(get2(c.Data[1:]))
+            s = handleKinds[kind] + " " + s + "." + memberName(name) + ":" + desc
+    }
+    if err != nil {
+        return err.String()
+    }
+    return s
+}
+
+// a constant value, with the suffix javap gives it
+func value(v interface{}) string {
+    switch v := v.(type) {
+        case float32:
+            return fmt.Sprintf("%vf", v)
+        case int64:
+            return fmt.Sprintf("%dl", v)
+        case float64:
+            return fmt.Sprintf("%vd", v)
+        case string:
+            return "\"" + escape(v) + "\""
+    }
+    return fmt.Sprint(v)
+}
+
+func (this *disassembler) method(m *Method) {
+    params, result, err := splitDescriptor(m.Desc)
+    switch {
+        case err != nil:
+            this.printf("  %s%s%s;\n", modifiers(m.Access, methodFlags), m.Name, m.Desc)
+        case m.Name == "<clinit>":
+            this.printf("  static {};\n")
+        default:
+            types := []string{}
+            for _, p := range params {
+                types = append(types, javaType(p))
+            }
+            name := m.Name
+            if name == "<init>" {
+                name = javaName(this.cf.Name)
+            } else {
+                name = javaType(result) + " " + name
+            }
+            this.printf("  %s%s(%s)", modifiers(m.Access, methodFlags), name, strings.Join(types, ", "))
+            if len(m.Exceptions) > 0 {
+                names := []string{}
+                for _, e := range m.Exceptions {
+                    names = append(names, javaName(e))
+                }
+                this.printf(" throws %s", strings.Join(names, ", "))
+            }
+            this.printf(";\n")
+    }
+    this.printf("    descriptor: %s\n", m.Desc)
+    this.printf("    flags: %s\n", flags(m.Access, methodFlags))
+    if m.Code != nil {
+        this.code(m, params)
+    }
+    if len(m.Exceptions) > 0 {
+        this.printf("    Exceptions:\n")
+        for _, e := range m.Exceptions {
+            this.printf("      throws %s\n", e)
+        }
+    }
+    this.attributes(m.Attributes, "    ")
+}
+
+func (this *disassembler) code(m *Method, params []string) {
+    c := m.Code
+    args := 0
+    if m.Access & ACC_STATIC == 0 { args++ }
+    for _, p := range params {
+        args++
+        if p == "J" || p == "D" { args++ }
+    }
+    this.printf("    Code:\n      stack=%d, locals=%d, args_size=%d\n", c.MaxStack, c.MaxLocals, args)
+    b := c.Bytes()
+    for pc := 0; pc < len(b); {
+        n := InstructionLength(b, pc)
+        if n == 0 {
+            this.printf("%10d: truncated\n", pc)
+            break
+        }
+        this.instruction(b, pc)
+        pc += n
+    }
+    if len(c.Handlers) > 0 {
+        this.printf("      Exception table:\n         from    to  target type\n")
+        for _, h := range c.Handlers {
+            catch := "any"
+            if h.CatchType != "" { catch = "Class " + h.CatchType }
+            this.printf("         %5d %5d %5d   %s\n", h.Start.Offset(), h.End.Offset(), h.Target.Offset(), catch)
+        }
+    }
+    if lines := c.Lines(); len(lines) > 0 {
+        this.printf("      LineNumberTable:\n")
+        for _, l := range lines {
+            this.printf("        line %d: %d\n", l.Line, l.StartPC)
+        }
+    }
+    this.attributes(c.Attributes, "      ")
+}
+
+// the NEWARRAY codes
+var arrayTypeNames = map[int]string{
+    4: "boolean", 5: "char", 6: "float", 7: "double", 8: "byte", 9: "short", 10: "int", 11: "long",
+}
+
+//
+// instruction prints the instruction at code[pc], which InstructionLength
+// has checked, with its operands resolved.
+//
+func (this *disassembler) instruction(code []byte, pc int) {
+    op := int(code[pc])
+    name, exists := OpcodeNames[op]
+    if !exists { name = "<" + strconv.Itoa(op) + ">" }
+    args, comment := "", ""
+    switch {
+        case op == BIPUSH:
+            args = strconv.Itoa(int(int8(code[pc+1])))
+        case op == SIPUSH:
+            args = strconv.Itoa(int(int16(get2(code[pc+1:]))))
+        case op == LDC:
+            i := int(code[pc+1])
+            args, comment = "#" + strconv.Itoa(i), this.reference(i)
+        case op == LDC_W || op == LDC2_W || op >= GETSTATIC && op <= INVOKESTATIC ||
+             op == NEW || op == ANEWARRAY || op == CHECKCAST || op == INSTANCEOF:
+            i := get2(code[pc+1:])
+            args, comment = "#" + strconv.Itoa(i), this.reference(i)
+        case op == INVOKEINTERFACE || op == INVOKEDYNAMIC || op == MULTIANEWARRAY:
+            i := get2(code[pc+1:])
+            args = fmt.Sprintf("#%d, %d", i, code[pc+3])
+            comment = this.reference(i)
+        case op >= ILOAD && op <= ALOAD || op >= ISTORE && op <= ASTORE || op == RET:
+            args = strconv.Itoa(int(code[pc+1]))
+        case op == IINC:
+            args = fmt.Sprintf("%d, %d", code[pc+1], int8(code[pc+2]))
+        case op >= IFEQ && op <= JSR || op == IFNULL || op == IFNONNULL:
+            args = strconv.Itoa(pc + int(int16(get2(code[pc+1:]))))
+        case op == GOTO_W || op == JSR_W:
+            args = strconv.Itoa(pc + get4(code[pc+1:]))
+        case op == NEWARRAY:
+            args = arrayTypeNames[int(code[pc+1])]
+            if args == "" { args = strconv.Itoa(int(code[pc+1])) }
+        case op == WIDE:
+            name = "wide " + OpcodeNames[int(code[pc+1])]
+            args = strconv.Itoa(get2(code[pc+2:]))
+            if int(code[pc+1]) == IINC {
+                args += ", " + strconv.Itoa(int(int16(get2(code[pc+4:]))))
+            }
+        case op == TABLESWITCH || op == LOOKUPSWITCH:
+            this.switchInstruction(code, pc)
+            return
+    }
+    line := strings.TrimRight(fmt.Sprintf("%-13s %s", name, args), " ")
+    if comment != "" {
+        line = fmt.Sprintf("%-32s // %s", line, comment)
+    }
+    this.printf("%10d: %s\n", pc, line)
+}
+
+// the constant at i as an instruction refers to it, as Method java/lang/Object."<init>":()V
+func (this *disassembler) reference(i int) string {
+    if i > 0 && i < this.pool.Count() && this.pool.At(i) != nil {
+        if kind, exists := constantKinds[this.pool.At(i).Tag]; exists {
+            return kind + " " + this.constant(i)
+        }
+    }
+    return this.constant(i)
+}
+
+func (this *disassembler) switchInstruction(code []byte, pc int) {
+    op := int(code[pc])
+    at := (pc + 4) &^ 3
+    dflt := pc + get4(code[at:])
+    if op == TABLESWITCH {
+        low, high := get4(code[at+4:]), get4(code[at+8:])
+        this.printf("%10d: %-13s { // %d to %d\n", pc, OpcodeNames[op], low, high)
+        for k := low; k <= high; k++ {
+            this.printf("%24d: %d\n", k, pc + get4(code[at+12+4*(k-low):]))
+        }
+    } else {
+        n := get4(code[at+4:])
+        this.printf("%10d: %-13s { // %d\n", pc, OpcodeNames[op], n)
+        for k := 0; k < n; k++ {
+            this.printf("%24d: %d\n", get4(code[at+8+8*k:]), pc + get4(code[at+12+8*k:]))
+        }
+    }
+    this.printf("%24s: %d\n%13s\n", "default", dflt, "}")
+}
+
+//
+// attributes prints the attributes Parse decoded, and the name and
+// length of the others.
+//
+func (this *disassembler) attributes(attrs []*Attribute, indent string) {
+    for _, a := range attrs {
+        switch v := a.Value.(type) {
+            case string:
+                if a.Name == "SourceFile" { v = "\"" + v + "\"" }
+                this.printf("%s%s: %s\n", indent, a.Name, v)
+            case int32:
+                this.printf("%s%s: int %s\n", indent, a.Name, value(v))
+            case float32:
+                this.printf("%s%s: float %s\n", indent, a.Name, value(v))
+            case int64:
+                this.printf("%s%s: long %s\n", indent, a.Name, value(v))
+            case float64:
+                this.printf("%s%s: double %s\n", indent, a.Name, value(v))
+            case []LineNumber:
+                this.printf("%s%s:\n", indent, a.Name)
+                for _, l := range v {
+                    this.printf("%s  line %d: %d\n", indent, l.Line, l.StartPC)
+                }
+            case []LocalVariable:
+                this.printf("%s%s:\n%s  Start  Length  Slot  Name   Signature\n", indent, a.Name, indent)
+                for _, l := range v {
+                    this.printf("%s  %5d  %6d  %4d  %5s   %s\n", indent, l.StartPC, l.Length, l.Index, l.Name, l.Desc)
+                }
+            case []InnerClass:
+                this.printf("%s%s:\n", indent, a.Name)
+                for _, c := range v {
+                    this.printf("%s  %s%s", indent, modifiers(c.Access &^ ACC_SUPER, classFlags), c.Inner)
+                    if c.Name != "" { this.printf(" = %s", c.Name) }
+                    if c.Outer != "" { this.printf(" of %s", c.Outer) }
+                    this.printf("\n")
+                }
+            case *EnclosingMethod:
+                this.printf("%s%s: %s", indent, a.Name, v.Class)
+                if v.Name != "" { this.printf(".%s:%s", memberName(v.Name), v.Desc) }
+                this.printf("\n")
+            case []*Frame:
+                this.printf("%s%s: number_of_entries = %d\n", indent, a.Name, len(v))
+                for _, f := range v {
+                    this.printf("%s  frame at %d\n", indent, f.Offset)
+                    this.printf("%s    locals = %s\n", indent, types(f.Locals))
+                    this.printf("%s    stack = %s\n", indent, types(f.Stack))
+                }
+            case []*Annotation:
+                this.printf("%s%s:\n", indent, a.Name)
+                for _, an := range v {
+                    this.printf("%s  %s\n", indent, an)
+                }
+            case [][]*Annotation:
+                this.printf("%s%s:\n", indent, a.Name)
+                for i, params := range v {
+                    for _, an := range params {
+                        this.printf("%s  parameter %d: %s\n", indent, i, an)
+                    }
+                }
+            case *ElementValue:
+                this.printf("%s%s: %s\n", indent, a.Name, v)
+            default:
+                switch a.Name {
+                    case "Deprecated", "Synthetic":
+                        this.printf("%s%s: true\n", indent, a.Name)
+                    default:
+                        this.printf("%s%s: length = %d\n", indent, a.Name, len(a.Info))
+                }
+        }
+    }
+}
+
+func types(ts []VerificationType) string {
+    s := []string{}
+    for _, t := range ts {
+        s = append(s, t.String())
+    }
+    return "[" + strings.Join(s, ", ") + "]"
+}
@@ -0,0 +1,90 @@
+package classfile_test
+
+import "testing"
+import "bytes"
+import "strings"
+import "strconv"
+import "fmt"
+import . "classfile"
+
+// the listing of cf as read back from its bytes
+func disassemble(t *testing.T, cf *ClassFile) string {
+    b, err := cf.Bytes()
+    if err != nil {
+        t.Fatalf("%s", err)
+    }
+    read, err := Parse(b)
+    if err != nil {
+        t.Fatalf("%s", err)
+    }
+    out := new(bytes.Buffer)
+    Disassemble(out, read)
+    return out.String()
+}
+
+func expectLines(t *testing.T, listing string, expect []string) {
+    for _, line := range expect {
+        if !strings.Contains(listing, line + "\n") {
+            t.Fatalf("expect %q in\n%s", line, listing)
+        }
+    }
+}
+
+func TestDisassemble(t *testing.T) {
+    cf := hello()
+    cf.AddField(ACC_PRIVATE | ACC_STATIC | ACC_FINAL, "BIG", "J").SetConstantValue(cf.Pool.Long(1 << 40))
+    cf.Methods[0].Exceptions = []string{"java/io/IOException"}
+    listing := disassemble(t, cf)
+    expectLines(t, listing, []string{
+        "public class Hello extends java.lang.Object",
+        "  flags: (0x0021) ACC_PUBLIC, ACC_SUPER",
+        "  private static final long BIG;",
+        "    ConstantValue: long 1099511627776l",
+        "  public static void main(java.lang.String[]) throws java.io.IOException;",
+        "    flags: (0x0009) ACC_PUBLIC, ACC_STATIC",
+        "      stack=2, locals=1, args_size=1",
+        fmt.Sprintf("         3: %-32s // String Hello", "ldc           #" + strconv.Itoa(cf.Pool.String("Hello"))),
+        "         8: return",
+        "      throws java/io/IOException",
+        "SourceFile: \"Hello.kt\"",
+    })
+    ref := cf.Pool.FieldRef("java/lang/System", "out", "Ljava/io/PrintStream;")
+    if !strings.Contains(listing, "   #" + strconv.Itoa(ref) + " = Fieldref ") {
+        t.Fatalf("no Fieldref #%d in\n%s", ref, listing)
+    }
+}
+
+// static void f(int a) { switch (a) { case 1: case 2: try { ... } catch (Throwable e) {} } }
+func TestDisassembleBranches(t *testing.T) {
+    cf := java7("A")
+    code := cf.AddMethod(ACC_STATIC, "f", "(I)V").NewCode()
+    code.MaxStack, code.MaxLocals = 1, 2
+    start, end, handler, done := code.NewLabel(), code.NewLabel(), code.NewLabel(), code.NewLabel()
+    code.Op(ILOAD_0)
+    code.TableSwitch(done, 1, []*Label{start, start})
+    code.Bind(start)
+    code.Line(3)
+    code.Iinc(0, -2)
+    code.Bind(end)
+    code.Jump(GOTO, done)
+    code.Bind(handler)
+    code.Op(ASTORE_1)
+    code.Bind(done)
+    code.Op(RETURN)
+    code.AddHandler(start, end, handler, "java/lang/Throwable")
+
+    expectLines(t, disassemble(t, cf), []string{
+        "         1: tableswitch   { // 1 to 2",
+        "                       1: 24",
+        "                       2: 24",
+        "                 default: 31",
+        "            }",
+        "        24: iinc          0, -2",
+        "        27: goto          31",
+        "            24    27    30   Class java/lang/Throwable",
+        "        line 3: 24",
+        "      StackMapTable: number_of_entries = 3",
+        "        frame at 30",
+        "          stack = [java/lang/Throwable]",
+    })
+}
@@ -0,0 +1,298 @@
+package classfile
+
+import "os"
+import "math"
+import "strconv"
+
+//
+// Constant is one entry of the constant pool.
+// Data holds the bytes following the tag.
+//
+type Constant struct {
+    Tag  int
+    Data []byte
+}
+
+//
+// ConstantPool hands out indexes for constants, adding each
+// distinct constant once. Long and Double take two slots,
+// the second one is left nil.
+//
+type ConstantPool struct {
+    entries []*Constant     // entries[0] is unused
+    index   map[string]int
+}
+
+func NewConstantPool() *ConstantPool {
+    return &ConstantPool{entries: []*Constant{nil}, index: map[string]int{}}
+}
+
+// number of slots plus one, as written in the class file
+func (this *ConstantPool) Count() int {
+    return len(this.entries)
+}
+
+func (this *ConstantPool) At(i int) *Constant {
+    return this.entries[i]
+}
+
+// entry i, which must have one of the tags given
+func (this *ConstantPool) entry(i int, tags...int) (*Constant, os.Error) {
+    if i > 0 && i < len(this.entries) && this.entries[i] != nil {
+        c := this.entries[i]
+        for _, tag := range tags {
+            if c.Tag == tag { return c, nil }
+        }
+    }
+    return nil, os.NewError("bad constant pool index " + strconv.Itoa(i))
+}
+
+// Utf8At gives the string held by the Utf8 constant at i.
+func (this *ConstantPool) Utf8At(i int) (string, os.Error) {
+    c, err := this.entry(i, CONST_Utf8)
+    if err != nil {
+        return "", err
+    }
+    return DecodeModifiedUtf8(c.Data[2:]), nil
+}
+
+// ClassAt gives the internal name of the Class constant at i.
+func (this *ConstantPool) ClassAt(i int) (string, os.Error) {
+    c, err := this.entry(i, CONST_Class)
+    if err != nil {
+        return "", err
+    }
+    return this.Utf8At(get2(c.Data))
+}
+
+// NameAndTypeAt gives the name and descriptor of the NameAndType constant at i.
+func (this *ConstantPool) NameAndTypeAt(i int) (name, desc string, err os.Error) {
+    c, err := this.entry(i, CONST_NameAndType)
+    if err != nil {
+        return
+    }
+    if name, err = this.Utf8At(get2(c.Data)); err != nil {
+        return
+    }
+    desc, err = this.Utf8At(get2(c.Data[2:]))
+    return
+}
+
+// RefAt gives the class, name and descriptor of the field,
+// method or interface method reference at i.
+func (this *ConstantPool) RefAt(i int) (class, name, desc string, err os.Error) {
+    c, err := this.entry(i, CONST_FieldRef, CONST_MethodRef, CONST_InterfaceMethodRef)
+    if err != nil {
+        return
+    }
+    if class, err = this.ClassAt(get2(c.Data)); err != nil {
+        return
+    }
+    name, desc, err = this.NameAndTypeAt(get2(c.Data[2:]))
+    return
+}
+
+//
+// Value gives the Integer, Float, Long, Double or String constant at i
+// as an int32, a float32, an int64, a float64 or a string.
+//
+func (this *ConstantPool) Value(i int) (interface{}, os.Error) {
+    c, err := this.entry(i, CONST_Integer, CONST_Float, CONST_Long, CONST_Double, CONST_String)
+    if err != nil {
+        return nil, err
+    }
+    switch c.Tag {
+        case CONST_Integer:
+            return int32(get4(c.Data)), nil
+        case CONST_Float:
+            return math.Float32frombits(uint32(get4(c.Data))), nil
+        case CONST_Long:
+            return int64(get8(c.Data)), nil
+        case CONST_Double:
+            return math.Float64frombits(get8(c.Data)), nil
+    }
+    return this.Utf8At(get2(c.Data))
+}
+
+//
+// key gives the key the constant at i was added with, so that a pool
+// read from a class file shares its constants with those added later.
+// It checks the constants that i refers to along the way.
+//
+func (this *ConstantPool) key(i int) (string, os.Error) {
+    c := this.entries[i]
+    var err os.Error
+    var s, name, desc string
+    switch c.Tag {
+        case CONST_Utf8:
+            if 2 + get2(c.Data) != len(c.Data) { break }
+            s, err = this.Utf8At(i)
+            return "U" + s, err
+        case CONST_Class:
+            s, err = this.ClassAt(i)
+            return "C" + s, err
+        case CONST_String:
+            s, err = this.Utf8At(get2(c.Data))
+            return "S" + s, err
+        case CONST_Integer:
+            return "I" + strconv.Itoa(get4(c.Data)), nil
+        case CONST_Float:
+            return "F" + strconv.Uitoa64(uint64(uint32(get4(c.Data)))), nil
+        case CONST_Long:
+            return "J" + strconv.Itoa64(int64(get8(c.Data))), nil
+        case CONST_Double:
+            return "D" + strconv.Uitoa64(get8(c.Data)), nil
+        case CONST_NameAndType:
+            name, desc, err = this.NameAndTypeAt(i)
+            return "N" + name + " " + desc, err
+        case CONST_FieldRef, CONST_MethodRef, CONST_InterfaceMethodRef:
+            s, name, desc, err = this.RefAt(i)
+            kind := map[int]string{CONST_FieldRef: "f", CONST_MethodRef: "m", CONST_InterfaceMethodRef: "i"}[c.Tag]
+            return kind + s + "." + name + " " + desc, err
+        default:
+            return "#" + strconv.Itoa(c.Tag) + string(c.Data), nil
+    }
+    return "", os.NewError("bad constant pool entry " + strconv.Itoa(i))
+}
+
+func (this *ConstantPool) add(key string, tag int, data []byte) int {
+    if i, exists := this.index[key]; exists {
+        return i
+    }
+    i := len(this.entries)
+    this.entries = append(this.entries, &Constant{Tag: tag, Data: data})
+    if tag == CONST_Long || tag == CONST_Double {
+        this.entries = append(this.entries, nil)
+    }
+    this.index[key] = i
+    return i
+}
+
+func (this *ConstantPool) Utf8(s string) int {
+    b := ModifiedUtf8(s)
+    data := make([]byte, 2, 2 + len(b))
+    put2(data, len(b))
+    return this.add("U" + s, CONST_Utf8, append(data, b...))
+}
+
+// name is an internal name such as java/lang/Object
+func (this *ConstantPool) Class(name string) int {
+    return this.add("C" + name, CONST_Class, u2(this.Utf8(name)))
+}
+
+func (this *ConstantPool) String(s string) int {
+    return this.add("S" + s, CONST_String, u2(this.Utf8(s)))
+}
+
+func (this *ConstantPool) Integer(v int32) int {
+    return this.add("I" + strconv.Itoa(int(v)), CONST_Integer, u4(uint32(v)))
+}
+
+// keyed by bits, so that 0.0 and -0.0 stay apart
+func (this *ConstantPool) Float(v float32) int {
+    bits := math.Float32bits(v)
+    return this.add("F" + strconv.Uitoa64(uint64(bits)), CONST_Float, u4(bits))
+}
+
+func (this *ConstantPool) Long(v int64) int {
+    return this.add("J" + strconv.Itoa64(v), CONST_Long, u8(uint64(v)))
+}
+
+func (this *ConstantPool) Double(v float64) int {
+    bits := math.Float64bits(v)
+    return this.add("D" + strconv.Uitoa64(bits), CONST_Double, u8(bits))
+}
+
+func (this *ConstantPool) NameAndType(name, desc string) int {
+    n, d := this.Utf8(name), this.Utf8(desc)
+    return this.add("N" + name + " " + desc, CONST_NameAndType, append(u2(n), u2(d)...))
+}
+
+func (this *ConstantPool) FieldRef(class, name, desc string) int {
+    return this.ref("f", CONST_FieldRef, class, name, desc)
+}
+
+func (this *ConstantPool) MethodRef(class, name, desc string) int {
+    return this.ref("m", CONST_MethodRef, class, name, desc)
+}
+
+func (this *ConstantPool) InterfaceMethodRef(class, name, desc string) int {
+    return this.ref("i", CONST_InterfaceMethodRef, class, name, desc)
+}
+
+func (this *ConstantPool) ref(kind string, tag int, class, name, desc string) int {
+    c, nt := this.Class(class), this.NameAndType(name, desc)
+    return this.add(kind + class + "." + name + " " + desc, tag, append(u2(c), u2(nt)...))
+}
+
+func (this *ConstantPool) write(out *buffer) os.Error {
+    if len(this.entries) > 0xFFFF {
+        return os.NewError("too many constants: " + strconv.Itoa(len(this.entries)-1))
+    }
+    out.u2(len(this.entries))
+    for _, c := range this.entries {
+        if c == nil { continue }
+        if c.Tag == CONST_Utf8 && len(c.Data) - 2 > 0xFFFF {
+            return os.NewError("string constant too long")
+        }
+        out.u1(c.Tag)
+        out.write(c.Data)
+    }
+    return nil
+}
+
+//
+// ModifiedUtf8 encodes s the way class files store strings:
+// NUL takes two bytes and characters above U+FFFF are written
+// as a surrogate pair of three bytes each.
+//
+func ModifiedUtf8(s string) []byte {
+    b := make([]byte, 0, len(s))
+    for _, ch := range s {
+        switch {
+            case ch != 0 && ch < 0x80:
+                b = append(b, byte(ch))
+            case ch < 0x800:
+                b = append(b, byte(0xC0 | ch >> 6), byte(0x80 | ch & 0x3F))
+            case ch < 0x10000:
+                b = append3(b, ch)
+            default:
+                ch -= 0x10000
+                b = append3(b, 0xD800 + ch >> 10)
+                b = append3(b, 0xDC00 + ch & 0x3FF)
+        }
+    }
+    return b
+}
+
+func append3(b []byte, ch int) []byte {
+    return append(b, byte(0xE0 | ch >> 12), byte(0x80 | ch >> 6 & 0x3F), byte(0x80 | ch & 0x3F))
+}
+
+// DecodeModifiedUtf8 is the inverse of ModifiedUtf8.
+func DecodeModifiedUtf8(b []byte) string {
+    chars := make([]int, 0, len(b))
+    for i := 0; i < len(b); {
+        ch := int(b[i])
+        switch {
+            case ch < 0x80:
+                i++
+            case ch & 0xE0 == 0xC0 && i+1 < len(b):
+                ch = (ch & 0x1F) << 6 | int(b[i+1]) & 0x3F
+                i += 2
+            case ch & 0xF0 == 0xE0 && i+2 < len(b):
+                ch = (ch & 0x0F) << 12 | (int(b[i+1]) & 0x3F) << 6 | int(b[i+2]) & 0x3F
+                i += 3
+            default:
+                ch = 0xFFFD
+                i++
+        }
+        // the low half of a surrogate pair
+        if n := len(chars); n > 0 && ch >= 0xDC00 && ch <= 0xDFFF && chars[n-1] >= 0xD800 && chars[n-1] <= 0xDBFF {
+            chars[n-1] = 0x10000 + (chars[n-1] - 0xD800) << 10 + ch - 0xDC00
+            continue
+        }
+        chars = append(chars, ch)
+    }
+    return string(chars)
+}
@@ -0,0 +1,56 @@
+package classfile_test
+
+import "testing"
+import "bytes"
+import "classfile"
+
+func TestConstantsAreShared(t *testing.T) {
+    p := classfile.NewConstantPool()
+    m1 := p.MethodRef("java/io/PrintStream", "println", "(Ljava/lang/String;)V")
+    m2 := p.MethodRef("java/io/PrintStream", "println", "(Ljava/lang/String;)V")
+    if m1 != m2 {
+        t.Fatalf("method ref added twice: %d %d", m1, m2)
+    }
+    // Utf8, Class, Utf8, Utf8, NameAndType, MethodRef
+    if p.Count() != 7 {
+        t.Fatalf("expect 6 constants, found %d", p.Count()-1)
+    }
+    if p.String("x") == p.Utf8("x") {
+        t.Fatalf("String and Utf8 share an index")
+    }
+    if p.Integer(1) == p.Float(1) || p.Long(1) == p.Double(1) {
+        t.Fatalf("numbers of different types share an index")
+    }
+}
+
+func TestLongTakesTwoSlots(t *testing.T) {
+    p := classfile.NewConstantPool()
+    l := p.Long(1)
+    i := p.Integer(1)
+    if l != 1 || i != 3 || p.At(2) != nil {
+        t.Fatalf("long at %d, int at %d", l, i)
+    }
+    if c := p.At(l); c.Tag != classfile.CONST_Long || !bytes.Equal(c.Data, []byte{0, 0, 0, 0, 0, 0, 0, 1}) {
+        t.Fatalf("wrong long constant %v", c)
+    }
+}
+
+func TestModifiedUtf8(t *testing.T) {
+    expect := []struct {
+        s string
+        b []byte
+    }{
+        {"a",         []byte{'a'}},
+        {"\x00",      []byte{0xC0, 0x80}},
+        {"ก",         []byte{0xE0, 0xB8, 0x81}},
+        {"\U0001F600", []byte{0xED, 0xA0, 0xBD, 0xED, 0xB8, 0x80}},
+    }
+    for _, e := range expect {
+        if b := classfile.ModifiedUtf8(e.s); !bytes.Equal(b, e.b) {
+            t.Fatalf("%q: found % x", e.s, b)
+        }
+        if s := classfile.DecodeModifiedUtf8(e.b); s != e.s {
+            t.Fatalf("% x: decoded as %q", e.b, s)
+        }
+    }
+}
@@ -0,0 +1,414 @@
+package classfile
+
+import "os"
+import "fmt"
+import "io/ioutil"
+
+//
+// classReader decodes big-endian input. Reading past the end or
+// finding something malformed raises a formatError, which Parse
+// returns, prefixed with where it was found.
+//
+type classReader struct {
+    b       []byte
+    at      int
+    where   string      // "method f()V: Code attribute: "
+    cf      *ClassFile
+}
+
+type formatError struct {
+    err os.Error
+}
+
+func (this *classReader) fail(format string, args...interface{}) {
+    panic(formatError{os.NewError(this.where + fmt.Sprintf(format, args...))})
+}
+
+func (this *classReader) check(err os.Error) {
+    if err != nil { this.fail("%s", err.String()) }
+}
+
+func (this *classReader) bytes(n int) []byte {
+    if n < 0 || this.at + n > len(this.b) { this.fail("truncated") }
+    this.at += n
+    return this.b[this.at-n:this.at]
+}
+
+func (this *classReader) u1() int {
+    return int(this.bytes(1)[0])
+}
+
+func (this *classReader) u2() int {
+    return get2(this.bytes(2))
+}
+
+func (this *classReader) u4() int {
+    return get4(this.bytes(4))
+}
+
+func (this *classReader) utf8() string {
+    s, err := this.cf.Pool.Utf8At(this.u2())
+    this.check(err)
+    return s
+}
+
+func (this *classReader) class() string {
+    s, err := this.cf.Pool.ClassAt(this.u2())
+    this.check(err)
+    return s
+}
+
+// a Class constant, or "" for index 0
+func (this *classReader) optionalClass() string {
+    i := this.u2()
+    if i == 0 { return "" }
+    s, err := this.cf.Pool.ClassAt(i)
+    this.check(err)
+    return s
+}
+
+// a reader of info, which must be read up to its end
+func (this *classReader) sub(info []byte, name string) *classReader {
+    return &classReader{b: info, where: this.where + name + " attribute: ", cf: this.cf}
+}
+
+func (this *classReader) end() {
+    if this.at != len(this.b) { this.fail("%d bytes left over", len(this.b) - this.at) }
+}
+
+//
+// Parse decodes a class file, checking every constant pool reference
+// it follows. The attributes it knows are decoded into their Value,
+// see attributes.go.
+//
+func Parse(b []byte) (cf *ClassFile, err os.Error) {
+    cf = &ClassFile{Pool: NewConstantPool()}
+    this := &classReader{b: b, cf: cf}
+    defer func() {
+        if e := recover(); e != nil {
+            fe, ok := e.(formatError)
+            if !ok { panic(e) }
+            cf, err = nil, fe.err
+        }
+    }()
+    if uint32(this.u4()) != MAGIC { this.fail("not a class file") }
+    cf.Minor = this.u2()
+    cf.Major = this.u2()
+    this.constantPool()
+    cf.Access = this.u2()
+    cf.Name = this.class()
+    cf.Super = this.optionalClass()
+    for n := this.u2(); n > 0; n-- {
+        cf.AddInterface(this.class())
+    }
+    for n := this.u2(); n > 0; n-- {
+        f := &Field{Access: this.u2(), Name: this.utf8(), Desc: this.utf8()}
+        this.where = "field " + f.Name + ": "
+        f.Attributes = this.attributes(nil)
+        cf.Fields = append(cf.Fields, f)
+    }
+    for n := this.u2(); n > 0; n-- {
+        m := &Method{Access: this.u2(), Name: this.utf8(), Desc: this.utf8()}
+        this.where = "method " + m.Name + m.Desc + ": "
+        m.Attributes = this.attributes(m)
+        cf.Methods = append(cf.Methods, m)
+    }
+    this.where = ""
+    cf.Attributes = this.attributes(nil)
+    this.end()
+    return cf, nil
+}
+
+func ReadFile(path string) (*ClassFile, os.Error) {
+    b, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    cf, err := Parse(b)
+    if err != nil {
+        return nil, os.NewError(path + ": " + err.String())
+    }
+    return cf, nil
+}
+
+//
+// constantPool reads the constants as they are, Long and Double
+// taking two slots, then checks them and indexes them as if they
+// had been added one by one.
+//
+func (this *classReader) constantPool() {
+    pool := this.cf.Pool
+    count := this.u2()
+    if count == 0 { this.fail("empty constant pool") }
+    for i := 1; i < count; i++ {
+        tag := this.u1()
+        n := 0
+        switch tag {
+            case CONST_Utf8:
+                n = 2 + this.u2()
+                this.at -= 2
+            case CONST_Class, CONST_String, CONST_MethodType, CONST_Module, CONST_Package:
+                n = 2
+            case CONST_MethodHandle:
+                n = 3
+            case CONST_Integer, CONST_Float, CONST_FieldRef, CONST_MethodRef, CONST_InterfaceMethodRef,
+                 CONST_NameAndType, CONST_Dynamic, CONST_InvokeDynamic:
+                n = 4
+            case CONST_Long, CONST_Double:
+                n = 8
+            default:
+                this.fail("unknown constant tag %d at %d", tag, i)
+        }
+        pool.entries = append(pool.entries, &Constant{Tag: tag, Data: this.bytes(n)})
+        if tag == CONST_Long || tag == CONST_Double {
+            if i++; i == count { this.fail("%d takes two slots, past the end of the pool", i-1) }
+            pool.entries = append(pool.entries, nil)
+        }
+    }
+    for i, c := range pool.entries {
+        if c == nil { continue }
+        key, err := pool.key(i)
+        this.check(err)
+        if _, exists := pool.index[key]; !exists {
+            pool.index[key] = i
+        }
+    }
+}
+
+// the attributes of m, of a field or of the class when m is nil
+func (this *classReader) attributes(m *Method) []*Attribute {
+    attrs := []*Attribute{}
+    for n := this.u2(); n > 0; n-- {
+        a := &Attribute{Name: this.utf8()}
+        a.Info = this.bytes(this.u4())
+        r := this.sub(a.Info, a.Name)
+        switch a.Name {
+            case "Code":
+                if m == nil { break }
+                if m.Code != nil { r.fail("more than one") }
+                m.Code = r.code(m)
+                continue
+            case "Exceptions":
+                if m == nil { break }
+                for k := r.u2(); k > 0; k-- {
+                    m.Exceptions = append(m.Exceptions, r.class())
+                }
+                r.end()
+                continue
+        }
+        a.Value = r.decode(a.Name)
+        attrs = append(attrs, a)
+    }
+    return attrs
+}
+
+func (this *classReader) code(m *Method) *Code {
+    c := &Code{MaxStack: this.u2(), MaxLocals: this.u2()}
+    n := this.u4()
+    if n <= 0 || n > 0xFFFF { this.fail("code length out of range: %d", n) }
+    c.code.b = append([]byte{}, this.bytes(n)...)
+    for k := this.u2(); k > 0; k-- {
+        start, end, target := this.u2(), this.u2(), this.u2()
+        if start >= end || end > n || target >= n { this.fail("bad exception handler %d-%d -> %d", start, end, target) }
+        h := &Handler{Start: &Label{offset: start}, End: &Label{offset: end}, Target: &Label{offset: target}}
+        h.CatchType = this.optionalClass()
+        c.Handlers = append(c.Handlers, h)
+    }
+    for k := this.u2(); k > 0; k-- {
+        a := &Attribute{Name: this.utf8()}
+        a.Info = this.bytes(this.u4())
+        r := this.sub(a.Info, a.Name)
+        switch a.Name {
+            case "LineNumberTable":
+                for _, l := range r.decode(a.Name).([]LineNumber) {
+                    if l.StartPC >= n { r.fail("line %d at pc %d past the code", l.Line, l.StartPC) }
+                    c.lines = append(c.lines, l.StartPC, l.Line)
+                }
+                continue
+            case "StackMapTable":
+                a.Value = r.stackMapTable(m)
+            default:
+                a.Value = r.decode(a.Name)
+        }
+        c.Attributes = append(c.Attributes, a)
+    }
+    this.end()
+    return c
+}
+
+// decode gives the Value of a standard attribute
+func (this *classReader) decode(name string) (value interface{}) {
+    pool := this.cf.Pool
+    switch name {
+        case "SourceFile", "Signature":
+            value = this.utf8()
+        case "ConstantValue":
+            v, err := pool.Value(this.u2())
+            this.check(err)
+            value = v
+        case "LineNumberTable":
+            lines := []LineNumber{}
+            for k := this.u2(); k > 0; k-- {
+                lines = append(lines, LineNumber{StartPC: this.u2(), Line: this.u2()})
+            }
+            value = lines
+        case "LocalVariableTable", "LocalVariableTypeTable":
+            vars := []LocalVariable{}
+            for k := this.u2(); k > 0; k-- {
+                vars = append(vars, LocalVariable{StartPC: this.u2(), Length: this.u2(), Name: this.utf8(), Desc: this.utf8(), Index: this.u2()})
+            }
+            value = vars
+        case "InnerClasses":
+            classes := []InnerClass{}
+            for k := this.u2(); k > 0; k-- {
+                c := InnerClass{Inner: this.class(), Outer: this.optionalClass()}
+                if i := this.u2(); i != 0 {
+                    s, err := pool.Utf8At(i)
+                    this.check(err)
+                    c.Name = s
+                }
+                c.Access = this.u2()
+                classes = append(classes, c)
+            }
+            value = classes
+        case "EnclosingMethod":
+            e := &EnclosingMethod{Class: this.class()}
+            if i := this.u2(); i != 0 {
+                var err os.Error
+                e.Name, e.Desc, err = pool.NameAndTypeAt(i)
+                this.check(err)
+            }
+            value = e
+        case "RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations":
+            value = this.annotations()
+        case "RuntimeVisibleParameterAnnotations", "RuntimeInvisibleParameterAnnotations":
+            params := [][]*Annotation{}
+            for k := this.u1(); k > 0; k-- {
+                params = append(params, this.annotations())
+            }
+            value = params
+        case "AnnotationDefault":
+            value = this.elementValue()
+        case "Deprecated", "Synthetic":
+        default:
+            return nil  // not ours to check
+    }
+    this.end()
+    return value
+}
+
+func (this *classReader) annotations() []*Annotation {
+    r := []*Annotation{}
+    for k := this.u2(); k > 0; k-- {
+        r = append(r, this.annotation())
+    }
+    return r
+}
+
+func (this *classReader) annotation() *Annotation {
+    a := &Annotation{Type: this.utf8()}
+    for k := this.u2(); k > 0; k-- {
+        a.Elements = append(a.Elements, &ElementPair{Name: this.utf8(), Value: this.elementValue()})
+    }
+    return a
+}
+
+// the constant tags each element value tag takes
+var elementConstants = map[byte]int{
+    'B': CONST_Integer, 'C': CONST_Integer, 'I': CONST_Integer, 'S': CONST_Integer, 'Z': CONST_Integer,
+    'D': CONST_Double, 'F': CONST_Float, 'J': CONST_Long,
+}
+
+func (this *classReader) elementValue() *ElementValue {
+    v := &ElementValue{Tag: byte(this.u1())}
+    switch v.Tag {
+        case 's':
+            v.Const = this.utf8()
+        case 'e':
+            v.Type, v.Name = this.utf8(), this.utf8()
+        case 'c':
+            v.Type = this.utf8()
+        case '@':
+            v.Annotation = this.annotation()
+        case '[':
+            for k := this.u2(); k > 0; k-- {
+                v.Values = append(v.Values, this.elementValue())
+            }
+        default:
+            tag, exists := elementConstants[v.Tag]
+            if !exists { this.fail("bad element value tag '%c'", v.Tag) }
+            i := this.u2()
+            _, err := this.cf.Pool.entry(i, tag)
+            this.check(err)
+            v.Const, err = this.cf.Pool.Value(i)
+            this.check(err)
+    }
+    return v
+}
+
+//
+// stackMapTable decodes the frames of m into full frames at their
+// offsets, each one from the frame before it.
+//
+func (this *classReader) stackMapTable(m *Method) []*Frame {
+    s, err := entryState(this.cf, m)
+    this.check(err)
+    prev := s.frame(-1)
+    frames := []*Frame{}
+    for k := this.u2(); k > 0; k-- {
+        kind := this.u1()
+        f := &Frame{Locals: prev.Locals}
+        delta := kind
+        switch {
+            case kind < 64:
+            case kind < 128:
+                delta = kind - 64
+                f.Stack = []VerificationType{this.verificationType()}
+            case kind < 247:
+                this.fail("reserved frame type %d", kind)
+            case kind == 247:
+                delta = this.u2()
+                f.Stack = []VerificationType{this.verificationType()}
+            case kind < 251:
+                delta = this.u2()
+                n := len(prev.Locals) - (251 - kind)
+                if n < 0 { this.fail("chopping %d locals out of %d", 251 - kind, len(prev.Locals)) }
+                f.Locals = prev.Locals[0:n]
+            case kind == 251:
+                delta = this.u2()
+            case kind < 255:
+                delta = this.u2()
+                f.Locals = append([]VerificationType{}, prev.Locals...)
+                for i := 251; i < kind; i++ {
+                    f.Locals = append(f.Locals, this.verificationType())
+                }
+            default:
+                delta = this.u2()
+                f.Locals = []VerificationType{}
+                for i := this.u2(); i > 0; i-- {
+                    f.Locals = append(f.Locals, this.verificationType())
+                }
+                for i := this.u2(); i > 0; i-- {
+                    f.Stack = append(f.Stack, this.verificationType())
+                }
+        }
+        f.Offset = prev.Offset + delta + 1
+        frames = append(frames, f)
+        prev = f
+    }
+    this.end()
+    return frames
+}
+
+func (this *classReader) verificationType() VerificationType {
+    t := VerificationType{Tag: this.u1()}
+    switch {
+        case t.Tag == ITEM_Object:
+            t.Class = this.class()
+        case t.Tag == ITEM_Uninitialized:
+            t.Offset = this.u2()
+        case t.Tag > ITEM_Uninitialized:
+            this.fail("bad verification type %d", t.Tag)
+    }
+    return t
+}
@@ -0,0 +1,131 @@
+package classfile_test
+
+import "testing"
+import "bytes"
+import "strings"
+import . "classfile"
+
+// writes cf, reads it back and checks it writes the same bytes again
+func readBack(t *testing.T, cf *ClassFile) *ClassFile {
+    b, err := cf.Bytes()
+    if err != nil {
+        t.Fatalf("%s", err)
+    }
+    read, err := Parse(b)
+    if err != nil {
+        t.Fatalf("%s", err)
+    }
+    again, err := read.Bytes()
+    if err != nil {
+        t.Fatalf("%s", err)
+    }
+    if !bytes.Equal(b, again) {
+        t.Fatalf("read % x\nwrote % x", b, again)
+    }
+    return read
+}
+
+func TestReadBack(t *testing.T) {
+    cf := hello()
+    cf.AddInterface("java/io/Serializable")
+    cf.AddField(ACC_STATIC | ACC_FINAL, "BIG", "J").SetConstantValue(cf.Pool.Long(1 << 40))
+    m := cf.Methods[0]
+    m.Exceptions = []string{"java/io/IOException"}
+    code := cf.AddMethod(ACC_STATIC, "f", "()V").NewCode()
+    code.MaxStack, code.MaxLocals = 0, 0
+    code.Line(3)
+    code.Op(RETURN)
+
+    read := readBack(t, cf)
+    if read.Name != "Hello" || read.Super != "java/lang/Object" || len(read.Interfaces) != 1 {
+        t.Fatalf("wrong class %s extends %s implements %v", read.Name, read.Super, read.Interfaces)
+    }
+    if f := read.Fields[0]; f.Name != "BIG" || f.Attributes[0].Value != int64(1 << 40) {
+        t.Fatalf("wrong field %s = %v", f.Name, f.Attributes[0].Value)
+    }
+    m = read.Methods[0]
+    if m.Name != "main" || len(m.Exceptions) != 1 || !bytes.Equal(m.Code.Bytes(), cf.Methods[0].Code.Bytes()) {
+        t.Fatalf("wrong method %s%s throws %v", m.Name, m.Desc, m.Exceptions)
+    }
+    if lines := read.Methods[1].Code.Lines(); len(lines) != 1 || lines[0].Line != 3 {
+        t.Fatalf("wrong lines %v", lines)
+    }
+    if read.Attributes[0].Value != "Hello.kt" {
+        t.Fatalf("wrong source file %v", read.Attributes[0].Value)
+    }
+    // the constants read are shared with those added later
+    if read.Pool.String("Hello") != cf.Pool.String("Hello") {
+        t.Fatalf("String constant added again")
+    }
+}
+
+func TestReadFrames(t *testing.T) {
+    cf := java7("A")
+    code := cf.AddMethod(ACC_STATIC, "f", "(I)V").NewCode()
+    code.MaxStack, code.MaxLocals = 1, 2
+    other, join := code.NewLabel(), code.NewLabel()
+    code.Op(ILOAD_0)
+    code.Jump(IFEQ, other)
+    code.Op1(LDC, cf.Pool.String("x"))
+    code.Jump(GOTO, join)
+    code.Bind(other)
+    code.Op(ACONST_NULL)
+    code.Bind(join)
+    code.Op(ASTORE_1)
+    code.Op(RETURN)
+
+    read := readBack(t, cf)
+    frames := read.Methods[0].Code.Attributes[0].Value.([]*Frame)
+    if len(frames) != 2 || frames[0].Offset != 9 || frames[1].Offset != 10 {
+        t.Fatalf("wrong frames %v", frames)
+    }
+    if s := frames[1].Stack; len(s) != 1 || s[0].Class != "java/lang/String" || len(frames[1].Locals) != 1 {
+        t.Fatalf("wrong frame at 10: locals %v, stack %v", frames[1].Locals, s)
+    }
+}
+
+func TestReadAnnotations(t *testing.T) {
+    cf := hello()
+    p := cf.Pool
+    u2 := func(i int) []byte { return []byte{byte(i >> 8), byte(i)} }
+    // @Retention(RetentionPolicy.RUNTIME) @Values({1, 2})
+    info := []byte{0, 2}
+    info = append(info, u2(p.Utf8("Ljava/lang/annotation/Retention;"))...)
+    info = append(info, 0, 1)
+    info = append(info, u2(p.Utf8("value"))...)
+    info = append(info, 'e')
+    info = append(info, u2(p.Utf8("Ljava/lang/annotation/RetentionPolicy;"))...)
+    info = append(info, u2(p.Utf8("RUNTIME"))...)
+    info = append(info, u2(p.Utf8("LValues;"))...)
+    info = append(info, 0, 1)
+    info = append(info, u2(p.Utf8("value"))...)
+    info = append(info, '[', 0, 2, 'I')
+    info = append(info, u2(p.Integer(1))...)
+    info = append(info, 'I')
+    info = append(info, u2(p.Integer(2))...)
+    p.Utf8("RuntimeVisibleAnnotations")
+    cf.Attributes = append(cf.Attributes, &Attribute{Name: "RuntimeVisibleAnnotations", Info: info})
+
+    read := readBack(t, cf)
+    a := read.Attributes[1].Value.([]*Annotation)
+    expect := "@Ljava/lang/annotation/Retention;(value=Ljava/lang/annotation/RetentionPolicy;.RUNTIME) " +
+              "@LValues;(value={1, 2})"
+    if len(a) != 2 || a[0].String() + " " + a[1].String() != expect {
+        t.Fatalf("wrong annotations %v", a)
+    }
+}
+
+func TestReadErrors(t *testing.T) {
+    b, _ := hello().Bytes()
+    long := []byte{0xCA, 0xFE, 0xBA, 0xBE, 0, 0, 0, JAVA_6, 0, 2, CONST_Long, 0, 0, 0, 0, 0, 0, 0, 1}
+    for _, test := range []struct{ b []byte; err string }{
+        {b[1:], "not a class file"},
+        {b[0:len(b)-1], "truncated"},
+        {append(append([]byte{}, b...), 0), "1 bytes left over"},
+        {long, "1 takes two slots, past the end of the pool"},
+    } {
+        if _, err := Parse(test.b); err == nil || !strings.HasSuffix(err.String(), test.err) {
+            t.Fatalf("expect %s, found %v", test.err, err)
+        }
+    }
+}
@@ -0,0 +1,502 @@
+package codegen_test
+
+import "testing"
+import "bytes"
+import "fmt"
+import "classfile"
+import "codegen"
+import "compiler"
+
+func generate(t *testing.T, src string) ([]*classfile.ClassFile, []*compiler.Diagnostic) {
+    unit, diags := compiler.ParseFile("A.kt", src)
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    return codegen.Generate("A.kt", compiler.DesugarCaseClasses(unit))
+}
+
+func method(t *testing.T, cf *classfile.ClassFile, name string) *classfile.Method {
+    for _, m := range cf.Methods {
+        if m.Name == name { return m }
+    }
+    t.Fatalf("no method %s in %s", name, cf.Name)
+    return nil
+}
+
+func TestHelloMain(t *testing.T) {
+    classes, diags := generate(t,
+    "package demo\n"               +
+    "class Hello {\n"              +
+    "  static main(args) {\n"      +
+    "    println(\"Hello\")\n"     +
+    "  }\n"                        +
+    "}\n"                          )
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    cf := classes[0]
+    if cf.Name != "demo/Hello" || cf.Super != "java/lang/Object" {
+        t.Fatalf("wrong class %s extends %s", cf.Name, cf.Super)
+    }
+    m := method(t, cf, "main")
+    if m.Desc != "([Ljava/lang/String;)V" || m.Access != classfile.ACC_PUBLIC | classfile.ACC_STATIC {
+        t.Fatalf("wrong entry point %x %s", m.Access, m.Desc)
+    }
+    out := cf.Pool.FieldRef("java/lang/System", "out", "Ljava/io/PrintStream;")
+    println := cf.Pool.MethodRef("java/io/PrintStream", "println", "(Ljava/lang/String;)V")
+    code := []byte{
+        classfile.GETSTATIC, byte(out >> 8), byte(out),
+        classfile.LDC, byte(cf.Pool.String("Hello")),
+        classfile.INVOKEVIRTUAL, byte(println >> 8), byte(println),
+        classfile.RETURN,
+    }
+    if !bytes.Equal(m.Code.Bytes(), code) {
+        t.Fatalf("wrong code % x", m.Code.Bytes())
+    }
+    if m.Code.MaxStack != 2 || m.Code.MaxLocals != 1 {
+        t.Fatalf("wrong max stack %d, max locals %d", m.Code.MaxStack, m.Code.MaxLocals)
+    }
+    // a default constructor calling super()
+    if init := method(t, cf, "<init>"); init.Code.Bytes()[0] != classfile.ALOAD_0 {
+        t.Fatalf("wrong constructor % x", init.Code.Bytes())
+    }
+    if _, err := cf.Bytes(); err != nil {
+        t.Fatalf("%s", err)
+    }
+}
+
+func TestLocalSlots(t *testing.T) {
+    classes, diags := generate(t,
+    "class A {\n"                  +
+    "  static long f(int a) {\n"   +
+    "    long b = a\n"             +
+    "    double c = 1.5\n"         +
+    "    int d = 2\n"              +
+    "    return b + d\n"           +
+    "  }\n"                        +
+    "}\n"                          )
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    code := method(t, classes[0], "f").Code
+    // a in 0, b in 1-2, c in 3-4, d in 5
+    if code.MaxLocals != 6 {
+        t.Fatalf("expect 6 locals, found %d", code.MaxLocals)
+    }
+    // b + d: lload_1, iload 5, i2l, ladd
+    b := code.Bytes()
+    tail := []byte{classfile.LLOAD_1, classfile.ILOAD, 5, classfile.I2L, classfile.LADD, classfile.LRETURN}
+    if !bytes.HasSuffix(b, tail) || code.MaxStack != 4 {
+        t.Fatalf("wrong code % x, max stack %d", b, code.MaxStack)
+    }
+}
+
+func TestBranches(t *testing.T) {
+    classes, _ := generate(t,
+    "class A {\n"                  +
+    "  int abs(int x) {\n"         +
+    "    if (x < 0) {\n"           +
+    "      return -x\n"            +
+    "    }\n"                      +
+    "    return x\n"               +
+    "  }\n"                        +
+    "}\n"                          )
+    cf := classes[0]
+    if _, err := cf.Bytes(); err != nil {  // patches the jumps
+        t.Fatalf("%s", err)
+    }
+    code := []byte{
+        classfile.ILOAD_1, classfile.IFGE, 0, 6,
+        classfile.ILOAD_1, classfile.INEG, classfile.IRETURN,
+        classfile.ILOAD_1, classfile.IRETURN,
+    }
+    if b := method(t, cf, "abs").Code.Bytes(); !bytes.Equal(b, code) {
+        t.Fatalf("wrong code % x", b)
+    }
+}
+
+func TestDiagnostics(t *testing.T) {
+    _, diags := generate(t,
+    "class A {\n"                  +
+    "  int f() {\n"                +
+    "    g(y)\n"                   +
+    "  }\n"                        +
+    "  int h()\n"                  +
+    "}\n"                          )
+    expect := []string{
+        "A.kt:3:7: error K0016: cannot find symbol y",
+        "A.kt:2:3: error K0019: missing return statement",
+        "A.kt:5:3: error K0020: method h has no body",
+    }
+    if len(diags) != len(expect) {
+        t.Fatalf("expect %d diagnostics, found %d: %v", len(expect), len(diags), diags)
+    }
+    for i, d := range diags {
+        if d.String() != expect[i] {
+            t.Fatalf("expect %s, found %s", expect[i], d)
+        }
+    }
+}
+
+// named arguments are bound once the class of the target is known
+func TestNamedArguments(t *testing.T) {
+    classes, diags := generate(t,
+    "case class Point(int x, int y = 0)\n" +
+    "class A {\n"                          +
+    "  static f(Point p, java.util.Map m) {\n" +
+    "    p.copy(y = 1)\n"                  +
+    "    m.get(\"k\")\n"                   +
+    "  }\n"                                +
+    "}\n"                                  )
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    cf := classes[1]
+    getX := cf.Pool.MethodRef("Point", "getX", "()I")
+    copy := cf.Pool.MethodRef("Point", "copy", "(II)LPoint;")
+    get := cf.Pool.InterfaceMethodRef("java/util/Map", "get", "(Ljava/lang/Object;)Ljava/lang/Object;")
+    code := []byte{
+        classfile.ALOAD_0,
+        classfile.ALOAD_0, classfile.INVOKEVIRTUAL, byte(getX >> 8), byte(getX),
+        classfile.ICONST_1,
+        classfile.INVOKEVIRTUAL, byte(copy >> 8), byte(copy),
+        classfile.POP,
+        classfile.ALOAD_1, classfile.LDC, byte(cf.Pool.String("k")),
+        classfile.INVOKEINTERFACE, byte(get >> 8), byte(get), 2, 0,
+        classfile.POP,
+        classfile.RETURN,
+    }
+    if b := method(t, cf, "f").Code.Bytes(); !bytes.Equal(b, code) {
+        t.Fatalf("wrong code % x", b)
+    }
+}
+
+// primitives hash as in Java 7, which has no Long.hashCode(long)
+func TestCaseClassHashCode(t *testing.T) {
+    classes, diags := generate(t, "case class P(long y, boolean b)\n")
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    cf := classes[0]
+    if _, err := cf.Bytes(); err != nil {  // patches the jumps
+        t.Fatalf("%s", err)
+    }
+    y := cf.Pool.FieldRef("P", "y", "J")
+    b := cf.Pool.FieldRef("P", "b", "Z")
+    code := []byte{
+        classfile.BIPUSH, 17, classfile.BIPUSH, 31, classfile.IMUL,
+        classfile.ALOAD_0, classfile.GETFIELD, byte(y >> 8), byte(y),
+        classfile.ALOAD_0, classfile.GETFIELD, byte(y >> 8), byte(y),
+        classfile.BIPUSH, 32, classfile.LUSHR, classfile.LXOR, classfile.L2I,
+        classfile.IADD,
+        classfile.BIPUSH, 31, classfile.IMUL,
+        classfile.ALOAD_0, classfile.GETFIELD, byte(b >> 8), byte(b),
+        classfile.IFEQ, 0, 9,
+        classfile.SIPUSH, 1231 >> 8, 1231 & 0xff,
+        classfile.GOTO, 0, 6,
+        classfile.SIPUSH, 1237 >> 8, 1237 & 0xff,
+        classfile.IADD,
+        classfile.IRETURN,
+    }
+    if c := method(t, cf, "hashCode").Code.Bytes(); !bytes.Equal(c, code) {
+        t.Fatalf("wrong code % x", c)
+    }
+}
+
+// a range is only compiled as the iterable of a for loop
+func TestRangeValue(t *testing.T) {
+    classes, diags := generate(t,
+    "class A {\n"                  +
+    "  static f() {\n"             +
+    "    for (i : 1..<3) {\n"      +
+    "    }\n"                      +
+    "    return 1..<3\n"           +
+    "  }\n"                        +
+    "}\n"                          )
+    if len(diags) != 1 || diags[0].String() != "A.kt:5:12: error K0018: a range used as a value is not supported yet" {
+        t.Fatalf("unexpected %v", diags)
+    }
+    if _, err := classes[0].Bytes(); err != nil {  // patches the jumps
+        t.Fatalf("%s", err)
+    }
+    code := []byte{
+        classfile.ICONST_1, classfile.ISTORE_0,
+        classfile.ICONST_3, classfile.ISTORE_1,
+        classfile.ILOAD_0, classfile.ILOAD_1, classfile.IF_ICMPGE, 0, 9,
+        classfile.IINC, 0, 1,
+        classfile.GOTO, 0xff, 0xf8,
+        classfile.ACONST_NULL, classfile.ARETURN,
+    }
+    if b := method(t, classes[0], "f").Code.Bytes(); !bytes.Equal(b, code) {
+        t.Fatalf("wrong code % x", b)
+    }
+}
+
+// a list literal where a Set is expected is a LinkedHashSet
+func TestSetLiteral(t *testing.T) {
+    classes, diags := generate(t,
+    "class A {\n"                    +
+    "  static f() {\n"               +
+    "    java.util.Set s = [1]\n"    +
+    "  }\n"                          +
+    "}\n"                            )
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    cf := classes[0]
+    set := cf.Pool.Class("java/util/LinkedHashSet")
+    init := cf.Pool.MethodRef("java/util/LinkedHashSet", "<init>", "()V")
+    valueOf := cf.Pool.MethodRef("java/lang/Integer", "valueOf", "(I)Ljava/lang/Integer;")
+    add := cf.Pool.MethodRef("java/util/LinkedHashSet", "add", "(Ljava/lang/Object;)Z")
+    code := []byte{
+        classfile.NEW, byte(set >> 8), byte(set), classfile.DUP,
+        classfile.INVOKESPECIAL, byte(init >> 8), byte(init),
+        classfile.DUP, classfile.ICONST_1,
+        classfile.INVOKESTATIC, byte(valueOf >> 8), byte(valueOf),
+        classfile.INVOKEVIRTUAL, byte(add >> 8), byte(add),
+        classfile.POP,
+        classfile.ASTORE_0,
+        classfile.RETURN,
+    }
+    if b := method(t, cf, "f").Code.Bytes(); !bytes.Equal(b, code) {
+        t.Fatalf("wrong code % x", b)
+    }
+}
+
+// the finally block is copied before each return, its handlers leave the copies out
+func TestFinally(t *testing.T) {
+    classes, diags := generate(t,
+    "class A {\n"                        +
+    "  static int f(int x) {\n"          +
+    "    try {\n"                        +
+    "      return x\n"                   +
+    "    } catch (RuntimeException e) {\n" +
+    "      return -1\n"                  +
+    "    } finally {\n"                  +
+    "      x = 0\n"                      +
+    "    }\n"                            +
+    "  }\n"                              +
+    "}\n"                                )
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    code := []byte{
+        classfile.ILOAD_0, classfile.ISTORE_1,
+        classfile.ICONST_0, classfile.ISTORE_0,
+        classfile.ILOAD_1, classfile.IRETURN,
+        // catch (RuntimeException e)
+        classfile.ASTORE_1, classfile.ICONST_M1, classfile.ISTORE_2,
+        classfile.ICONST_0, classfile.ISTORE_0,
+        classfile.ILOAD_2, classfile.IRETURN,
+        // any other exception
+        classfile.ASTORE_1,
+        classfile.ICONST_0, classfile.ISTORE_0,
+        classfile.ALOAD_1, classfile.ATHROW,
+    }
+    m := method(t, classes[0], "f")
+    if b := m.Code.Bytes(); !bytes.Equal(b, code) {
+        t.Fatalf("wrong code % x", b)
+    }
+    handlers := []string{
+        "0 2 6 java/lang/RuntimeException",
+        "0 2 13 ",
+        "6 9 13 ",
+    }
+    if len(m.Code.Handlers) != len(handlers) {
+        t.Fatalf("expect %d handlers, found %d", len(handlers), len(m.Code.Handlers))
+    }
+    for i, h := range m.Code.Handlers {
+        s := fmt.Sprintf("%d %d %d %s", h.Start.Offset(), h.End.Offset(), h.Target.Offset(), h.CatchType)
+        if s != handlers[i] {
+            t.Fatalf("expect handler %s, found %s", handlers[i], s)
+        }
+    }
+}
+
+// each case is tried in turn, a value matching none throws
+func TestMatch(t *testing.T) {
+    classes, diags := generate(t,
+    "class A {\n"                      +
+    "  static f(Object o) {\n"         +
+    "    return o match {\n"           +
+    "      case 1 => \"one\"\n"        +
+    "      case s: String => s\n"      +
+    "    }\n"                          +
+    "  }\n"                            +
+    "}\n"                              )
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    cf := classes[0]
+    if _, err := cf.Bytes(); err != nil {  // patches the jumps
+        t.Fatalf("%s", err)
+    }
+    valueOf := cf.Pool.MethodRef("java/lang/Integer", "valueOf", "(I)Ljava/lang/Integer;")
+    equals := cf.Pool.MethodRef("java/util/Objects", "equals", "(Ljava/lang/Object;Ljava/lang/Object;)Z")
+    str := cf.Pool.Class("java/lang/String")
+    ise := cf.Pool.Class("java/lang/IllegalStateException")
+    init := cf.Pool.MethodRef("java/lang/IllegalStateException", "<init>", "(Ljava/lang/String;)V")
+    code := []byte{
+        classfile.ALOAD_0, classfile.ASTORE_1,
+        classfile.ACONST_NULL, classfile.ASTORE_2,
+        // case 1
+        classfile.ALOAD_1, classfile.ICONST_1,
+        classfile.INVOKESTATIC, byte(valueOf >> 8), byte(valueOf),
+        classfile.INVOKESTATIC, byte(equals >> 8), byte(equals),
+        classfile.IFEQ, 0, 9,
+        classfile.LDC, byte(cf.Pool.String("one")), classfile.ASTORE_2,
+        classfile.GOTO, 0, 30,
+        // case s: String
+        classfile.ALOAD_1, classfile.INSTANCEOF, byte(str >> 8), byte(str),
+        classfile.IFEQ, 0, 13,
+        classfile.ALOAD_1, classfile.CHECKCAST, byte(str >> 8), byte(str), classfile.ASTORE_3,
+        classfile.ALOAD_3, classfile.ASTORE_2,
+        classfile.GOTO, 0, 13,
+        // no case matches
+        classfile.NEW, byte(ise >> 8), byte(ise), classfile.DUP,
+        classfile.LDC, byte(cf.Pool.String("no case matches")),
+        classfile.INVOKESPECIAL, byte(init >> 8), byte(init),
+        classfile.ATHROW,
+        classfile.ALOAD_2, classfile.ARETURN,
+    }
+    if b := method(t, cf, "f").Code.Bytes(); !bytes.Equal(b, code) {
+        t.Fatalf("wrong code % x", b)
+    }
+}
+
+func TestUnsupported(t *testing.T) {
+    _, diags := generate(t,
+    "class A {\n"                  +
+    "  static f(Object o) {\n"     +
+    "    a, b := o\n"              +
+    "    c := { x -> x }\n"        +
+    "    o match { case Object(x) => x }\n" +
+    "  }\n"                        +
+    "}\n"                          )
+    expect := []string{
+        "A.kt:3:5: error K0018: a multiple assignment is not supported yet",
+        "A.kt:4:10: error K0018: a closure is not supported yet",
+        "A.kt:5:20: error K0016: cannot find static Object[] unapply(Object) in java.lang.Object",
+    }
+    if len(diags) != len(expect) {
+        t.Fatalf("expect %d diagnostics, found %d: %v", len(expect), len(diags), diags)
+    }
+    for i, d := range diags {
+        if d.String() != expect[i] {
+            t.Fatalf("expect %s, found %s", expect[i], d)
+        }
+    }
+}
+
+// the fields of an interface are public static final, initialized in <clinit>
+func TestInterfaceConstant(t *testing.T) {
+    classes, diags := generate(t,
+    "interface I {\n"              +
+    "  int X = 1\n"                +
+    "}\n"                          +
+    "class A {\n"                  +
+    "  static int f() {\n"         +
+    "    return I.X\n"             +
+    "  }\n"                        +
+    "}\n"                          )
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    i := classes[0]
+    flags := classfile.ACC_PUBLIC | classfile.ACC_STATIC | classfile.ACC_FINAL
+    if len(i.Fields) != 1 || i.Fields[0].Access != flags {
+        t.Fatalf("wrong fields %v", i.Fields)
+    }
+    x := i.Pool.FieldRef("I", "X", "I")
+    code := []byte{
+        classfile.ICONST_1,
+        classfile.PUTSTATIC, byte(x >> 8), byte(x),
+        classfile.RETURN,
+    }
+    if b := method(t, i, "<clinit>").Code.Bytes(); !bytes.Equal(b, code) {
+        t.Fatalf("wrong code % x", b)
+    }
+    a := classes[1]
+    x = a.Pool.FieldRef("I", "X", "I")
+    code = []byte{
+        classfile.GETSTATIC, byte(x >> 8), byte(x),
+        classfile.IRETURN,
+    }
+    if b := method(t, a, "f").Code.Bytes(); !bytes.Equal(b, code) {
+        t.Fatalf("wrong code % x", b)
+    }
+}
+
+// a*.b is null for a null a, and has a null b for a null element
+func TestSpreadNull(t *testing.T) {
+    classes, diags := generate(t,
+    "class A {\n"                      +
+    "  static f(String[] a) {\n"       +
+    "    return a*.length()\n"         +
+    "  }\n"                            +
+    "}\n"                              )
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    cf := classes[0]
+    if _, err := cf.Bytes(); err != nil {  // patches the jumps
+        t.Fatalf("%s", err)
+    }
+    list := cf.Pool.Class("java/util/ArrayList")
+    init := cf.Pool.MethodRef("java/util/ArrayList", "<init>", "()V")
+    length := cf.Pool.MethodRef("java/lang/String", "length", "()I")
+    valueOf := cf.Pool.MethodRef("java/lang/Integer", "valueOf", "(I)Ljava/lang/Integer;")
+    add := cf.Pool.MethodRef("java/util/ArrayList", "add", "(Ljava/lang/Object;)Z")
+    code := []byte{
+        classfile.ALOAD_0, classfile.DUP, classfile.IFNULL, 0, 54,
+        classfile.NEW, byte(list >> 8), byte(list), classfile.DUP,
+        classfile.INVOKESPECIAL, byte(init >> 8), byte(init),
+        classfile.SWAP, classfile.ASTORE_2,
+        classfile.ICONST_0, classfile.ISTORE_3,
+        // 16: each element
+        classfile.ILOAD_3, classfile.ALOAD_2, classfile.ARRAYLENGTH,
+        classfile.IF_ICMPGE, 0, 34,
+        classfile.ALOAD_2, classfile.ILOAD_3, classfile.AALOAD, classfile.ASTORE_1,
+        classfile.DUP, classfile.ALOAD_1,
+        classfile.DUP, classfile.IFNULL, 0, 12,
+        classfile.INVOKEVIRTUAL, byte(length >> 8), byte(length),
+        classfile.INVOKESTATIC, byte(valueOf >> 8), byte(valueOf),
+        classfile.GOTO, 0, 5,
+        classfile.POP, classfile.ACONST_NULL,
+        classfile.INVOKEVIRTUAL, byte(add >> 8), byte(add), classfile.POP,
+        classfile.IINC, 3, 1,
+        classfile.GOTO, 0xff, 0xde,
+        // 53: after the last element
+        classfile.GOTO, 0, 5,
+        classfile.POP, classfile.ACONST_NULL,
+        classfile.ARETURN,
+    }
+    if b := method(t, cf, "f").Code.Bytes(); !bytes.Equal(b, code) {
+        t.Fatalf("wrong code % x", b)
+    }
+}
+
+// annotations do not reach the class files yet, those kept in the source only aside
+func TestAnnotations(t *testing.T) {
+    _, diags := generate(t,
+    "@Deprecated class A {\n"               +
+    "  @Deprecated int x\n"                 +
+    "  @Override\n"                         +
+    "  String toString() { return \"\" }\n" +
+    "  f(@Deprecated int y) {\n"            +
+    "  }\n"                                 +
+    "}\n"                                   )
+    expect := []string{
+        "A.kt:1:1: error K0018: annotation @Deprecated is not supported yet",
+        "A.kt:2:3: error K0018: annotation @Deprecated is not supported yet",
+        "A.kt:5:5: error K0018: annotation @Deprecated is not supported yet",
+    }
+    if len(diags) != len(expect) {
+        t.Fatalf("expect %d diagnostics, found %d: %v", len(expect), len(diags), diags)
+    }
+    for i, d := range diags {
+        if d.String() != expect[i] {
+            t.Fatalf("expect %s, found %s", expect[i], d)
+        }
+    }
+}
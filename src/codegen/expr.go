@@ -0,0 +1,1394 @@
+package codegen
+
+import "strings"
+import "classfile"
+import "compiler"
+import . "ast"
+
+const (
+    ARRAY_LIST      = "java/util/ArrayList"
+    LINKED_HASH_MAP = "java/util/LinkedHashMap"
+    LINKED_HASH_SET = "java/util/LinkedHashSet"
+    STRING_BUILDER  = "java/lang/StringBuilder"
+)
+
+//
+// expr compiles expression n, leaving its value on the stack,
+// and gives its type.
+//
+func (this *methodGen) expr(n *Node) string {
+    switch n.Name {
+        case "INT_LITERAL", "LONG_LITERAL", "FLOAT_LITERAL", "DOUBLE_LITERAL",
+             "CHAR_LITERAL", "STRING_LITERAL", "BOOLEAN_LITERAL", "NULL_LITERAL":
+            return this.constant(n.Value)
+        case "IDENT":
+            return this.ident(n)
+        case "THIS":
+            this.self(n)
+            return object(this.class.name)
+        case "FIELD_ACCESS":
+            return this.fieldAccess(n)
+        case "CALL":
+            return this.call(n)
+        case "BIN_OP":
+            return this.binary(n)
+        case "U_MINUS", "U_PLUS", "TILD":
+            return this.unary(n)
+        case "NOT":
+            return this.boolValue(n)
+        case "INC", "DEC", "POST_INC", "POST_DEC":
+            return this.increment(n, true)
+        case "ASSIGN_EXPR":
+            return this.assign(n, true)
+        case "TERNARY":
+            return this.ternary(n)
+        case "CAST":
+            to := this.gen.resolveType(n.At(0))
+            this.convert(n.At(1), this.expr(n.At(1)), to, true)
+            return to
+        case "INSTANCE_OF":
+            return this.instanceOf(n)
+        case "NEW":
+            return this.newInstance(n)
+        case "NEW_ARRAY":
+            return this.newArray(n)
+        case "INDEX":
+            return this.index(n)
+        case "CLASS_LITERAL":
+            return this.classLiteral(n)
+        case "LIST_LITERAL":
+            return this.listLiteral(n, ARRAY_LIST)
+        case "MAP_LITERAL":
+            return this.mapLiteral(n)
+        case "RANGE":
+            // for (i : 1..10) loops without one
+            this.gen.unsupported(n, "a range used as a value")
+            return this.invalid()
+        case "INTERPOLATED_STRING":
+            return this.concat(n.Children)
+        case "SAFE_NAV":
+            return this.safeNav(n)
+        case "ELVIS":
+            return this.elvis(n)
+        case "SPREAD":
+            return this.spread(n)
+        case "MATCH":
+            return this.match(n, true)
+        case "SUPER":
+            this.errorf(n, compiler.ErrUnresolved, "super must be followed by a call or a field")
+            return this.invalid()
+        case "ERROR":
+            return this.invalid()
+        case "LAMBDA", "CLOSURE":
+            this.gen.unsupported(n, "a closure")
+            return this.invalid()
+        case "METHOD_REF":
+            this.gen.unsupported(n, "a method reference")
+            return this.invalid()
+    }
+    this.gen.unsupported(n, strings.ToLower(n.Name))
+    return this.invalid()
+}
+
+// a placeholder for an expression in error
+func (this *methodGen) invalid() string {
+    this.op(classfile.ACONST_NULL, 1)
+    return ERROR
+}
+
+// exprAs compiles n converted to type t
+func (this *methodGen) exprAs(n *Node, t string) {
+    if n.Name == "LIST_LITERAL" && this.gen.isSet(t) {
+        this.convert(n, this.listLiteral(n, LINKED_HASH_SET), t, false)
+        return
+    }
+    from := this.expr(n)
+    if from == VOID {
+        this.errorf(n, compiler.ErrTypeMismatch, "a void expression has no value")
+        this.invalid()
+        return
+    }
+    this.convert(n, from, t, false)
+}
+
+func (this *methodGen) constant(value interface{}) string {
+    pool := this.cf.Pool
+    switch v := value.(type) {
+        case int32:
+            this.iconst(int(v))
+            return INT
+        case int64:
+            if v == 0 || v == 1 {
+                this.op(classfile.LCONST_0 + int(v), 2)
+            } else {
+                this.ldc(pool.Long(v), 2)
+            }
+            return LONG
+        case float32:
+            if v == 0 || v == 1 || v == 2 {
+                this.op(classfile.FCONST_0 + int(v), 1)
+            } else {
+                this.ldc(pool.Float(v), 1)
+            }
+            return FLOAT
+        case float64:
+            if v == 0 || v == 1 {
+                this.op(classfile.DCONST_0 + int(v), 2)
+            } else {
+                this.ldc(pool.Double(v), 2)
+            }
+            return DOUBLE
+        case int:
+            this.iconst(v)
+            return CHAR
+        case string:
+            this.ldc(pool.String(v), 1)
+            return STRING
+        case bool:
+            if v { this.iconst(1) } else { this.iconst(0) }
+            return BOOLEAN
+    }
+    this.op(classfile.ACONST_NULL, 1)
+    return NULL
+}
+
+// the value of an int or char constant, for narrowing and switch labels
+func constInt(n *Node) (int, bool) {
+    switch n.Name {
+        case "INT_LITERAL":
+            v, ok := n.Value.(int32)
+            return int(v), ok
+        case "CHAR_LITERAL":
+            v, ok := n.Value.(int)
+            return v, ok
+        case "U_MINUS":
+            if n.At(0).Name == "INT_LITERAL" {
+                v, ok := constInt(n.At(0))
+                return -v, ok
+            }
+    }
+    return 0, false
+}
+
+// load this, an error in a static method
+func (this *methodGen) self(n *Node) {
+    if this.static {
+        this.errorf(n, compiler.ErrUnresolved, "this cannot be used in a static context")
+        this.op(classfile.ACONST_NULL, 1)
+        return
+    }
+    this.loadThis()
+}
+
+func (this *methodGen) ident(n *Node) string {
+    if l := this.lookup(n.Text); l != nil {
+        this.load(l.desc, l.slot)
+        return l.desc
+    }
+    if f := this.gen.findField(this.class.name, n.Text); f != nil {
+        if !f.static { this.self(n) }
+        this.getField(f)
+        return f.desc
+    }
+    this.errorf(n, compiler.ErrUnresolved, "cannot find symbol %s", n.Text)
+    return this.invalid()
+}
+
+//
+// staticTarget tells whether n names a class rather than a value,
+// as Math in Math.max(a, b). Variables hide classes.
+//
+func (this *methodGen) staticTarget(n *Node) (string, bool) {
+    root := n
+    for root.Name == "FIELD_ACCESS" {
+        root = root.At(0)
+    }
+    if root.Name == "IDENT" && (this.lookup(root.Text) != nil || this.gen.findField(this.class.name, root.Text) != nil) {
+        return "", false
+    }
+    return this.gen.className(n)
+}
+
+func (this *methodGen) fieldAccess(n *Node) string {
+    if owner, ok := this.staticTarget(n.At(0)); ok {
+        f := this.gen.findField(owner, n.Text)
+        switch {
+            case f == nil:
+                this.errorf(n, compiler.ErrUnresolved, "cannot find field %s in %s", n.Text, typeName(object(owner)))
+                return this.invalid()
+            case !f.static:
+                this.errorf(n, compiler.ErrUnresolved, "field %s of %s is not static", n.Text, typeName(object(owner)))
+                return this.invalid()
+        }
+        this.getField(f)
+        return f.desc
+    }
+    return this.fieldOf(n, this.expr(n.At(0)))
+}
+
+// field n of the object of type t on the stack
+func (this *methodGen) fieldOf(n *Node, t string) string {
+    switch {
+        case t == ERROR:
+            return ERROR
+        case isArray(t) && n.Text == "length":
+            this.op(classfile.ARRAYLENGTH, 0)
+            return INT
+        case !isReference(t) || t == NULL || isArray(t):
+            this.errorf(n, compiler.ErrUnresolved, "%s has no field %s", typeName(t), n.Text)
+            this.pop(t)
+            return this.invalid()
+    }
+    f := this.gen.findField(internalName(t), n.Text)
+    if f == nil {
+        this.errorf(n, compiler.ErrUnresolved, "cannot find field %s in %s", n.Text, typeName(t))
+        this.pop(t)
+        return this.invalid()
+    }
+    if f.static { this.pop(t) }
+    this.getField(f)
+    return f.desc
+}
+
+func (this *methodGen) argTypes(args []*Node) []string {
+    types := []string{}
+    for _, a := range args {
+        types = append(types, this.typeOf(a))
+    }
+    return types
+}
+
+// the types of args for error messages, "int, java.lang.String"
+func (this *methodGen) argList(args []*Node) string {
+    names := []string{}
+    for _, t := range this.argTypes(args) {
+        names = append(names, typeName(t))
+    }
+    return strings.Join(names, ", ")
+}
+
+//
+// badArguments compiles the arguments of a call that could not be
+// resolved, reporting their own errors. It tells whether one of them
+// was in error, so that the call itself needs no other message.
+//
+func (this *methodGen) badArguments(args []*Node) bool {
+    bad := false
+    for _, a := range args {
+        t := this.expr(a)
+        if t == ERROR { bad = true }
+        this.pop(t)
+    }
+    return bad
+}
+
+func (this *methodGen) arguments(args []*Node, params []string) {
+    for i, a := range args {
+        this.exprAs(a, params[i])
+    }
+}
+
+func (this *methodGen) call(n *Node) string {
+    target, args := n.At(0), n.At(1).Children
+    switch {
+        case target == nil && (n.Text == "this" || n.Text == "super"):
+            this.errorf(n, compiler.ErrUnresolved, "%s(...) must be the first statement of a constructor", n.Text)
+            return this.invalid()
+        case target == nil:
+            owner := this.class.name
+            m := this.gen.findMethod(owner, n.Text, this.argTypes(args))
+            if m == nil && !this.gen.hasMethod(owner, n.Text) && (n.Text == "println" || n.Text == "print") {
+                // println(x) is System.out.println(x)
+                this.getField(this.gen.findField("java/lang/System", "out"))
+                return this.callOn(n, "Ljava/io/PrintStream;")
+            }
+            if m != nil && !m.static { this.self(n) }
+            return this.invokeCall(n, owner, m, m != nil && m.private)
+        case target.Name == "SUPER":
+            this.self(n)
+            owner := this.class.super
+            return this.invokeCall(n, owner, this.gen.findMethod(owner, n.Text, this.argTypes(args)), true)
+    }
+    if owner, ok := this.staticTarget(target); ok {
+        this.namedArguments(n, owner)
+        m := this.gen.findMethod(owner, n.Text, this.argTypes(n.At(1).Children))
+        if m != nil && !m.static {
+            this.errorf(n, compiler.ErrUnresolved, "method %s of %s is not static", n.Text, typeName(object(owner)))
+            return this.invalid()
+        }
+        return this.invokeCall(n, owner, m, false)
+    }
+    return this.callOn(n, this.expr(target))
+}
+
+// call n on the object of type t on the stack
+func (this *methodGen) callOn(n *Node, t string) string {
+    switch {
+        case t == ERROR:
+            return ERROR
+        case !isReference(t) || t == NULL:
+            this.errorf(n, compiler.ErrUnresolved, "cannot call %s on %s", n.Text, typeName(t))
+            this.pop(t)
+            return this.invalid()
+    }
+    owner := internalName(t)
+    if isArray(t) { owner = "java/lang/Object" }
+    this.namedArguments(n, owner)
+    m := this.gen.findMethod(owner, n.Text, this.argTypes(n.At(1).Children))
+    if m != nil && m.static { this.pop(t) }
+    return this.invokeCall(n, owner, m, m != nil && m.private)
+}
+
+//
+// namedArguments binds the named arguments of a call on an object of
+// class owner, e.g. p.copy(y = 1), to the method of the unit called,
+// the one the nearest class declares. Calls whose target is known from
+// the source alone were bound by DesugarCaseClasses already.
+//
+func (this *methodGen) namedArguments(n *Node, owner string) {
+    for _, s := range this.gen.supertypes(owner) {
+        c := this.gen.classInfo(s)
+        if c == nil { continue }
+        candidates := []*Node{}
+        for _, m := range c.methods {
+            if m.name == n.Text && m.decl != nil {
+                candidates = append(candidates, m.decl)
+            }
+        }
+        if len(candidates) > 0 {
+            compiler.BindNamedArguments(n.At(1), candidates, n.At(0))
+            return
+        }
+    }
+}
+
+//
+// invokeCall passes the arguments of n to method m of class owner,
+// the target being on the stack already. Instance methods are called
+// through owner, as javac does, unless they belong to an interface
+// and owner is one too.
+//
+func (this *methodGen) invokeCall(n *Node, owner string, m *methodInfo, special bool) string {
+    args := n.At(1).Children
+    if m == nil {
+        if !this.badArguments(args) {
+            this.errorf(n, compiler.ErrUnresolved, "cannot find method %s(%s) in %s", n.Text, this.argList(args), typeName(object(owner)))
+        }
+        return this.invalid()
+    }
+    this.arguments(args, m.params)
+    class := m.owner
+    if !m.static && !special {
+        if c := this.gen.classInfo(owner); c == nil || !c.isInterface {
+            class = owner
+        }
+    }
+    this.invoke(class, m.name, m.desc, m.static, special)
+    return m.ret
+}
+
+//
+// operators
+//
+
+// the primitive type of t, unboxing a box
+func numeric(t string) string {
+    if p := unboxed(t); p != "" { return p }
+    return t
+}
+
+var arithOps = map[string]int {
+    "+":   classfile.IADD,
+    "-":   classfile.ISUB,
+    "*":   classfile.IMUL,
+    "/":   classfile.IDIV,
+    "%":   classfile.IREM,
+    "<<":  classfile.ISHL,
+    ">>":  classfile.ISHR,
+    ">>>": classfile.IUSHR,
+    "&":   classfile.IAND,
+    "|":   classfile.IOR,
+    "^":   classfile.IXOR,
+}
+
+func isShift(op string) bool {
+    return op == "<<" || op == ">>" || op == ">>>"
+}
+
+func isBitwise(op string) bool {
+    return op == "&" || op == "|" || op == "^"
+}
+
+// the operator op on two values of type t, or a value of type t and an int shift distance
+func (this *methodGen) arith(op string, t string) {
+    code := arithOps[op]
+    switch {
+        case isShift(op) || isBitwise(op):
+            if t == LONG { code++ }
+        default:
+            code += kind(t)
+    }
+    if isShift(op) {
+        this.op(code, -1)
+    } else {
+        this.op(code, -size(t))
+    }
+}
+
+//
+// operandType checks the operands of op, of types a and b, and gives
+// the type they are computed in: boolean for the logical & | ^, the
+// promoted left operand for shifts.
+//
+func (this *methodGen) operandType(n *Node, op string, a, b string) string {
+    a, b = numeric(a), numeric(b)
+    switch {
+        case a == ERROR || b == ERROR:
+            return ERROR
+        case isBitwise(op) && a == BOOLEAN && b == BOOLEAN:
+            return BOOLEAN
+        case !isNumeric(a) || !isNumeric(b):
+        case (isShift(op) || isBitwise(op)) && (a == FLOAT || a == DOUBLE || b == FLOAT || b == DOUBLE):
+        case isShift(op):
+            return promote(a, INT)
+        default:
+            return promote(a, b)
+    }
+    this.errorf(n, compiler.ErrTypeMismatch, "bad operand types for %s: %s and %s", op, typeName(a), typeName(b))
+    return ERROR
+}
+
+// the right operand r of op computed in type t
+func (this *methodGen) operand(op string, r *Node, t string) {
+    if !isShift(op) {
+        this.exprAs(r, t)
+        return
+    }
+    d := promote(numeric(this.typeOf(r)), INT)
+    this.exprAs(r, d)
+    if d == LONG { this.op(classfile.L2I, -1) }
+}
+
+func (this *methodGen) binary(n *Node) string {
+    op, l, r := n.Text, n.At(0), n.At(1)
+    switch op {
+        case "&&", "||", "==", "!=", "<", "<=", ">", ">=":
+            return this.boolValue(n)
+    }
+    if op == "+" && this.isString(n) {
+        return this.concat(this.concatParts(n, nil))
+    }
+    t := this.operandType(n, op, this.typeOf(l), this.typeOf(r))
+    if t == ERROR { return this.invalid() }
+    this.exprAs(l, t)
+    this.operand(op, r, t)
+    this.arith(op, t)
+    return t
+}
+
+// whether + is a string concatenation
+func (this *methodGen) isString(n *Node) bool {
+    return this.typeOf(n.At(0)) == STRING || this.typeOf(n.At(1)) == STRING
+}
+
+// the operands of a + b + c ..., up to the first string
+func (this *methodGen) concatParts(n *Node, parts []*Node) []*Node {
+    if n.Name == "BIN_OP" && n.Text == "+" && this.isString(n) {
+        parts = this.concatParts(n.At(0), parts)
+        return this.concatParts(n.At(1), parts)
+    }
+    return append(parts, n)
+}
+
+// the parts converted to strings and joined with a StringBuilder
+func (this *methodGen) concat(parts []*Node) string {
+    this.newObject(STRING_BUILDER)
+    this.invoke(STRING_BUILDER, "<init>", "()V", false, true)
+    for _, p := range parts {
+        t := this.expr(p)
+        switch {
+            case t == BYTE || t == SHORT:
+                t = INT
+            case t == VOID:
+                this.errorf(p, compiler.ErrTypeMismatch, "a void expression has no value")
+                continue
+            case t == ERROR || isReference(t) && t != STRING:
+                t = OBJECT
+        }
+        this.invoke(STRING_BUILDER, "append", "(" + t + ")L" + STRING_BUILDER + ";", false, false)
+    }
+    this.invoke(STRING_BUILDER, "toString", "()" + STRING, false, false)
+    return STRING
+}
+
+func (this *methodGen) unary(n *Node) string {
+    e := n.At(0)
+    if n.Name == "U_MINUS" {
+        // -1 is a constant, as is -2147483648
+        switch v := e.Value.(type) {
+            case int32:   if e.Name == "INT_LITERAL"    { return this.constant(-v) }
+            case int64:   if e.Name == "LONG_LITERAL"   { return this.constant(-v) }
+            case float32: if e.Name == "FLOAT_LITERAL"  { return this.constant(-v) }
+            case float64: if e.Name == "DOUBLE_LITERAL" { return this.constant(-v) }
+        }
+    }
+    t := numeric(this.typeOf(e))
+    switch {
+        case t == ERROR:
+            return this.expr(e)
+        case !isNumeric(t) || n.Name == "TILD" && (t == FLOAT || t == DOUBLE):
+            this.errorf(n, compiler.ErrTypeMismatch, "bad operand type %s for a unary operator", typeName(t))
+            return this.invalid()
+    }
+    t = promote(t, INT)
+    this.exprAs(e, t)
+    switch n.Name {
+        case "U_MINUS":
+            this.op(classfile.INEG + kind(t), 0)
+        case "TILD":
+            if t == LONG {
+                this.ldc(this.cf.Pool.Long(-1), 2)
+            } else {
+                this.iconst(-1)
+            }
+            this.arith("^", t)
+    }
+    return t
+}
+
+//
+// boolValue computes a condition as 0 or 1:
+//
+//     if !n goto f; iconst_1; goto end; f: iconst_0; end:
+//
+func (this *methodGen) boolValue(n *Node) string {
+    f, end := this.newLabel(), this.newLabel()
+    this.branch(n, f, false)
+    depth := this.depth
+    this.iconst(1)
+    this.jumpTo(end)
+    this.bind(f)
+    this.depth = depth
+    this.iconst(0)
+    this.bind(end)
+    return BOOLEAN
+}
+
+//
+// branch jumps to target when condition n is jumpIf, and falls through
+// otherwise. && and || short-circuit.
+//
+func (this *methodGen) branch(n *Node, target *classfile.Label, jumpIf bool) {
+    switch n.Name {
+        case "NOT":
+            this.branch(n.At(0), target, !jumpIf)
+            return
+        case "BOOLEAN_LITERAL":
+            if v, _ := n.Value.(bool); v == jumpIf {
+                this.jumpTo(target)
+            }
+            return
+        case "BIN_OP":
+            switch n.Text {
+                case "&&", "||":
+                    if (n.Text == "&&") != jumpIf {
+                        // false && or true ||: either operand decides
+                        this.branch(n.At(0), target, jumpIf)
+                        this.branch(n.At(1), target, jumpIf)
+                    } else {
+                        skip := this.newLabel()
+                        this.branch(n.At(0), skip, !jumpIf)
+                        this.branch(n.At(1), target, jumpIf)
+                        this.bind(skip)
+                    }
+                    return
+                case "==", "!=", "<", "<=", ">", ">=":
+                    this.compare(n, target, jumpIf)
+                    return
+            }
+    }
+    this.exprAs(n, BOOLEAN)
+    if jumpIf {
+        this.jump(classfile.IFNE, target, -1)
+    } else {
+        this.jump(classfile.IFEQ, target, -1)
+    }
+}
+
+// the offset of each comparison in IFEQ, IFNE, IFLT, IFGE, IFGT, IFLE;
+// x^1 is the negation of x
+var comparisons = map[string]int {
+    "==": 0,
+    "!=": 1,
+    "<":  2,
+    ">=": 3,
+    ">":  4,
+    "<=": 5,
+}
+
+func (this *methodGen) compare(n *Node, target *classfile.Label, jumpIf bool) {
+    op, l, r := n.Text, n.At(0), n.At(1)
+    cond := comparisons[op]
+    if !jumpIf { cond ^= 1 }
+    tl, tr := this.typeOf(l), this.typeOf(r)
+    equality := op == "==" || op == "!="
+    switch {
+        case tl == ERROR || tr == ERROR:
+            this.expr(l)
+            this.expr(r)
+            this.jump(classfile.IF_ACMPEQ, target, -2)
+        case equality && isReference(tl) && isReference(tr):
+            switch {
+                case tr == NULL:
+                    this.expr(l)
+                    this.jump(classfile.IFNULL + cond, target, -1)
+                case tl == NULL:
+                    this.expr(r)
+                    this.jump(classfile.IFNULL + cond, target, -1)
+                default:
+                    this.expr(l)
+                    this.expr(r)
+                    this.jump(classfile.IF_ACMPEQ + cond, target, -2)
+            }
+        case equality && numeric(tl) == BOOLEAN && numeric(tr) == BOOLEAN:
+            this.exprAs(l, BOOLEAN)
+            this.exprAs(r, BOOLEAN)
+            this.jump(classfile.IF_ICMPEQ + cond, target, -2)
+        case isNumeric(numeric(tl)) && isNumeric(numeric(tr)):
+            t := promote(numeric(tl), numeric(tr))
+            if v, ok := constInt(r); ok && v == 0 && t == INT {
+                this.exprAs(l, t)  // x < 0 as IFLT
+                this.jump(classfile.IFEQ + cond, target, -1)
+                return
+            }
+            this.exprAs(l, t)
+            this.exprAs(r, t)
+            // NaN compares false: FCMPG gives 1 for it, FCMPL -1
+            nanIsGreater := op == "<" || op == "<="
+            switch t {
+                case INT:
+                    this.jump(classfile.IF_ICMPEQ + cond, target, -2)
+                    return
+                case LONG:
+                    this.op(classfile.LCMP, -3)
+                case FLOAT:
+                    if nanIsGreater {
+                        this.op(classfile.FCMPG, -1)
+                    } else {
+                        this.op(classfile.FCMPL, -1)
+                    }
+                case DOUBLE:
+                    if nanIsGreater {
+                        this.op(classfile.DCMPG, -3)
+                    } else {
+                        this.op(classfile.DCMPL, -3)
+                    }
+            }
+            this.jump(classfile.IFEQ + cond, target, -1)
+        default:
+            this.errorf(n, compiler.ErrTypeMismatch, "bad operand types for %s: %s and %s", op, typeName(tl), typeName(tr))
+    }
+}
+
+//
+// conversions
+//
+
+//
+// convert converts the value of n on the stack from type from to type
+// to: primitive widening, boxing, unboxing and downcasts, plus narrowing
+// when explicit, as in a cast. An int constant narrows implicitly when
+// it fits, as in byte b = 1.
+//
+func (this *methodGen) convert(n *Node, from, to string, explicit bool) {
+    switch {
+        case from == to || from == ERROR || to == ERROR:
+            return
+        case from == VOID || to == VOID:
+        case isPrimitive(from) && isPrimitive(to):
+            if from == BOOLEAN || to == BOOLEAN { break }
+            if !explicit && !widens(from, to) && !fits(n, to) { break }
+            this.primitive(from, to)
+            return
+        case isPrimitive(from):
+            if !this.gen.assignable(boxed(from), to) { break }
+            this.box(from)
+            return
+        case isPrimitive(to):
+            p := unboxed(from)
+            if p == "" {
+                // Object to int: through Integer
+                if !this.gen.assignable(boxed(to), from) { break }
+                this.op2(classfile.CHECKCAST, this.cf.Pool.Class(boxes[to]), 0)
+                p = to
+            }
+            if p != to && p == BOOLEAN { break }
+            if p != to && !explicit && !widens(p, to) { break }
+            this.unbox(p)
+            this.primitive(p, to)
+            return
+        case this.gen.assignable(from, to):
+            return
+        case this.gen.assignable(to, from) || explicit && (this.isInterface(from) || this.isInterface(to)):
+            this.op2(classfile.CHECKCAST, this.cf.Pool.Class(internalName(to)), 0)
+            return
+    }
+    this.errorf(n, compiler.ErrTypeMismatch, "incompatible types: %s cannot be converted to %s", typeName(from), typeName(to))
+}
+
+func (this *methodGen) isInterface(t string) bool {
+    if t[0] != 'L' { return false }
+    c := this.gen.classInfo(internalName(t))
+    return c != nil && c.isInterface
+}
+
+// whether n is an int constant in the range of type t
+func fits(n *Node, t string) bool {
+    v, ok := constInt(n)
+    switch {
+        case !ok:
+            return false
+        case t == BYTE:
+            return v >= -128 && v <= 127
+        case t == SHORT:
+            return v >= -32768 && v <= 32767
+        case t == CHAR:
+            return v >= 0 && v <= 0xFFFF
+    }
+    return false
+}
+
+//
+// primitive converts between numeric types: I2L ... D2F, then I2B,
+// I2C or I2S to narrow an int.
+//
+func (this *methodGen) primitive(from, to string) {
+    if from == to { return }
+    a, b := kind(from), kind(to)
+    if a != b {
+        op := classfile.I2L + a*3 + b
+        if b > a { op-- }
+        this.op(op, size(to) - size(from))
+    }
+    if isIntLike(to) && to != INT && !widens(from, to) {
+        switch to {
+            case BYTE:  this.op(classfile.I2B, 0)
+            case CHAR:  this.op(classfile.I2C, 0)
+            case SHORT: this.op(classfile.I2S, 0)
+        }
+    }
+}
+
+func (this *methodGen) box(p string) {
+    this.invoke(boxes[p], "valueOf", "(" + p + ")" + boxed(p), true, false)
+}
+
+func (this *methodGen) unbox(p string) {
+    this.invoke(boxes[p], unboxMethods[p], "()" + p, false, false)
+}
+
+//
+// the common type of the branches of a ?: b and a ?: b
+//
+func (this *methodGen) unify(a, b string) string {
+    switch {
+        case a == b:
+            return a
+        case a == ERROR || b == ERROR:
+            return ERROR
+        case isNumeric(numeric(a)) && isNumeric(numeric(b)):
+            return promote(numeric(a), numeric(b))
+        case numeric(a) == BOOLEAN && numeric(b) == BOOLEAN:
+            return BOOLEAN
+    }
+    a, b = boxed(a), boxed(b)
+    switch {
+        case a == NULL:
+            return b
+        case b == NULL:
+            return a
+        case this.gen.assignable(a, b):
+            return b
+        case this.gen.assignable(b, a):
+            return a
+    }
+    return OBJECT
+}
+
+func (this *methodGen) ternary(n *Node) string {
+    c, a, b := n.At(0), n.At(1), n.At(2)
+    t := this.unify(this.typeOf(a), this.typeOf(b))
+    elseLabel, end := this.newLabel(), this.newLabel()
+    this.branch(c, elseLabel, false)
+    depth := this.depth
+    this.exprAs(a, t)
+    this.jumpTo(end)
+    this.bind(elseLabel)
+    this.depth = depth
+    this.exprAs(b, t)
+    this.bind(end)
+    return t
+}
+
+//
+// assignments
+//
+
+const (
+    LOCAL = iota
+    STATIC_FIELD
+    FIELD
+    ELEMENT
+)
+
+//
+// lvalue is a variable being assigned. Its object, or array and index,
+// are on the stack below the value.
+//
+type lvalue struct {
+    kind  int
+    desc  string
+    local *local
+    field *fieldInfo
+}
+
+// the number of stack slots taken by the object or array and index
+func (this *lvalue) parts() int {
+    switch this.kind {
+        case FIELD:   return 1
+        case ELEMENT: return 2
+    }
+    return 0
+}
+
+// lvalue compiles the object or the array and index of variable n
+func (this *methodGen) lvalue(n *Node) *lvalue {
+    switch n.Name {
+        case "IDENT":
+            if l := this.lookup(n.Text); l != nil {
+                return &lvalue{kind: LOCAL, desc: l.desc, local: l}
+            }
+            if f := this.gen.findField(this.class.name, n.Text); f != nil {
+                if f.static {
+                    return &lvalue{kind: STATIC_FIELD, desc: f.desc, field: f}
+                }
+                this.self(n)
+                return &lvalue{kind: FIELD, desc: f.desc, field: f}
+            }
+            this.errorf(n, compiler.ErrUnresolved, "cannot find symbol %s", n.Text)
+            return nil
+        case "FIELD_ACCESS":
+            if owner, ok := this.staticTarget(n.At(0)); ok {
+                f := this.gen.findField(owner, n.Text)
+                if f == nil || !f.static {
+                    this.errorf(n, compiler.ErrUnresolved, "cannot find static field %s in %s", n.Text, typeName(object(owner)))
+                    return nil
+                }
+                return &lvalue{kind: STATIC_FIELD, desc: f.desc, field: f}
+            }
+            t := this.expr(n.At(0))
+            if t == ERROR { return nil }
+            var f *fieldInfo
+            if isReference(t) && t != NULL && !isArray(t) {
+                f = this.gen.findField(internalName(t), n.Text)
+            }
+            if f == nil {
+                this.errorf(n, compiler.ErrUnresolved, "cannot assign field %s of %s", n.Text, typeName(t))
+                return nil
+            }
+            if f.static {
+                this.pop(t)
+                return &lvalue{kind: STATIC_FIELD, desc: f.desc, field: f}
+            }
+            return &lvalue{kind: FIELD, desc: f.desc, field: f}
+        case "INDEX":
+            t := this.expr(n.At(0))
+            if t == ERROR { return nil }
+            if !isArray(t) {
+                this.errorf(n, compiler.ErrTypeMismatch, "cannot assign an element of %s", typeName(t))
+                return nil
+            }
+            this.exprAs(n.At(1), INT)
+            return &lvalue{kind: ELEMENT, desc: elementType(t)}
+    }
+    this.errorf(n, compiler.ErrTypeMismatch, "cannot assign to %s", strings.ToLower(n.Name))
+    return nil
+}
+
+// the value of lv, keeping its object or array and index on the stack
+func (this *methodGen) loadVar(lv *lvalue) {
+    switch lv.kind {
+        case LOCAL:
+            this.load(lv.desc, lv.local.slot)
+        case STATIC_FIELD:
+            this.getField(lv.field)
+        case FIELD:
+            this.op(classfile.DUP, 1)
+            this.getField(lv.field)
+        case ELEMENT:
+            this.op(classfile.DUP2, 2)
+            this.op(arrayOpcode(classfile.IALOAD, lv.desc), size(lv.desc) - 2)
+    }
+}
+
+func (this *methodGen) storeVar(lv *lvalue) {
+    switch lv.kind {
+        case LOCAL:
+            this.store(lv.desc, lv.local.slot)
+        case STATIC_FIELD, FIELD:
+            this.putField(lv.field)
+        case ELEMENT:
+            this.op(arrayOpcode(classfile.IASTORE, lv.desc), -2 - size(lv.desc))
+    }
+}
+
+// a copy of the value on the stack, below the parts of lv
+func (this *methodGen) dupValue(lv *lvalue) {
+    wide := size(lv.desc) == 2
+    op := classfile.DUP
+    switch lv.parts() {
+        case 0: if wide { op = classfile.DUP2 }
+        case 1: if wide { op = classfile.DUP2_X1 } else { op = classfile.DUP_X1 }
+        case 2: if wide { op = classfile.DUP2_X2 } else { op = classfile.DUP_X2 }
+    }
+    this.op(op, size(lv.desc))
+}
+
+// IALOAD or IASTORE and their variants for elements of type t
+func arrayOpcode(base int, t string) int {
+    switch t {
+        case BOOLEAN, BYTE: return base + 5
+        case CHAR:          return base + 6
+        case SHORT:         return base + 7
+    }
+    return base + kind(t)
+}
+
+//
+// assign compiles a = b and the compound assignments a += b ...,
+// whose value is wanted on the stack or not.
+//
+func (this *methodGen) assign(n *Node, want bool) string {
+    op, lhs, rhs := n.Text, n.At(0), n.At(1)
+    if lhs.Name == "INDEX" && op == "=" {
+        if t := this.typeOf(lhs.At(0)); isReference(t) && !isArray(t) {
+            return this.putElement(lhs, rhs, t, want)
+        }
+    }
+    lv := this.lvalue(lhs)
+    if lv == nil {
+        if want { return this.invalid() }
+        return VOID
+    }
+    if op == "=" {
+        this.exprAs(rhs, lv.desc)
+    } else {
+        this.loadVar(lv)
+        this.compound(n, op[0:len(op)-1], lv.desc, rhs)
+    }
+    if !want {
+        this.storeVar(lv)
+        return VOID
+    }
+    this.dupValue(lv)
+    this.storeVar(lv)
+    return lv.desc
+}
+
+// the value of type t on the stack op rhs, cast back to t
+func (this *methodGen) compound(n *Node, op string, t string, rhs *Node) {
+    if op == "+" && t == STRING {
+        // String.valueOf turns null into "null"
+        this.invoke("java/lang/String", "valueOf", "(" + OBJECT + ")" + STRING, true, false)
+        this.concat([]*Node{rhs})
+        this.invoke("java/lang/String", "concat", "(" + STRING + ")" + STRING, false, false)
+        return
+    }
+    ct := this.operandType(n, op, t, this.typeOf(rhs))
+    if ct == ERROR {
+        this.expr(rhs)
+        return
+    }
+    p := numeric(t)
+    this.convert(n, t, p, false)
+    this.primitive(p, ct)
+    this.operand(op, rhs, ct)
+    this.arith(op, ct)
+    this.primitive(ct, p)
+    this.convert(n, p, t, false)
+}
+
+// list[i] = v and map[k] = v
+func (this *methodGen) putElement(lhs, rhs *Node, t string, want bool) string {
+    target, index := lhs.At(0), lhs.At(1)
+    var owner, desc string
+    switch {
+        case this.gen.assignable(t, "Ljava/util/List;"):
+            owner, desc = "java/util/List", "(I" + OBJECT + ")" + OBJECT
+            this.expr(target)
+            this.exprAs(index, INT)
+        case this.gen.assignable(t, "Ljava/util/Map;"):
+            owner, desc = "java/util/Map", "(" + OBJECT + OBJECT + ")" + OBJECT
+            this.expr(target)
+            this.exprAs(index, OBJECT)
+        default:
+            this.errorf(lhs, compiler.ErrTypeMismatch, "cannot assign an element of %s", typeName(t))
+            if want { return this.invalid() }
+            return VOID
+    }
+    this.exprAs(rhs, OBJECT)
+    if want { this.op(classfile.DUP_X2, 1) }
+    name := "set"
+    if owner == "java/util/Map" { name = "put" }
+    this.invoke(owner, name, desc, false, false)
+    this.op(classfile.POP, -1)    // the previous value
+    if want { return OBJECT }
+    return VOID
+}
+
+// ++ and --, before or after the variable
+func (this *methodGen) increment(n *Node, want bool) string {
+    post := n.Name == "POST_INC" || n.Name == "POST_DEC"
+    op := "+"
+    if n.Name == "DEC" || n.Name == "POST_DEC" { op = "-" }
+    e := n.At(0)
+    if l := this.lookup(e.Text); e.Name == "IDENT" && l != nil && l.desc == INT {
+        if want && post { this.load(INT, l.slot) }
+        if op == "+" {
+            this.code.Iinc(l.slot, 1)
+        } else {
+            this.code.Iinc(l.slot, -1)
+        }
+        if want && !post { this.load(INT, l.slot) }
+        if want { return INT }
+        return VOID
+    }
+    lv := this.lvalue(e)
+    if lv == nil {
+        if want { return this.invalid() }
+        return VOID
+    }
+    p := numeric(lv.desc)
+    if !isNumeric(p) {
+        this.errorf(n, compiler.ErrTypeMismatch, "bad operand type %s for %s%s", typeName(lv.desc), op, op)
+        if want { return this.invalid() }
+        return VOID
+    }
+    this.loadVar(lv)
+    if want && post { this.dupValue(lv) }
+    ct := promote(p, INT)
+    this.convert(n, lv.desc, p, false)
+    this.primitive(p, ct)
+    switch ct {
+        case INT:    this.constant(int32(1))
+        case LONG:   this.constant(int64(1))
+        case FLOAT:  this.constant(float32(1))
+        case DOUBLE: this.constant(float64(1))
+    }
+    this.arith(op, ct)
+    this.primitive(ct, p)
+    this.convert(n, p, lv.desc, false)
+    if want && !post { this.dupValue(lv) }
+    this.storeVar(lv)
+    if want { return lv.desc }
+    return VOID
+}
+
+//
+// objects and arrays
+//
+
+func (this *methodGen) instanceOf(n *Node) string {
+    from := this.expr(n.At(0))
+    t := this.gen.resolveType(n.At(1))
+    if !isReference(from) && from != ERROR {
+        this.errorf(n, compiler.ErrTypeMismatch, "%s is not a reference type", typeName(from))
+    }
+    this.op2(classfile.INSTANCEOF, this.cf.Pool.Class(internalName(t)), 0)
+    return BOOLEAN
+}
+
+func (this *methodGen) newInstance(n *Node) string {
+    if len(n.Children) > 2 {
+        this.gen.unsupported(n, "an anonymous class")
+        return this.invalid()
+    }
+    t := this.gen.resolveType(n.At(0))
+    owner := internalName(t)
+    if c := this.gen.classInfo(owner); c != nil && c.isInterface {
+        this.errorf(n, compiler.ErrTypeMismatch, "%s is abstract; cannot be instantiated", typeName(t))
+        return this.invalid()
+    }
+    args := n.At(1).Children
+    m := this.gen.findMethod(owner, "<init>", this.argTypes(args))
+    if m == nil {
+        if !this.badArguments(args) {
+            this.errorf(n, compiler.ErrUnresolved, "cannot find constructor %s(%s)", typeName(t), this.argList(args))
+        }
+        return this.invalid()
+    }
+    this.newObject(owner)
+    this.arguments(args, m.params)
+    this.invokeMethod(m, true)
+    return t
+}
+
+// the NEWARRAY codes of the primitive types
+var arrayTypes = map[string]int {
+    BOOLEAN: 4,
+    CHAR:    5,
+    FLOAT:   6,
+    DOUBLE:  7,
+    BYTE:    8,
+    SHORT:   9,
+    INT:     10,
+    LONG:    11,
+}
+
+// an array of elements of type t, its length on the stack
+func (this *methodGen) newArrayOf(t string) {
+    if code, exists := arrayTypes[t]; exists {
+        this.op1(classfile.NEWARRAY, code, 0)
+        return
+    }
+    this.op2(classfile.ANEWARRAY, this.cf.Pool.Class(internalName(t)), 0)
+}
+
+func (this *methodGen) newArray(n *Node) string {
+    t := this.gen.resolveType(n.At(0))
+    if len(n.Children) < 2 { return this.invalid() }    // after a syntax error
+    if n.At(1).Name == "ARRAY_INIT" {
+        this.arrayInit(n.At(1), t)
+        return t
+    }
+    dims := n.Children[1:]
+    for _, d := range dims {
+        this.exprAs(d, INT)
+    }
+    if len(dims) == 1 {
+        this.newArrayOf(elementType(t))
+    } else {
+        this.code.MultiANewArray(this.cf.Pool.Class(t), len(dims))
+        this.stack(1 - len(dims))
+    }
+    return t
+}
+
+// {a, b, c} for an array of type t
+func (this *methodGen) arrayInit(n *Node, t string) {
+    if !isArray(t) {
+        this.errorf(n, compiler.ErrTypeMismatch, "an array initializer for %s", typeName(t))
+        this.invalid()
+        return
+    }
+    e := elementType(t)
+    this.iconst(len(n.Children))
+    this.newArrayOf(e)
+    for i, v := range n.Children {
+        this.op(classfile.DUP, 1)
+        this.iconst(i)
+        this.initializer(v, e)
+        this.op(arrayOpcode(classfile.IASTORE, e), -2 - size(e))
+    }
+}
+
+// array[i], string[i], list[i] and map[key]
+func (this *methodGen) index(n *Node) string {
+    t := this.expr(n.At(0))
+    i := n.At(1)
+    switch {
+        case t == ERROR:
+            return ERROR
+        case isArray(t):
+            e := elementType(t)
+            this.exprAs(i, INT)
+            this.op(arrayOpcode(classfile.IALOAD, e), size(e) - 2)
+            return e
+        case t == STRING:
+            this.exprAs(i, INT)
+            this.invoke("java/lang/String", "charAt", "(I)C", false, false)
+            return CHAR
+        case this.gen.assignable(t, "Ljava/util/List;"):
+            this.exprAs(i, INT)
+            this.invoke("java/util/List", "get", "(I)" + OBJECT, false, false)
+            return OBJECT
+        case this.gen.assignable(t, "Ljava/util/Map;"):
+            this.exprAs(i, OBJECT)
+            this.invoke("java/util/Map", "get", "(" + OBJECT + ")" + OBJECT, false, false)
+            return OBJECT
+    }
+    this.errorf(n, compiler.ErrTypeMismatch, "cannot index %s", typeName(t))
+    this.pop(t)
+    return this.invalid()
+}
+
+func (this *methodGen) classLiteral(n *Node) string {
+    owner, ok := this.gen.className(n.At(0))
+    if !ok {
+        this.errorf(n, compiler.ErrUnresolved, "cannot find class %s", qualifiedName(n.At(0)))
+        return this.invalid()
+    }
+    this.ldc(this.cf.Pool.Class(owner), 1)
+    return "Ljava/lang/Class;"
+}
+
+//
+// [a, b] is a new ArrayList, or a LinkedHashSet where a Set is expected,
+// e.g. Set s = [a, b]. There is no set literal of its own.
+//
+func (this *methodGen) listLiteral(n *Node, class string) string {
+    this.newObject(class)
+    this.invoke(class, "<init>", "()V", false, true)
+    for _, e := range n.Children {
+        this.op(classfile.DUP, 1)
+        this.exprAs(e, OBJECT)
+        this.invoke(class, "add", "(" + OBJECT + ")Z", false, false)
+        this.op(classfile.POP, -1)
+    }
+    return object(class)
+}
+
+// [a: 1] is a new LinkedHashMap, which keeps the order of the entries
+func (this *methodGen) mapLiteral(n *Node) string {
+    this.newObject(LINKED_HASH_MAP)
+    this.invoke(LINKED_HASH_MAP, "<init>", "()V", false, true)
+    for _, e := range n.Children {
+        this.op(classfile.DUP, 1)
+        this.exprAs(e.At(0), OBJECT)
+        this.exprAs(e.At(1), OBJECT)
+        this.invoke(LINKED_HASH_MAP, "put", "(" + OBJECT + OBJECT + ")" + OBJECT, false, false)
+        this.op(classfile.POP, -1)
+    }
+    return object(LINKED_HASH_MAP)
+}
+
+//
+// null-safe operators
+//
+
+// field or call n on the object of type t on the stack
+func (this *methodGen) memberOf(n *Node, t string) string {
+    if n.Name == "CALL" {
+        return this.callOn(n, t)
+    }
+    return this.fieldOf(n, t)
+}
+
+//
+// a?.b is null when a is null, else a.b boxed
+//
+func (this *methodGen) safeNav(n *Node) string {
+    access := n.At(0)
+    t := this.expr(access.At(0))
+    if t == ERROR || !isReference(t) {
+        return this.memberOf(access, t)
+    }
+    return this.nullSafeMemberOf(access, t)
+}
+
+//
+// field or call n on the object of type t on the stack, boxed, or null
+// when the object is null:
+//
+//     dup; ifnull isNull; .b; goto end; isNull: pop; aconst_null; end:
+//
+func (this *methodGen) nullSafeMemberOf(n *Node, t string) string {
+    isNull, end := this.newLabel(), this.newLabel()
+    this.op(classfile.DUP, 1)
+    this.jump(classfile.IFNULL, isNull, -1)
+    depth := this.depth
+    r := this.memberOf(n, t)
+    switch {
+        case r == VOID:
+            this.op(classfile.ACONST_NULL, 1)
+            r = OBJECT
+        case isPrimitive(r):
+            this.box(r)
+            r = boxed(r)
+    }
+    this.jumpTo(end)
+    this.bind(isNull)
+    this.depth = depth
+    this.op(classfile.POP, -1)
+    this.op(classfile.ACONST_NULL, 1)
+    this.bind(end)
+    return r
+}
+
+//
+// a ?: b is a unless a is null:
+//
+//     a; dup; ifnonnull end; pop; b; end:
+//
+func (this *methodGen) elvis(n *Node) string {
+    a, b := n.At(0), n.At(1)
+    ta := this.typeOf(a)
+    if !isReference(ta) || ta == NULL {
+        // never null
+        return this.expr(a)
+    }
+    t, tb := OBJECT, boxed(this.typeOf(b))
+    switch {
+        case tb == ERROR:
+            t = ERROR
+        case this.gen.assignable(tb, ta):
+            t = ta
+        case this.gen.assignable(ta, tb):
+            t = tb
+    }
+    end := this.newLabel()
+    this.exprAs(a, t)
+    this.op(classfile.DUP, 1)
+    this.jump(classfile.IFNONNULL, end, -1)
+    this.op(classfile.POP, -1)
+    this.exprAs(b, t)
+    this.bind(end)
+    return t
+}
+
+//
+// list*.b is the list of b of each element of an array or Iterable,
+// null when list is null. A null element gives a null b.
+// Elements of an Iterable are Objects.
+//
+func (this *methodGen) spread(n *Node) string {
+    access := n.At(0)
+    t := this.expr(access.At(0))
+    if t == ERROR { return ERROR }
+    iterable := this.gen.assignable(t, "Ljava/lang/Iterable;")
+    if !isArray(t) && !iterable || t == NULL {
+        this.errorf(n, compiler.ErrTypeMismatch, "cannot spread %s", typeName(t))
+        this.pop(t)
+        return this.invalid()
+    }
+    e := OBJECT
+    if isArray(t) { e = elementType(t) }
+    v := this.temp(e)
+    isNull, end := this.newLabel(), this.newLabel()
+    this.op(classfile.DUP, 1)
+    this.jump(classfile.IFNULL, isNull, -1)
+    depth := this.depth
+    this.newObject(ARRAY_LIST)
+    this.invoke(ARRAY_LIST, "<init>", "()V", false, true)
+    this.op(classfile.SWAP, 0)
+    this.each(n, t, v, this.newLabel(), this.newLabel(), func() {
+        this.op(classfile.DUP, 1)    // the list
+        this.load(e, v.slot)
+        if isReference(e) {
+            this.nullSafeMemberOf(access, e)
+        } else if r := this.memberOf(access, e); isPrimitive(r) {
+            this.box(r)
+        } else if r == VOID {
+            this.op(classfile.ACONST_NULL, 1)
+        }
+        this.invoke(ARRAY_LIST, "add", "(" + OBJECT + ")Z", false, false)
+        this.op(classfile.POP, -1)
+    })
+    this.jumpTo(end)
+    this.bind(isNull)
+    this.depth = depth
+    this.op(classfile.POP, -1)
+    this.op(classfile.ACONST_NULL, 1)
+    this.bind(end)
+    return object(ARRAY_LIST)
+}
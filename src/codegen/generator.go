@@ -0,0 +1,458 @@
+package codegen
+
+import "fmt"
+import "path"
+import "strings"
+import "classfile"
+import "compiler"
+import . "ast"
+
+//
+// Generator compiles the classes of one compilation unit to class
+// files. It runs after the parser and DesugarCaseClasses, and reports
+// what it cannot compile as diagnostics instead of stopping.
+//
+// Korat declarations are public unless declared private or protected.
+//
+type Generator struct {
+    file     string
+    pkg      string                 // internal package prefix, "a/b/" or ""
+    imported map[string]bool        // single type imports, qualified
+    onDemand []string               // packages imported with .*
+    classes  map[string]*classInfo  // classes of the unit by internal name
+    simple   map[string]string      // simple name to internal name
+    diags    *compiler.DiagnosticList
+    reported map[string]bool        // each error once, types are resolved more than once
+}
+
+func Generate(file string, unit *Node) ([]*classfile.ClassFile, []*compiler.Diagnostic) {
+    g := &Generator{
+        file:     file,
+        imported: map[string]bool{},
+        classes:  map[string]*classInfo{},
+        simple:   map[string]string{},
+        diags:    new(compiler.DiagnosticList),
+        reported: map[string]bool{},
+    }
+    classes := g.unit(unit)
+    return classes, g.diags.Items()
+}
+
+func (this *Generator) errorf(n *Node, code compiler.Error, format string, args...interface{}) {
+    span := Span{File: this.file}
+    if n != nil { span = n.Span }
+    msg := fmt.Sprintf(format, args...)
+    if key := span.String() + msg; !this.reported[key] {
+        this.reported[key] = true
+        this.diags.Errorf(code, span, "%s", msg)
+    }
+}
+
+func (this *Generator) unsupported(n *Node, what string) {
+    this.errorf(n, compiler.ErrUnsupported, "%s is not supported yet", what)
+}
+
+func (this *Generator) unit(unit *Node) []*classfile.ClassFile {
+    types := []*Node{}
+    for _, n := range unit.Children {
+        if n == nil { continue }
+        switch n.Name {
+            case "PACKAGE":
+                this.pkg = strings.Replace(n.At(0).Text, ".", "/", -1) + "/"
+            case "IMPORTS":
+                for _, i := range n.Children {
+                    this.importDecl(i)
+                }
+            case "CLASS", "CASE_CLASS", "INTERFACE":
+                types = append(types, n)
+            case "ERROR":
+            default:
+                this.unsupported(n, strings.ToLower(n.Name) + " declaration")
+        }
+    }
+    // names first, so that classes may refer to each other
+    for _, n := range types {
+        name := n.F("IDENT").Text
+        internal := this.pkg + name
+        this.simple[name] = internal
+        this.classes[internal] = &classInfo{name: internal, isInterface: n.Name == "INTERFACE"}
+    }
+    for _, n := range types {
+        this.declareMembers(n)
+    }
+    r := []*classfile.ClassFile{}
+    for _, n := range types {
+        r = append(r, this.class(n))
+    }
+    return r
+}
+
+func (this *Generator) importDecl(n *Node) {
+    if n == nil || n.Name != "IMPORT" {
+        if n != nil && n.Name == "IMPORT_STATIC" {
+            this.unsupported(n, "static import")
+        }
+        return
+    }
+    qname := n.At(0).Text
+    if strings.HasSuffix(qname, ".*") {
+        this.onDemand = append(this.onDemand, qname[0:len(qname)-2])
+    } else {
+        this.imported[qname] = true
+    }
+}
+
+func modifier(mods *Node, name string) bool {
+    if mods == nil { return false }
+    for _, m := range mods.Children {
+        if m.Name == name { return true }
+    }
+    return false
+}
+
+var accessFlags = map[string]int {
+    "PUBLIC":    classfile.ACC_PUBLIC,
+    "PRIVATE":   classfile.ACC_PRIVATE,
+    "PROTECTED": classfile.ACC_PROTECTED,
+    "STATIC":    classfile.ACC_STATIC,
+    "FINAL":     classfile.ACC_FINAL,
+    "ABSTRACT":  classfile.ACC_ABSTRACT,
+    "NATIVE":    classfile.ACC_NATIVE,
+    "SYNC":      classfile.ACC_SYNCHRONIZED,
+    "TRANSIENT": classfile.ACC_TRANSIENT,
+    "VOLATILE":  classfile.ACC_VOLATILE,
+    "STRICTFP":  classfile.ACC_STRICT,
+}
+
+// public unless private or protected
+func access(mods *Node) int {
+    flags := 0
+    if mods != nil {
+        for _, m := range mods.Children {
+            flags |= accessFlags[m.Name]
+        }
+    }
+    if flags & (classfile.ACC_PRIVATE | classfile.ACC_PROTECTED) == 0 {
+        flags |= classfile.ACC_PUBLIC
+    }
+    return flags
+}
+
+//
+// declareMembers records the fields, methods and constructors
+// of a class, so that calls can be resolved before it is compiled.
+//
+func (this *Generator) declareMembers(n *Node) {
+    info := this.classes[this.pkg + n.F("IDENT").Text]
+    info.super = "java/lang/Object"
+    if n.Name == "INTERFACE" {
+        info.super = ""
+        if ext := n.F("EXTENDS"); ext != nil {
+            for _, t := range ext.Children {
+                info.interfaces = append(info.interfaces, internalName(this.resolveType(t)))
+            }
+        }
+    } else if ext := n.F("EXTENDS"); ext != nil {
+        info.super = internalName(this.resolveType(ext.At(0)))
+    }
+    if impl := n.F("IMPLEMENTS"); impl != nil {
+        for _, t := range impl.Children {
+            info.interfaces = append(info.interfaces, internalName(this.resolveType(t)))
+        }
+    }
+    hasConstructor := false
+    for _, m := range n.F("MEMBERS").Children {
+        if m == nil { continue }
+        switch m.Name {
+            case "FIELD":
+                static := modifier(m.At(0), "STATIC") || n.Name == "INTERFACE"
+                t := this.resolveType(m.At(1))
+                for _, v := range m.Children[2:] {
+                    info.addField(v.Text, t, static)
+                }
+            case "METHOD", "INTERFACE_METHOD":
+                for i, desc := range this.overloads(m) {
+                    mi := info.addMethod(m.F("IDENT").Text, desc, modifier(m.At(0), "STATIC"))
+                    mi.private = modifier(m.At(0), "PRIVATE")
+                    if i == 0 { mi.decl = m }
+                }
+            case "CONSTRUCTOR":
+                hasConstructor = true
+                for i, desc := range this.overloads(m) {
+                    mi := info.addMethod("<init>", desc, false)
+                    if i == 0 { mi.decl = m }
+                }
+        }
+    }
+    if !hasConstructor && n.Name != "INTERFACE" {
+        info.addMethod("<init>", "()V", false)
+    }
+}
+
+//
+// overloads gives the descriptor of a method, then one more for each
+// trailing argument with a default value, leaving it out.
+//
+func (this *Generator) overloads(m *Node) []string {
+    params := this.paramTypes(m)
+    ret := VOID
+    if m.Name != "CONSTRUCTOR" {
+        ret = this.returnType(m)
+    }
+    args := m.F("ARGS").Children
+    r := []string{methodDescriptor(params, ret)}
+    for i := len(args) - 1; i >= 0 && args[i].F("DEFAULT") != nil; i-- {
+        r = append(r, methodDescriptor(params[0:i], ret))
+    }
+    return r
+}
+
+func (this *Generator) paramTypes(m *Node) []string {
+    params := []string{}
+    for _, a := range m.F("ARGS").Children {
+        t := this.resolveType(a.At(0))
+        if isMain(m) {
+            t = "[" + STRING
+        }
+        params = append(params, t)
+    }
+    return params
+}
+
+// static main(args) is the entry point, whatever type args is given
+func isMain(m *Node) bool {
+    return m.Name == "METHOD" && m.F("IDENT").Text == "main" &&
+           modifier(m.At(0), "STATIC") && len(m.F("ARGS").Children) == 1
+}
+
+//
+// returnType of a method: void for a method declared without one
+// unless it returns a value, then Object.
+//
+func (this *Generator) returnType(m *Node) string {
+    if m.At(1) != nil {
+        return this.resolveType(m.At(1))
+    }
+    if !isMain(m) && m.Name == "METHOD" && returnsValue(m.F("METHOD_BODY")) {
+        return OBJECT
+    }
+    return VOID
+}
+
+func returnsValue(n *Node) bool {
+    if n == nil { return false }
+    if n.Name == "RETURN" && len(n.Children) > 0 { return true }
+    for _, c := range n.Children {
+        if returnsValue(c) { return true }
+    }
+    return false
+}
+
+func (this *Generator) class(n *Node) *classfile.ClassFile {
+    internal := this.pkg + n.F("IDENT").Text
+    info := this.classes[internal]
+    this.annotations(n.At(0))
+    flags := access(n.At(0)) & (classfile.ACC_FINAL | classfile.ACC_ABSTRACT) | classfile.ACC_PUBLIC
+    if n.Name == "INTERFACE" {
+        flags |= classfile.ACC_INTERFACE | classfile.ACC_ABSTRACT
+    } else {
+        flags |= classfile.ACC_SUPER
+    }
+    super := info.super
+    if super == "" { super = "java/lang/Object" }
+    cf := classfile.NewClassFile(flags, internal, super)
+    cf.Major, cf.Hierarchy = classfile.JAVA_7, this
+    for _, i := range info.interfaces {
+        cf.AddInterface(i)
+    }
+    cf.SetSourceFile(path.Base(this.file))
+
+    var staticInit, instanceInit []*Node    // FIELD with initializers and INIT_BLOCK
+    constructors := []*Node{}
+    for _, m := range n.F("MEMBERS").Children {
+        if m == nil { continue }
+        switch m.Name {
+            case "FIELD":
+                this.field(cf, n, m)
+                if modifier(m.At(0), "STATIC") || n.Name == "INTERFACE" {
+                    staticInit = append(staticInit, m)
+                } else {
+                    instanceInit = append(instanceInit, m)
+                }
+            case "INIT_BLOCK":
+                if modifier(m.At(0), "STATIC") {
+                    staticInit = append(staticInit, m)
+                } else {
+                    instanceInit = append(instanceInit, m)
+                }
+            case "METHOD":
+                this.method(cf, info, m)
+            case "INTERFACE_METHOD":
+                this.abstractMethod(cf, n, m)
+            case "CONSTRUCTOR":
+                constructors = append(constructors, m)
+            case "ERROR":
+            default:
+                this.unsupported(m, "nested " + strings.ToLower(m.Name))
+        }
+    }
+    if n.Name != "INTERFACE" {
+        if len(constructors) == 0 {
+            this.defaultConstructor(cf, info, instanceInit)
+        }
+        for _, c := range constructors {
+            this.constructor(cf, info, c, instanceInit)
+        }
+    }
+    if len(staticInit) > 0 {
+        this.staticInitializer(cf, info, staticInit)
+    }
+    return cf
+}
+
+// annotations whose retention is SOURCE, which class files do without
+var sourceAnnotations = map[string]bool {
+    "Override":                   true,
+    "java.lang.Override":         true,
+    "SuppressWarnings":           true,
+    "java.lang.SuppressWarnings": true,
+}
+
+// reports the annotations in mods, MODIFIERS or ANNOTATIONS, that a class file would keep
+func (this *Generator) annotations(mods *Node) {
+    if mods == nil { return }
+    for _, a := range mods.Children {
+        if a.Name == "ANNOTATION" && !sourceAnnotations[a.Text] {
+            this.unsupported(a, "annotation @" + a.Text)
+        }
+    }
+}
+
+// the annotations of method m and of its arguments
+func (this *Generator) methodAnnotations(m *Node) {
+    this.annotations(m.At(0))
+    for _, a := range m.F("ARGS").Children {
+        this.annotations(a.At(2))
+    }
+}
+
+// the fields of an interface are constants, whatever their modifiers
+func (this *Generator) field(cf *classfile.ClassFile, class *Node, n *Node) {
+    this.annotations(n.At(0))
+    flags := access(n.At(0))
+    if class.Name == "INTERFACE" {
+        flags = classfile.ACC_PUBLIC | classfile.ACC_STATIC | classfile.ACC_FINAL
+    }
+    t := this.resolveType(n.At(1))
+    for _, v := range n.Children[2:] {
+        cf.AddField(flags, v.Text, t)
+    }
+}
+
+func (this *Generator) abstractMethod(cf *classfile.ClassFile, class *Node, m *Node) {
+    this.methodAnnotations(m)
+    flags := access(m.At(0)) | classfile.ACC_ABSTRACT
+    if class.Name != "INTERFACE" && !modifier(m.At(0), "NATIVE") && !modifier(class.At(0), "ABSTRACT") {
+        this.errorf(m, compiler.ErrMissingBody, "method %s has no body", m.F("IDENT").Text)
+    }
+    if modifier(m.At(0), "NATIVE") { flags &^= classfile.ACC_ABSTRACT }
+    cf.AddMethod(flags, m.F("IDENT").Text, methodDescriptor(this.paramTypes(m), this.returnType(m)))
+}
+
+func (this *Generator) method(cf *classfile.ClassFile, info *classInfo, m *Node) {
+    this.methodAnnotations(m)
+    flags := access(m.At(0))
+    static := flags & classfile.ACC_STATIC != 0
+    name := m.F("IDENT").Text
+    params, ret := this.paramTypes(m), this.returnType(m)
+    mi := cf.AddMethod(flags, name, methodDescriptor(params, ret))
+    g := this.newMethod(cf, info, mi, static, ret)
+    g.params(m.F("ARGS"), params)
+    g.body(m.F("METHOD_BODY"))
+    g.finish(m)
+    this.defaultOverloads(cf, info, m, flags, name, params, ret)
+}
+
+//
+// defaultOverloads writes, for f(int a, int b = 1), the method
+// f(int a) { return f(a, 1) }
+//
+func (this *Generator) defaultOverloads(cf *classfile.ClassFile, info *classInfo, m *Node, flags int, name string, params []string, ret string) {
+    args := m.F("ARGS").Children
+    static := flags & classfile.ACC_STATIC != 0
+    for n := len(args) - 1; n >= 0 && args[n].F("DEFAULT") != nil; n-- {
+        mi := cf.AddMethod(flags, name, methodDescriptor(params[0:n], ret))
+        g := this.newMethod(cf, info, mi, static, ret)
+        g.params(NewNode1("ARGS", args[0:n]), params[0:n])
+        if !static {
+            g.load(object(info.name), 0)
+        }
+        for i, a := range args {
+            if i < n {
+                g.load(params[i], g.lookup(a.At(1).Text).slot)
+            } else {
+                g.exprAs(a.F("DEFAULT").At(0), params[i])
+            }
+        }
+        special := name == "<init>" || flags & classfile.ACC_PRIVATE != 0
+        g.invoke(info.name, name, methodDescriptor(params, ret), static, special)
+        g.returnValue(ret)
+        g.finish(m)
+    }
+}
+
+func (this *Generator) constructor(cf *classfile.ClassFile, info *classInfo, c *Node, fieldInits []*Node) {
+    this.methodAnnotations(c)
+    flags := access(c.At(0))
+    params := this.paramTypes(c)
+    mi := cf.AddMethod(flags, "<init>", methodDescriptor(params, VOID))
+    g := this.newMethod(cf, info, mi, false, VOID)
+    g.params(c.F("ARGS"), params)
+    body := c.F("METHOD_BODY").Children
+    // this(...) or super(...) first, else super()
+    callsThis := false
+    if call := constructorCall(body); call != nil {
+        g.line(body[0])
+        g.constructorCall(call)
+        body = body[1:]
+        callsThis = call.Text == "this"
+    } else {
+        g.superCall(c)
+    }
+    // fields are initialized once, by the constructor calling super
+    if !callsThis {
+        g.initializers(fieldInits)
+    }
+    g.scope(func() {
+        for _, s := range body {
+            g.stmt(s)
+        }
+    })
+    g.finish(c)
+    this.defaultOverloads(cf, info, c, flags, "<init>", params, VOID)
+}
+
+// the CALL of this(...) or super(...) starting a constructor body
+func constructorCall(body []*Node) *Node {
+    if len(body) == 0 || body[0].Name != "STMT" { return nil }
+    call := body[0].At(0)
+    if call.Name == "CALL" && call.At(0) == nil && (call.Text == "this" || call.Text == "super") {
+        return call
+    }
+    return nil
+}
+
+func (this *Generator) defaultConstructor(cf *classfile.ClassFile, info *classInfo, fieldInits []*Node) {
+    mi := cf.AddMethod(classfile.ACC_PUBLIC, "<init>", "()V")
+    g := this.newMethod(cf, info, mi, false, VOID)
+    g.superCall(nil)
+    g.initializers(fieldInits)
+    g.finish(nil)
+}
+
+func (this *Generator) staticInitializer(cf *classfile.ClassFile, info *classInfo, inits []*Node) {
+    mi := cf.AddMethod(classfile.ACC_STATIC, "<clinit>", "()V")
+    g := this.newMethod(cf, info, mi, true, VOID)
+    g.initializers(inits)
+    g.finish(nil)
+}
@@ -0,0 +1,180 @@
+package codegen
+
+import "strings"
+import . "ast"
+
+type fieldInfo struct {
+    owner  string
+    name   string
+    desc   string
+    static bool
+}
+
+type methodInfo struct {
+    owner   string
+    name    string
+    desc    string
+    static  bool
+    private bool    // called with INVOKESPECIAL
+    params  []string
+    ret     string
+    decl    *Node   // the METHOD or CONSTRUCTOR declaring it, nil in the library
+}
+
+//
+// classInfo is what the generator knows of a class: the classes
+// of the unit being compiled, and the part of the JDK declared below.
+//
+type classInfo struct {
+    name        string      // internal name
+    super       string
+    interfaces  []string
+    isInterface bool
+    fields      []*fieldInfo
+    methods     []*methodInfo
+}
+
+func (this *classInfo) addField(name, desc string, static bool) *fieldInfo {
+    f := &fieldInfo{owner: this.name, name: name, desc: desc, static: static}
+    this.fields = append(this.fields, f)
+    return f
+}
+
+func (this *classInfo) addMethod(name, desc string, static bool) *methodInfo {
+    params, ret := parseDescriptor(desc)
+    m := &methodInfo{owner: this.name, name: name, desc: desc, static: static, params: params, ret: ret}
+    this.methods = append(this.methods, m)
+    return m
+}
+
+//
+// The JDK classes the generator knows of. A member is written as
+//
+//     [static] name(descriptor)      a method
+//     [static] name:type             a field
+//
+var library = map[string]*classInfo {}
+
+func class(name, super string, interfaces []string, members...string) {
+    c := &classInfo{name: name, super: super, interfaces: interfaces}
+    for _, m := range members {
+        static := strings.HasPrefix(m, "static ")
+        if static { m = m[len("static "):] }
+        if i := strings.Index(m, "("); i >= 0 {
+            c.addMethod(m[0:i], m[i:], static)
+        } else {
+            i = strings.Index(m, ":")
+            c.addField(m[0:i], m[i+1:], static)
+        }
+    }
+    library[name] = c
+}
+
+func iface(name string, supers []string, members...string) {
+    class(name, "", supers, members...)
+    library[name].isInterface = true
+}
+
+func init() {
+    class("java/lang/Object", "", nil,
+        "<init>()V", "toString()Ljava/lang/String;", "equals(Ljava/lang/Object;)Z",
+        "hashCode()I", "getClass()Ljava/lang/Class;")
+    class("java/lang/Class", "java/lang/Object", nil,
+        "getName()Ljava/lang/String;", "getSimpleName()Ljava/lang/String;")
+    iface("java/lang/Comparable", nil, "compareTo(Ljava/lang/Object;)I")
+    iface("java/lang/CharSequence", nil, "length()I", "charAt(I)C")
+    class("java/lang/String", "java/lang/Object", []string{"java/lang/CharSequence", "java/lang/Comparable"},
+        "<init>()V", "<init>([C)V",
+        "length()I", "charAt(I)C", "isEmpty()Z", "trim()Ljava/lang/String;",
+        "substring(I)Ljava/lang/String;", "substring(II)Ljava/lang/String;",
+        "indexOf(Ljava/lang/String;)I", "startsWith(Ljava/lang/String;)Z", "endsWith(Ljava/lang/String;)Z",
+        "contains(Ljava/lang/CharSequence;)Z", "concat(Ljava/lang/String;)Ljava/lang/String;",
+        "toUpperCase()Ljava/lang/String;", "toLowerCase()Ljava/lang/String;",
+        "split(Ljava/lang/String;)[Ljava/lang/String;", "toCharArray()[C",
+        "compareTo(Ljava/lang/String;)I", "equalsIgnoreCase(Ljava/lang/String;)Z",
+        "static valueOf(I)Ljava/lang/String;", "static valueOf(J)Ljava/lang/String;",
+        "static valueOf(F)Ljava/lang/String;", "static valueOf(D)Ljava/lang/String;",
+        "static valueOf(Z)Ljava/lang/String;", "static valueOf(C)Ljava/lang/String;",
+        "static valueOf(Ljava/lang/Object;)Ljava/lang/String;")
+    class("java/lang/StringBuilder", "java/lang/Object", []string{"java/lang/CharSequence"},
+        "<init>()V", "<init>(Ljava/lang/String;)V",
+        "append(I)Ljava/lang/StringBuilder;", "append(J)Ljava/lang/StringBuilder;",
+        "append(F)Ljava/lang/StringBuilder;", "append(D)Ljava/lang/StringBuilder;",
+        "append(Z)Ljava/lang/StringBuilder;", "append(C)Ljava/lang/StringBuilder;",
+        "append(Ljava/lang/String;)Ljava/lang/StringBuilder;",
+        "append(Ljava/lang/Object;)Ljava/lang/StringBuilder;",
+        "length()I", "reverse()Ljava/lang/StringBuilder;", "toString()Ljava/lang/String;")
+    class("java/lang/System", "java/lang/Object", nil,
+        "static out:Ljava/io/PrintStream;", "static err:Ljava/io/PrintStream;",
+        "static currentTimeMillis()J", "static nanoTime()J", "static exit(I)V",
+        "static getProperty(Ljava/lang/String;)Ljava/lang/String;")
+    class("java/io/PrintStream", "java/lang/Object", nil,
+        "println()V", "println(Z)V", "println(C)V", "println(I)V", "println(J)V",
+        "println(F)V", "println(D)V", "println(Ljava/lang/String;)V", "println(Ljava/lang/Object;)V",
+        "print(Z)V", "print(C)V", "print(I)V", "print(J)V",
+        "print(F)V", "print(D)V", "print(Ljava/lang/String;)V", "print(Ljava/lang/Object;)V")
+    class("java/lang/Math", "java/lang/Object", nil,
+        "static abs(I)I", "static abs(J)J", "static abs(D)D",
+        "static max(II)I", "static max(JJ)J", "static max(DD)D",
+        "static min(II)I", "static min(JJ)J", "static min(DD)D",
+        "static sqrt(D)D", "static pow(DD)D", "static floor(D)D", "static ceil(D)D",
+        "static random()D", "static PI:D", "static E:D")
+    class("java/util/Objects", "java/lang/Object", nil,
+        "static equals(Ljava/lang/Object;Ljava/lang/Object;)Z", "static hashCode(Ljava/lang/Object;)I",
+        "static toString(Ljava/lang/Object;)Ljava/lang/String;")
+
+    class("java/lang/Number", "java/lang/Object", nil,
+        "intValue()I", "longValue()J", "floatValue()F", "doubleValue()D")
+    for p, box := range boxes {
+        super := "java/lang/Number"
+        if p == BOOLEAN || p == CHAR { super = "java/lang/Object" }
+        class(box, super, []string{"java/lang/Comparable"},
+            unboxMethods[p] + "()" + p,
+            "static valueOf(" + p + ")" + object(box),
+            "static toString(" + p + ")Ljava/lang/String;",
+            "static compare(" + p + p + ")I")
+    }
+    library["java/lang/Integer"].addMethod("parseInt", "(Ljava/lang/String;)I", true)
+    library["java/lang/Long"].addMethod("parseLong", "(Ljava/lang/String;)J", true)
+    library["java/lang/Double"].addMethod("parseDouble", "(Ljava/lang/String;)D", true)
+    library["java/lang/Float"].addMethod("floatToIntBits", "(F)I", true)
+    library["java/lang/Double"].addMethod("doubleToLongBits", "(D)J", true)
+    library["java/lang/Integer"].addField("MAX_VALUE", INT, true)
+    library["java/lang/Integer"].addField("MIN_VALUE", INT, true)
+
+    class("java/lang/Throwable", "java/lang/Object", nil,
+        "<init>()V", "<init>(Ljava/lang/String;)V",
+        "getMessage()Ljava/lang/String;", "printStackTrace()V")
+    class("java/lang/Exception", "java/lang/Throwable", nil, "<init>()V", "<init>(Ljava/lang/String;)V")
+    class("java/lang/Error", "java/lang/Throwable", nil, "<init>()V", "<init>(Ljava/lang/String;)V")
+    class("java/lang/AssertionError", "java/lang/Error", nil, "<init>()V", "<init>(Ljava/lang/Object;)V")
+    class("java/lang/RuntimeException", "java/lang/Exception", nil, "<init>()V", "<init>(Ljava/lang/String;)V")
+    for _, e := range []string{"IllegalArgumentException", "IllegalStateException",
+                               "NullPointerException", "UnsupportedOperationException",
+                               "IndexOutOfBoundsException", "ArithmeticException",
+                               "ClassCastException"} {
+        class("java/lang/" + e, "java/lang/RuntimeException", nil, "<init>()V", "<init>(Ljava/lang/String;)V")
+    }
+    class("java/lang/NumberFormatException", "java/lang/IllegalArgumentException", nil,
+          "<init>()V", "<init>(Ljava/lang/String;)V")
+
+    iface("java/lang/Iterable", nil, "iterator()Ljava/util/Iterator;")
+    iface("java/util/Iterator", nil, "hasNext()Z", "next()Ljava/lang/Object;")
+    iface("java/util/Collection", []string{"java/lang/Iterable"},
+        "size()I", "isEmpty()Z", "add(Ljava/lang/Object;)Z",
+        "contains(Ljava/lang/Object;)Z", "remove(Ljava/lang/Object;)Z")
+    iface("java/util/List", []string{"java/util/Collection"},
+        "get(I)Ljava/lang/Object;", "set(ILjava/lang/Object;)Ljava/lang/Object;",
+        "indexOf(Ljava/lang/Object;)I")
+    iface("java/util/Set", []string{"java/util/Collection"})
+    iface("java/util/Map", nil,
+        "size()I", "isEmpty()Z", "get(Ljava/lang/Object;)Ljava/lang/Object;",
+        "put(Ljava/lang/Object;Ljava/lang/Object;)Ljava/lang/Object;",
+        "containsKey(Ljava/lang/Object;)Z", "keySet()Ljava/util/Set;",
+        "values()Ljava/util/Collection;")
+    class("java/util/ArrayList", "java/lang/Object", []string{"java/util/List"}, "<init>()V")
+    class("java/util/HashSet", "java/lang/Object", []string{"java/util/Set"}, "<init>()V")
+    class("java/util/LinkedHashSet", "java/util/HashSet", nil, "<init>()V")
+    class("java/util/HashMap", "java/lang/Object", []string{"java/util/Map"}, "<init>()V")
+    class("java/util/LinkedHashMap", "java/util/HashMap", nil, "<init>()V")
+}
@@ -0,0 +1,259 @@
+package codegen
+
+import "classfile"
+import "compiler"
+import . "ast"
+
+const (
+    ILLEGAL_STATE = "java/lang/IllegalStateException"
+    OBJECTS       = "[Ljava/lang/Object;"
+)
+
+//
+// match compiles s match { case p if g => ... } into a test of each
+// case in turn, its pattern then its guard. The value of a match is the
+// value of the last statement of the case taken, boxed, or null when it
+// is no expression. When no case matches, an IllegalStateException is
+// thrown.
+//
+func (this *methodGen) match(n *Node, value bool) string {
+    if len(n.Children) == 0 || n.At(0).Name == "CASE_CLAUSE" {
+        this.gen.unsupported(n, "a match without a subject")
+        if value { return this.invalid() }
+        return VOID
+    }
+    subject := n.At(0)
+    t := this.expr(subject)
+    switch t {
+        case VOID:
+            this.errorf(subject, compiler.ErrTypeMismatch, "a void expression has no value")
+            t = this.invalid()
+        case NULL, ERROR:
+            t = OBJECT
+    }
+    s := this.temp(boxed(t))
+    this.convert(subject, t, s.desc, false)
+    this.store(s.desc, s.slot)
+    var result *local = nil
+    if value {
+        result = this.temp(OBJECT)
+        this.op(classfile.ACONST_NULL, 1)
+        this.store(OBJECT, result.slot)
+    }
+
+    end := this.newLabel()
+    for _, c := range n.Children[1:] {
+        if c.Name != "CASE_CLAUSE" { continue }
+        next := this.newLabel()
+        this.line(c)
+        this.scope(func() {
+            this.pattern(c.At(0), s, t, next)
+            if g := c.F("GUARD"); g != nil {
+                this.branch(g.At(0), next, false)
+            }
+            this.caseBody(c.F("BLOCK"), result)
+        })
+        this.jumpTo(end)
+        this.bind(next)
+    }
+    if this.reachable {
+        this.newObject(ILLEGAL_STATE)
+        this.constant("no case matches")
+        this.invoke(ILLEGAL_STATE, "<init>", "(" + STRING + ")V", false, true)
+        this.op(classfile.ATHROW, -1)
+    }
+    this.bind(end)
+    if !value { return VOID }
+    this.load(OBJECT, result.slot)
+    return OBJECT
+}
+
+// the statements of a case, the value of the last one kept in result unless it is nil
+func (this *methodGen) caseBody(block *Node, result *local) {
+    stmts := block.Children
+    if result == nil || len(stmts) == 0 || stmts[len(stmts)-1].Name != "STMT" {
+        this.stmt(block)
+        return
+    }
+    last := stmts[len(stmts)-1]
+    this.scope(func() {
+        for _, s := range stmts[0:len(stmts)-1] {
+            this.stmt(s)
+        }
+        this.line(last)
+        e := last.At(0)
+        if t := this.typeOf(e); t == VOID {
+            this.exprStmt(e)
+            return
+        }
+        this.exprAs(e, OBJECT)
+        this.store(OBJECT, result.slot)
+    })
+}
+
+//
+// pattern tests the value in v against p, jumping to fail unless it
+// matches, and binds the names in p. A name is given type t, the type
+// of the value before it was boxed.
+//
+func (this *methodGen) pattern(p *Node, v *local, t string, fail *classfile.Label) {
+    switch p.Text {
+        case "wildcard":
+        case "bind":
+            x := this.declare(p.At(0).Text, t)
+            this.load(v.desc, v.slot)
+            this.convert(p, v.desc, t, true)
+            this.store(t, x.slot)
+        case "type":
+            this.typePattern(p, v, fail)
+        case "literal":
+            this.literalPattern(p, v, fail)
+        case "alternative":
+            ok := this.newLabel()
+            for i, a := range p.Children {
+                if binds(a) {
+                    this.errorf(a, compiler.ErrUnsupported, "an alternative cannot bind a name")
+                }
+                if i == len(p.Children) - 1 {
+                    this.pattern(a, v, t, fail)
+                    break
+                }
+                other := this.newLabel()
+                this.pattern(a, v, t, other)
+                this.jumpTo(ok)
+                this.bind(other)
+            }
+            this.bind(ok)
+        case "constructor":
+            this.constructorPattern(p, v, fail)
+    }
+}
+
+// whether pattern p binds a name
+func binds(p *Node) bool {
+    switch p.Text {
+        case "bind":
+            return true
+        case "type":
+            return len(p.Children) > 1
+    }
+    for _, c := range p.Children {
+        if c.Name == "PATTERN" && binds(c) { return true }
+    }
+    return false
+}
+
+// declares the names p binds, after an error in p, so that their uses raise none
+func (this *methodGen) bindInvalid(p *Node) {
+    switch p.Text {
+        case "bind":
+            this.declare(p.At(0).Text, ERROR)
+        case "type":
+            if len(p.Children) > 1 { this.declare(p.At(1).Text, ERROR) }
+    }
+    for _, c := range p.Children {
+        if c.Name == "PATTERN" { this.bindInvalid(c) }
+    }
+}
+
+// x: T matches an instance of T, or of its box for a primitive T
+func (this *methodGen) typePattern(p *Node, v *local, fail *classfile.Label) {
+    t := this.gen.resolveType(p.At(0))
+    if t == ERROR {
+        this.bindInvalid(p)
+        return
+    }
+    ref := boxed(t)
+    this.load(v.desc, v.slot)
+    this.op2(classfile.INSTANCEOF, this.cf.Pool.Class(internalName(ref)), 0)
+    this.jump(classfile.IFEQ, fail, -1)
+    if len(p.Children) > 1 {
+        x := this.declare(p.At(1).Text, t)
+        this.load(v.desc, v.slot)
+        this.convert(p, v.desc, ref, true)
+        this.convert(p, ref, t, false)
+        this.store(t, x.slot)
+    }
+}
+
+//
+// a literal matches an equal value: Objects.equals(v, literal), the
+// literal being converted first to the primitive type boxed in v
+//
+func (this *methodGen) literalPattern(p *Node, v *local, fail *classfile.Label) {
+    lit := p.At(0)
+    this.load(v.desc, v.slot)
+    if u := unboxed(v.desc); u != "" && isNumeric(this.typeOf(lit)) {
+        this.exprAs(lit, u)
+        this.convert(lit, u, v.desc, false)
+    } else {
+        this.exprAs(lit, OBJECT)
+    }
+    this.invoke("java/util/Objects", "equals", "(" + OBJECT + OBJECT + ")Z", true, false)
+    this.jump(classfile.IFEQ, fail, -1)
+}
+
+//
+// C(p1, p2) calls the extractor C.unapply(v), which gives the values
+// matched against p1 and p2 in an array, or null when v is no C.
+//
+func (this *methodGen) constructorPattern(p *Node, v *local, fail *classfile.Label) {
+    t := this.gen.resolveType(p.At(0))
+    if t == ERROR {
+        this.bindInvalid(p)
+        return
+    }
+    owner := internalName(t)
+    m := this.gen.findMethod(owner, "unapply", []string{OBJECT})
+    if m == nil || !m.static || m.ret != OBJECTS {
+        this.errorf(p, compiler.ErrUnresolved, "cannot find static Object[] unapply(Object) in %s", typeName(t))
+        this.bindInvalid(p)
+        return
+    }
+    subs := p.Children[1:]
+    values := this.temp(OBJECTS)
+    this.load(v.desc, v.slot)
+    this.invoke(m.owner, "unapply", m.desc, true, false)
+    this.store(OBJECTS, values.slot)
+    this.load(OBJECTS, values.slot)
+    this.jump(classfile.IFNULL, fail, -1)
+    this.load(OBJECTS, values.slot)
+    this.op(classfile.ARRAYLENGTH, 0)
+    this.iconst(len(subs))
+    this.jump(classfile.IF_ICMPNE, fail, -2)
+    for i, sub := range this.gen.components(m, len(subs)) {
+        e := this.temp(boxed(sub))
+        this.load(OBJECTS, values.slot)
+        this.iconst(i)
+        this.op(classfile.AALOAD, -1)
+        this.convert(p, OBJECT, e.desc, true)
+        this.store(e.desc, e.slot)
+        this.pattern(subs[i], e, sub, fail)
+    }
+}
+
+//
+// components gives the types of the n values extracted by unapply m:
+// those of the fields it returns, when it returns them in an array
+// initializer as the unapply of a case class does, else Object.
+//
+func (this *Generator) components(m *methodInfo, n int) []string {
+    types := make([]string, n)
+    for i := range types {
+        types[i] = OBJECT
+    }
+    if m.decl == nil { return types }
+    body := m.decl.F("METHOD_BODY").Children
+    if len(body) == 0 { return types }
+    ret := body[len(body)-1]
+    if ret.Name != "RETURN" || len(ret.Children) == 0 || ret.At(0).Name != "NEW_ARRAY" { return types }
+    init := ret.At(0).F("ARRAY_INIT")
+    if init == nil || len(init.Children) != n { return types }
+    for i, e := range init.Children {
+        if e.Name != "FIELD_ACCESS" { continue }
+        if f := this.findField(m.owner, e.Text); f != nil {
+            types[i] = f.desc
+        }
+    }
+    return types
+}
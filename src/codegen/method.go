@@ -0,0 +1,380 @@
+package codegen
+
+import "classfile"
+import "compiler"
+import . "ast"
+
+type local struct {
+    slot int
+    desc string
+}
+
+// the targets of break and continue in a loop, a switch or a labeled statement
+type jumpTarget struct {
+    label    string
+    brk      *classfile.Label
+    cont     *classfile.Label   // nil but for loops
+    block    bool               // a labeled statement, left only with break label
+    protects bool               // a try statement, its handlers cover the code in it
+    finally  *Node              // its finally block, run by any jump out of it
+    gaps     [][2]*classfile.Label  // copies of finally blocks which are not in it
+}
+
+//
+// methodGen is the state of the method being compiled: its locals,
+// the depth of the operand stack, and whether the next instruction
+// can be reached at all.
+//
+type methodGen struct {
+    gen       *Generator
+    cf        *classfile.ClassFile
+    class     *classInfo
+    code      *classfile.Code
+    static    bool
+    ret       string
+
+    scopes    []map[string]*local
+    next      int                   // next free local slot
+    maxLocals int
+    depth     int
+    maxDepth  int
+
+    reachable bool
+    targeted  map[*classfile.Label]bool
+    targets   []*jumpTarget
+    label     string                // label of the statement being compiled
+    lastLine  int
+}
+
+func (this *Generator) newMethod(cf *classfile.ClassFile, class *classInfo, m *classfile.Method, static bool, ret string) *methodGen {
+    g := &methodGen{
+        gen:       this,
+        cf:        cf,
+        class:     class,
+        code:      m.NewCode(),
+        static:    static,
+        ret:       ret,
+        scopes:    []map[string]*local{map[string]*local{}},
+        reachable: true,
+        targeted:  map[*classfile.Label]bool{},
+    }
+    if !static {
+        g.next, g.maxLocals = 1, 1  // this
+    }
+    return g
+}
+
+func (this *methodGen) errorf(n *Node, code compiler.Error, format string, args...interface{}) {
+    this.gen.errorf(n, code, format, args...)
+}
+
+func (this *methodGen) params(args *Node, types []string) {
+    for i, a := range args.Children {
+        this.declare(a.At(1).Text, types[i])
+    }
+}
+
+func (this *methodGen) body(n *Node) {
+    this.scope(func() {
+        for _, s := range n.Children {
+            this.stmt(s)
+        }
+    })
+}
+
+// finish ends the method, returning if the end can be reached.
+func (this *methodGen) finish(n *Node) {
+    if this.reachable {
+        if this.ret != VOID {
+            this.errorf(n, compiler.ErrMissingReturn, "missing return statement")
+        }
+        this.op(classfile.RETURN, 0)
+        this.reachable = false
+    }
+    this.code.MaxStack = this.maxDepth
+    this.code.MaxLocals = this.maxLocals
+}
+
+func (this *methodGen) line(n *Node) {
+    if n == nil || !n.Span.IsValid() || n.Span.Start.Line == this.lastLine { return }
+    this.lastLine = n.Span.Start.Line
+    this.code.Line(this.lastLine)
+}
+
+//
+// locals
+//
+
+func (this *methodGen) scope(body func()) {
+    next := this.next
+    this.scopes = append(this.scopes, map[string]*local{})
+    body()
+    this.scopes = this.scopes[0:len(this.scopes)-1]
+    this.next = next
+}
+
+func (this *methodGen) declare(name string, t string) *local {
+    l := this.temp(t)
+    this.scopes[len(this.scopes)-1][name] = l
+    return l
+}
+
+// an unnamed local, freed with the enclosing scope
+func (this *methodGen) temp(t string) *local {
+    l := &local{slot: this.next, desc: t}
+    this.next += size(t)
+    if this.next > this.maxLocals { this.maxLocals = this.next }
+    return l
+}
+
+func (this *methodGen) lookup(name string) *local {
+    for i := len(this.scopes) - 1; i >= 0; i-- {
+        if l, exists := this.scopes[i][name]; exists { return l }
+    }
+    return nil
+}
+
+//
+// instructions, keeping track of the stack depth
+//
+
+func (this *methodGen) stack(delta int) {
+    this.depth += delta
+    if this.depth > this.maxDepth { this.maxDepth = this.depth }
+}
+
+func (this *methodGen) op(op, delta int) {
+    this.code.Op(op)
+    this.stack(delta)
+    switch op {
+        case classfile.RETURN, classfile.IRETURN, classfile.LRETURN, classfile.FRETURN,
+             classfile.DRETURN, classfile.ARETURN, classfile.ATHROW:
+            this.reachable = false
+    }
+}
+
+func (this *methodGen) op1(op, v, delta int) {
+    this.code.Op1(op, v)
+    this.stack(delta)
+}
+
+func (this *methodGen) op2(op, v, delta int) {
+    this.code.Op2(op, v)
+    this.stack(delta)
+}
+
+func (this *methodGen) newLabel() *classfile.Label {
+    return this.code.NewLabel()
+}
+
+func (this *methodGen) jump(op int, l *classfile.Label, delta int) {
+    this.code.Jump(op, l)
+    this.stack(delta)
+    this.targeted[l] = true
+    if op == classfile.GOTO { this.reachable = false }
+}
+
+// goto l, unless the end of the code before cannot be reached anyway
+func (this *methodGen) jumpTo(l *classfile.Label) {
+    if this.reachable { this.jump(classfile.GOTO, l, 0) }
+}
+
+func (this *methodGen) bind(l *classfile.Label) {
+    this.code.Bind(l)
+    if this.targeted[l] { this.reachable = true }
+}
+
+func (this *methodGen) load(t string, slot int) {
+    op := classfile.ILOAD + kind(t)
+    if slot <= 3 {
+        this.op(classfile.ILOAD_0 + kind(t)*4 + slot, size(t))
+        return
+    }
+    this.code.Local(op, slot)
+    this.stack(size(t))
+}
+
+func (this *methodGen) store(t string, slot int) {
+    op := classfile.ISTORE + kind(t)
+    if slot <= 3 {
+        this.op(classfile.ISTORE_0 + kind(t)*4 + slot, -size(t))
+        return
+    }
+    this.code.Local(op, slot)
+    this.stack(-size(t))
+}
+
+func (this *methodGen) returnValue(t string) {
+    if t == VOID {
+        this.op(classfile.RETURN, 0)
+    } else {
+        this.op(classfile.IRETURN + kind(t), -size(t))
+    }
+}
+
+func (this *methodGen) pop(t string) {
+    switch size(t) {
+        case 1: this.op(classfile.POP, -1)
+        case 2: this.op(classfile.POP2, -2)
+    }
+}
+
+func (this *methodGen) dup(t string) {
+    switch size(t) {
+        case 1: this.op(classfile.DUP, 1)
+        case 2: this.op(classfile.DUP2, 2)
+    }
+}
+
+func (this *methodGen) iconst(v int) {
+    switch {
+        case v >= -1 && v <= 5:
+            this.op(classfile.ICONST_0 + v, 1)
+        case v >= -128 && v <= 127:
+            this.op1(classfile.BIPUSH, v, 1)
+        case v >= -32768 && v <= 32767:
+            this.op2(classfile.SIPUSH, v, 1)
+        default:
+            this.ldc(this.cf.Pool.Integer(int32(v)), 1)
+    }
+}
+
+func (this *methodGen) ldc(index int, n int) {
+    switch {
+        case n == 2:
+            this.op2(classfile.LDC2_W, index, 2)
+        case index > 0xFF:
+            this.op2(classfile.LDC_W, index, 1)
+        default:
+            this.op1(classfile.LDC, index, 1)
+    }
+}
+
+func (this *methodGen) newObject(class string) {
+    this.op2(classfile.NEW, this.cf.Pool.Class(class), 1)
+    this.op(classfile.DUP, 1)
+}
+
+//
+// invoke calls a method, with INVOKESPECIAL for constructors,
+// super calls and private methods.
+//
+func (this *methodGen) invoke(owner, name, desc string, static, special bool) {
+    params, ret := parseDescriptor(desc)
+    delta := size(ret)
+    for _, p := range params {
+        delta -= size(p)
+    }
+    pool := this.cf.Pool
+    info := this.gen.classInfo(owner)
+    switch {
+        case static:
+            this.op2(classfile.INVOKESTATIC, pool.MethodRef(owner, name, desc), delta)
+        case special:
+            this.op2(classfile.INVOKESPECIAL, pool.MethodRef(owner, name, desc), delta - 1)
+        case info != nil && info.isInterface:
+            n := 1
+            for _, p := range params {
+                n += size(p)
+            }
+            this.code.InvokeInterface(pool.InterfaceMethodRef(owner, name, desc), n)
+            this.stack(delta - 1)
+        default:
+            this.op2(classfile.INVOKEVIRTUAL, pool.MethodRef(owner, name, desc), delta - 1)
+    }
+}
+
+func (this *methodGen) invokeMethod(m *methodInfo, special bool) {
+    this.invoke(m.owner, m.name, m.desc, m.static, special)
+}
+
+func (this *methodGen) getField(f *fieldInfo) {
+    index := this.cf.Pool.FieldRef(f.owner, f.name, f.desc)
+    if f.static {
+        this.op2(classfile.GETSTATIC, index, size(f.desc))
+    } else {
+        this.op2(classfile.GETFIELD, index, size(f.desc) - 1)
+    }
+}
+
+func (this *methodGen) putField(f *fieldInfo) {
+    index := this.cf.Pool.FieldRef(f.owner, f.name, f.desc)
+    if f.static {
+        this.op2(classfile.PUTSTATIC, index, -size(f.desc))
+    } else {
+        this.op2(classfile.PUTFIELD, index, -size(f.desc) - 1)
+    }
+}
+
+func (this *methodGen) loadThis() {
+    this.load(object(this.class.name), 0)
+}
+
+// super() in a constructor without an explicit one
+func (this *methodGen) superCall(n *Node) {
+    this.loadThis()
+    if c := this.gen.classInfo(this.class.super); c != nil && this.gen.findMethod(c.name, "<init>", nil) == nil {
+        this.errorf(n, compiler.ErrUnresolved, "%s has no constructor without arguments", typeName(object(c.name)))
+    }
+    this.invoke(this.class.super, "<init>", "()V", false, true)
+}
+
+// this(...) or super(...)
+func (this *methodGen) constructorCall(call *Node) {
+    owner := this.class.name
+    if call.Text == "super" { owner = this.class.super }
+    args := call.At(1).Children
+    this.loadThis()
+    m := this.gen.findMethod(owner, "<init>", this.argTypes(args))
+    if m == nil {
+        if !this.badArguments(args) {
+            this.errorf(call, compiler.ErrUnresolved, "cannot find constructor %s(%s)", typeName(object(owner)), this.argList(args))
+        }
+        return
+    }
+    this.arguments(args, m.params)
+    this.invokeMethod(m, true)
+}
+
+// field initializers and initializer blocks, in order
+func (this *methodGen) initializers(inits []*Node) {
+    for _, n := range inits {
+        if n.Name == "INIT_BLOCK" {
+            this.stmt(n.At(1))
+            continue
+        }
+        for _, v := range n.Children[2:] {
+            if len(v.Children) == 0 { continue }
+            this.line(v)
+            f := this.gen.findField(this.class.name, v.Text)
+            if !f.static { this.loadThis() }
+            this.initializer(v.At(0), f.desc)
+            this.putField(f)
+        }
+    }
+}
+
+// an expression or an array initializer
+func (this *methodGen) initializer(n *Node, t string) {
+    if n.Name == "ARRAY_INIT" {
+        this.arrayInit(n, t)
+        return
+    }
+    this.exprAs(n, t)
+}
+
+//
+// typeOf gives the type of expression n without generating code:
+// n is compiled into a scratch method body, which is dropped.
+//
+func (this *methodGen) typeOf(n *Node) string {
+    saved := *this
+    diags, reported := this.gen.diags, this.gen.reported
+    this.gen.diags, this.gen.reported = new(compiler.DiagnosticList), map[string]bool{}
+    this.code = new(classfile.Code)
+    this.targeted = map[*classfile.Label]bool{}
+    t := this.expr(n)
+    this.gen.diags, this.gen.reported = diags, reported
+    *this = saved
+    return t
+}
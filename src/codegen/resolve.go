@@ -0,0 +1,248 @@
+package codegen
+
+import "strings"
+import "strconv"
+import "compiler"
+import . "ast"
+
+// the class called internal name, from the unit or the library
+func (this *Generator) classInfo(name string) *classInfo {
+    if c, exists := this.classes[name]; exists {
+        return c
+    }
+    return library[name]
+}
+
+//
+// SuperClass and IsInterface make the Generator the class hierarchy
+// of the frames computed for the classes it writes.
+//
+func (this *Generator) SuperClass(name string) (string, bool) {
+    c := this.classInfo(name)
+    switch {
+        case c == nil || name == "java/lang/Object":
+            return "", false
+        case c.super == "":
+            return "java/lang/Object", true
+    }
+    return c.super, true
+}
+
+func (this *Generator) IsInterface(name string) bool {
+    c := this.classInfo(name)
+    return c != nil && c.isInterface
+}
+
+//
+// resolveClass finds the internal name of a class written as name,
+// either qualified or simple: classes of the unit, single type
+// imports, on demand imports, then java.lang.
+//
+func (this *Generator) resolveClass(name string) (string, bool) {
+    if strings.Index(name, ".") >= 0 {
+        internal := strings.Replace(name, ".", "/", -1)
+        return internal, this.classInfo(internal) != nil || this.imported[name]
+    }
+    if internal, exists := this.simple[name]; exists {
+        return internal, true
+    }
+    for qname, _ := range this.imported {
+        if strings.HasSuffix(qname, "." + name) {
+            return strings.Replace(qname, ".", "/", -1), true
+        }
+    }
+    for _, pkg := range this.onDemand {
+        internal := strings.Replace(pkg, ".", "/", -1) + "/" + name
+        if this.classInfo(internal) != nil {
+            return internal, true
+        }
+    }
+    if library["java/lang/" + name] != nil {
+        return "java/lang/" + name, true
+    }
+    return name, false
+}
+
+//
+// resolveType gives the descriptor of a TYPE node. Type arguments
+// are erased.
+//
+func (this *Generator) resolveType(t *Node) string {
+    dims := 0
+    if d := t.F("DIM"); d != nil {
+        dims, _ = strconv.Atoi(d.Text)
+    }
+    if p, exists := primitives[t.Text]; exists {
+        if p == VOID && dims > 0 {
+            this.errorf(t, compiler.ErrTypeMismatch, "array of void")
+        }
+        return arrayOf(p, dims)
+    }
+    internal, found := this.resolveClass(t.Text)
+    if !found {
+        this.errorf(t, compiler.ErrUnresolved, "cannot find class %s", t.Text)
+        internal = "java/lang/Object"
+    }
+    return arrayOf(object(internal), dims)
+}
+
+// every supertype of class name, nearest first
+func (this *Generator) supertypes(name string) []string {
+    r := []string{}
+    seen := map[string]bool{}
+    todo := []string{name}
+    for len(todo) > 0 {
+        n := todo[0]
+        todo = todo[1:]
+        if seen[n] { continue }
+        seen[n] = true
+        r = append(r, n)
+        c := this.classInfo(n)
+        if c == nil { continue }
+        if c.super != "" { todo = append(todo, c.super) }
+        todo = append(todo, c.interfaces...)
+    }
+    if !seen["java/lang/Object"] {
+        r = append(r, "java/lang/Object")
+    }
+    return r
+}
+
+func (this *Generator) isSubclass(sub, super string) bool {
+    for _, s := range this.supertypes(sub) {
+        if s == super { return true }
+    }
+    return false
+}
+
+//
+// assignable tells whether a value of type from may be stored in
+// a variable of type to without a cast.
+//
+func (this *Generator) assignable(from, to string) bool {
+    switch {
+        case from == to || from == ERROR || to == ERROR:
+            return true
+        case isPrimitive(from) || isPrimitive(to):
+            return isPrimitive(from) && isPrimitive(to) && widens(from, to)
+        case from == NULL:
+            return true
+        case to == OBJECT:
+            return true
+        case isArray(from) && isArray(to):
+            f, t := elementType(from), elementType(to)
+            return isReference(f) && isReference(t) && this.assignable(f, t)
+        case isArray(from):
+            return to == "Ljava/lang/Cloneable;" || to == "Ljava/io/Serializable;"
+        case isArray(to):
+            return false
+    }
+    return this.isSubclass(internalName(from), internalName(to))
+}
+
+// true when t is a Set or a class of sets, e.g. HashSet, which a list is not
+func (this *Generator) isSet(t string) bool {
+    return this.assignable(object(LINKED_HASH_SET), t) && !this.assignable(object(ARRAY_LIST), t)
+}
+
+//
+// cost of passing a value of type from to a parameter of type to:
+// 0 for the same type, 1 for a widening, 2 for boxing or unboxing,
+// -1 when it cannot be passed.
+//
+func (this *Generator) cost(from, to string) int {
+    switch {
+        case from == to:
+            return 0
+        case this.assignable(from, to):
+            return 1
+        case isPrimitive(from) && isReference(to):
+            if this.assignable(boxed(from), to) { return 2 }
+        case isReference(from) && isPrimitive(to):
+            if p := unboxed(from); p != "" && (p == to || widens(p, to)) { return 2 }
+    }
+    return -1
+}
+
+// the field called name of class owner or one of its supertypes
+func (this *Generator) findField(owner, name string) *fieldInfo {
+    for _, s := range this.supertypes(owner) {
+        c := this.classInfo(s)
+        if c == nil { continue }
+        for _, f := range c.fields {
+            if f.name == name { return f }
+        }
+    }
+    return nil
+}
+
+//
+// findMethod picks the method called name of class owner taking args,
+// the one with the cheapest conversions, the nearest class first.
+//
+func (this *Generator) findMethod(owner, name string, args []string) *methodInfo {
+    var best *methodInfo
+    bestCost := -1
+    for _, s := range this.supertypes(owner) {
+        c := this.classInfo(s)
+        if c == nil { continue }
+        for _, m := range c.methods {
+            if m.name != name || len(m.params) != len(args) { continue }
+            total := 0
+            for i, p := range m.params {
+                k := this.cost(args[i], p)
+                if k < 0 { total = -1; break }
+                total += k
+            }
+            if total >= 0 && (best == nil || total < bestCost) {
+                best, bestCost = m, total
+            }
+        }
+        if name == "<init>" { break }    // constructors are not inherited
+    }
+    return best
+}
+
+// true when class owner declares a method called name
+func (this *Generator) hasMethod(owner, name string) bool {
+    for _, s := range this.supertypes(owner) {
+        if c := this.classInfo(s); c != nil {
+            for _, m := range c.methods {
+                if m.name == name { return true }
+            }
+        }
+    }
+    return false
+}
+
+// a class name written as an expression, e.g. Math or java.util.Objects
+func (this *Generator) className(n *Node) (string, bool) {
+    if n == nil { return "", false }
+    name := ""
+    switch n.Name {
+        case "TYPE":
+            return internalName(this.resolveType(n)), true
+        case "IDENT":
+            name = n.Text
+        case "FIELD_ACCESS":
+            prefix := qualifiedName(n.At(0))
+            if prefix == "" { return "", false }
+            name = prefix + "." + n.Text
+        default:
+            return "", false
+    }
+    return this.resolveClass(name)
+}
+
+// a.b.c for a chain of names, "" for anything else
+func qualifiedName(n *Node) string {
+    switch n.Name {
+        case "IDENT":
+            return n.Text
+        case "FIELD_ACCESS":
+            if prefix := qualifiedName(n.At(0)); prefix != "" {
+                return prefix + "." + n.Text
+            }
+    }
+    return ""
+}
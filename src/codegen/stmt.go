@@ -0,0 +1,633 @@
+package codegen
+
+import "strings"
+import "classfile"
+import "compiler"
+import . "ast"
+
+func (this *methodGen) stmt(n *Node) {
+    if n == nil { return }
+    // the label of a labeled loop, consumed here
+    label := this.label
+    this.label = ""
+    switch n.Name {
+        case "BLOCK":
+            this.scope(func() {
+                for _, s := range n.Children {
+                    this.stmt(s)
+                }
+            })
+            return
+        case "LABELED":
+            this.labeled(n)
+            return
+        case "EMPTY", "ERROR":
+            return
+    }
+    this.line(n)
+    switch n.Name {
+        case "LOCAL_VAR_DECL":
+            t := this.gen.resolveType(n.At(1))
+            for _, v := range n.Children[2:] {
+                if len(v.Children) == 0 {
+                    this.declare(v.Text, t)
+                    continue
+                }
+                this.initializer(v.At(0), t)
+                this.store(t, this.declare(v.Text, t).slot)
+            }
+        case "INFER_ASSIGN":
+            this.inferAssign(n.At(0), n.At(1))
+        case "ASSIGN":
+            // x = e assigns x, or declares it like x := e
+            name := n.At(0).Text
+            if this.lookup(name) == nil && this.gen.findField(this.class.name, name) == nil {
+                this.inferAssign(n.At(0), n.At(1))
+                return
+            }
+            if lv := this.lvalue(n.At(0)); lv != nil {
+                this.exprAs(n.At(1), lv.desc)
+                this.storeVar(lv)
+            }
+        case "STMT":
+            this.exprStmt(n.At(0))
+        case "IF":
+            this.ifStmt(n)
+        case "WHILE":
+            t := this.pushTarget(label, this.newLabel())
+            this.bind(t.cont)
+            this.branch(n.At(0), t.brk, false)
+            this.stmt(n.At(1))
+            this.jumpTo(t.cont)
+            this.popTarget()
+            this.bind(t.brk)
+        case "DO":
+            top := this.newLabel()
+            t := this.pushTarget(label, this.newLabel())
+            this.bind(top)
+            this.stmt(n.At(0))
+            this.bind(t.cont)
+            this.branch(n.At(1), top, true)
+            this.popTarget()
+            this.bind(t.brk)
+        case "FOR":
+            this.forStmt(n, label)
+        case "FOR_EACH":
+            this.forEach(n, label)
+        case "SWITCH":
+            this.switchStmt(n, label)
+        case "BREAK", "CONTINUE":
+            this.jumpOut(n)
+        case "RETURN":
+            this.returnStmt(n)
+        case "THROW":
+            this.exprAs(n.At(0), "Ljava/lang/Throwable;")
+            this.op(classfile.ATHROW, -1)
+        case "TRY":
+            this.tryStmt(n)
+        case "ASSERT":
+            this.assertStmt(n)
+        case "SYNCHRONIZED":
+            this.gen.unsupported(n, "a synchronized block")
+        case "MULTI_ASSIGN":
+            this.gen.unsupported(n, "a multiple assignment")
+        case "CLASS", "CASE_CLASS", "INTERFACE", "ENUM":
+            this.gen.unsupported(n, "a local " + strings.ToLower(n.Name))
+        default:
+            this.gen.unsupported(n, strings.ToLower(n.Name))
+    }
+}
+
+// x := e declares x with the type of e
+func (this *methodGen) inferAssign(name *Node, e *Node) {
+    t := this.expr(e)
+    switch t {
+        case VOID:
+            this.errorf(e, compiler.ErrTypeMismatch, "a void expression has no value")
+            t = this.invalid()
+        case NULL:
+            t = OBJECT
+    }
+    this.store(t, this.declare(name.Text, t).slot)
+}
+
+// an expression whose value is dropped
+func (this *methodGen) exprStmt(e *Node) {
+    switch e.Name {
+        case "ASSIGN_EXPR":
+            this.assign(e, false)
+        case "INC", "DEC", "POST_INC", "POST_DEC":
+            this.increment(e, false)
+        case "MATCH":
+            this.match(e, false)
+        default:
+            this.pop(this.expr(e))
+    }
+}
+
+func (this *methodGen) ifStmt(n *Node) {
+    elseLabel := this.newLabel()
+    this.branch(n.At(0), elseLabel, false)
+    this.stmt(n.At(1))
+    if len(n.Children) < 3 {
+        this.bind(elseLabel)
+        return
+    }
+    end := this.newLabel()
+    this.jumpTo(end)
+    this.bind(elseLabel)
+    this.stmt(n.At(2))
+    this.bind(end)
+}
+
+func (this *methodGen) returnStmt(n *Node) {
+    switch {
+        case len(n.Children) == 0:
+            if this.ret != VOID {
+                this.errorf(n, compiler.ErrMissingReturn, "missing return value")
+            }
+            this.leave(0, func() { this.returnValue(VOID) })
+        case this.ret == VOID:
+            this.errorf(n, compiler.ErrTypeMismatch, "cannot return a value from a void method")
+            this.pop(this.expr(n.At(0)))
+            this.leave(0, func() { this.returnValue(VOID) })
+        case !this.inFinally(0):
+            this.exprAs(n.At(0), this.ret)
+            this.returnValue(this.ret)
+        default:
+            // the value is kept aside while the finally blocks run
+            this.exprAs(n.At(0), this.ret)
+            v := this.temp(this.ret)
+            this.store(this.ret, v.slot)
+            this.leave(0, func() {
+                this.load(this.ret, v.slot)
+                this.returnValue(this.ret)
+            })
+    }
+}
+
+//
+// loops
+//
+
+func isLoop(n *Node) bool {
+    switch n.Name {
+        case "WHILE", "DO", "FOR", "FOR_EACH", "SWITCH":
+            return true
+    }
+    return false
+}
+
+func (this *methodGen) pushTarget(label string, cont *classfile.Label) *jumpTarget {
+    t := &jumpTarget{label: label, brk: this.newLabel(), cont: cont}
+    this.targets = append(this.targets, t)
+    return t
+}
+
+func (this *methodGen) popTarget() {
+    this.targets = this.targets[0:len(this.targets)-1]
+}
+
+// a loop or switch takes its label; any other statement can be left with break
+func (this *methodGen) labeled(n *Node) {
+    label, body := n.At(0).Text, n.At(1)
+    if isLoop(body) {
+        this.label = label
+        this.stmt(body)
+        return
+    }
+    t := this.pushTarget(label, nil)
+    t.block = true
+    this.stmt(body)
+    this.popTarget()
+    this.bind(t.brk)
+}
+
+func (this *methodGen) jumpOut(n *Node) {
+    label := ""
+    if len(n.Children) > 0 { label = n.At(0).Text }
+    for i := len(this.targets) - 1; i >= 0; i-- {
+        t := this.targets[i]
+        switch {
+            case t.protects:
+                continue
+            case label == "" && t.block:
+                continue
+            case label != "" && t.label != label:
+                continue
+            case n.Name == "BREAK":
+                this.leave(i + 1, func() { this.jumpTo(t.brk) })
+                return
+            case t.cont != nil:
+                this.leave(i + 1, func() { this.jumpTo(t.cont) })
+                return
+            case label != "":
+                this.errorf(n, compiler.ErrUnresolved, "%s is not the label of a loop", label)
+                return
+        }
+    }
+    switch {
+        case label != "":
+            this.errorf(n, compiler.ErrUnresolved, "undefined label %s", label)
+        case n.Name == "BREAK":
+            this.errorf(n, compiler.ErrUnresolved, "break outside of a loop or switch")
+        default:
+            this.errorf(n, compiler.ErrUnresolved, "continue outside of a loop")
+    }
+}
+
+func (this *methodGen) forStmt(n *Node, label string) {
+    init, cond, update, body := n.At(0), n.At(1), n.At(2), n.At(3)
+    this.scope(func() {
+        for _, i := range init.Children {
+            if i.Name == "LOCAL_VAR_DECL" || i.Name == "INFER_ASSIGN" {
+                this.stmt(i)
+            } else {
+                this.exprStmt(i)
+            }
+        }
+        top := this.newLabel()
+        t := this.pushTarget(label, this.newLabel())
+        this.bind(top)
+        if cond != nil {
+            this.branch(cond, t.brk, false)
+        }
+        this.stmt(body)
+        this.bind(t.cont)
+        for _, u := range update.Children {
+            this.exprStmt(u)
+        }
+        this.jumpTo(top)
+        this.popTarget()
+        this.bind(t.brk)
+    })
+}
+
+//
+// forEach loops over a range, an array or an Iterable. The variable
+// declared without a type is an int or long for a range, of the element
+// type for an array and Object for an Iterable.
+//
+func (this *methodGen) forEach(n *Node, label string) {
+    declared, name, iterable, body := n.At(1), n.At(2).Text, n.At(3), n.At(4)
+    this.scope(func() {
+        t := this.pushTarget(label, this.newLabel())
+        defer this.popTarget()
+        if iterable.Name == "RANGE" {
+            this.rangeLoop(n, t)
+            return
+        }
+        it := this.expr(iterable)
+        e := OBJECT
+        switch {
+            case it == ERROR:
+                return
+            case isArray(it):
+                e = elementType(it)
+            case !this.gen.assignable(it, "Ljava/lang/Iterable;") || it == NULL:
+                this.errorf(iterable, compiler.ErrTypeMismatch, "cannot iterate over %s", typeName(it))
+                this.pop(it)
+                return
+        }
+        if declared != compiler.DEFAULT_TYPE {
+            e = this.gen.resolveType(declared)
+        }
+        v := this.declare(name, e)
+        this.each(iterable, it, v, t.brk, t.cont, func() {
+            this.stmt(body)
+        })
+    })
+}
+
+//
+// each loops over the array or Iterable of type t on the stack, storing
+// each element in v before running body, then binds brk.
+//
+//     for (i = 0; i < a.length; i++) { v = a[i]; body }
+//     for (it = a.iterator(); it.hasNext();) { v = it.next(); body }
+//
+func (this *methodGen) each(n *Node, t string, v *local, brk, cont *classfile.Label, body func()) {
+    top := this.newLabel()
+    if isArray(t) {
+        e := elementType(t)
+        array, i := this.temp(t), this.temp(INT)
+        this.store(t, array.slot)
+        this.iconst(0)
+        this.store(INT, i.slot)
+        this.bind(top)
+        this.load(INT, i.slot)
+        this.load(t, array.slot)
+        this.op(classfile.ARRAYLENGTH, 0)
+        this.jump(classfile.IF_ICMPGE, brk, -2)
+        this.load(t, array.slot)
+        this.load(INT, i.slot)
+        this.op(arrayOpcode(classfile.IALOAD, e), size(e) - 2)
+        this.convert(n, e, v.desc, false)
+        this.store(v.desc, v.slot)
+        body()
+        this.bind(cont)
+        this.code.Iinc(i.slot, 1)
+        this.jumpTo(top)
+    } else {
+        iterator := this.temp("Ljava/util/Iterator;")
+        this.invoke("java/lang/Iterable", "iterator", "()" + iterator.desc, false, false)
+        this.store(iterator.desc, iterator.slot)
+        this.bind(top)
+        this.bind(cont)
+        this.load(iterator.desc, iterator.slot)
+        this.invoke("java/util/Iterator", "hasNext", "()Z", false, false)
+        this.jump(classfile.IFEQ, brk, -1)
+        this.load(iterator.desc, iterator.slot)
+        this.invoke("java/util/Iterator", "next", "()" + OBJECT, false, false)
+        this.convert(n, OBJECT, v.desc, false)
+        this.store(v.desc, v.slot)
+        body()
+        this.jumpTo(top)
+    }
+    this.bind(brk)
+}
+
+// for (i : a..b) counts from a to b, for (i : a..<b) stops before b
+func (this *methodGen) rangeLoop(n *Node, t *jumpTarget) {
+    declared, name, r, body := n.At(1), n.At(2).Text, n.At(3), n.At(4)
+    from, to := r.At(0), r.At(1)
+    ct := promote(numeric(this.typeOf(from)), numeric(this.typeOf(to)))
+    if declared != compiler.DEFAULT_TYPE {
+        ct = this.gen.resolveType(declared)
+    }
+    if ct != INT && ct != LONG {
+        this.errorf(r, compiler.ErrTypeMismatch, "a range of %s", typeName(ct))
+        return
+    }
+    v := this.declare(name, ct)
+    this.exprAs(from, ct)
+    this.store(ct, v.slot)
+    end := this.temp(ct)
+    this.exprAs(to, ct)
+    this.store(ct, end.slot)
+
+    top := this.newLabel()
+    this.bind(top)
+    this.load(ct, v.slot)
+    this.load(ct, end.slot)
+    exit := classfile.IF_ICMPGT
+    if r.Text == "..<" { exit = classfile.IF_ICMPGE }
+    if ct == LONG {
+        this.op(classfile.LCMP, -3)
+        this.jump(exit - classfile.IF_ICMPEQ + classfile.IFEQ, t.brk, -1)
+    } else {
+        this.jump(exit, t.brk, -2)
+    }
+    this.stmt(body)
+    this.bind(t.cont)
+    if ct == INT {
+        this.code.Iinc(v.slot, 1)
+    } else {
+        this.load(LONG, v.slot)
+        this.constant(int64(1))
+        this.arith("+", LONG)
+        this.store(LONG, v.slot)
+    }
+    this.jumpTo(top)
+    this.bind(t.brk)
+}
+
+//
+// switch on an int, a char, a short or a byte, with a TABLESWITCH when
+// the keys are dense, else a LOOKUPSWITCH
+//
+func (this *methodGen) switchStmt(n *Node, label string) {
+    e := n.At(0)
+    if t := numeric(this.typeOf(e)); !isIntLike(t) && t != ERROR {
+        this.gen.unsupported(e, "a switch on " + typeName(t))
+        return
+    }
+    this.exprAs(e, INT)
+    sw := this.pushTarget(label, nil)
+    dflt := sw.brk
+    keys := []int{}
+    targets := []*classfile.Label{}
+    groups := []*classfile.Label{}
+    seen := map[int]bool{}
+    for _, g := range n.Children[1:] {
+        l := this.newLabel()
+        groups = append(groups, l)
+        for _, c := range g.Children[0:len(g.Children)-1] {
+            if c.Name == "DEFAULT" {
+                dflt = l
+                continue
+            }
+            k, ok := constInt(c.At(0))
+            switch {
+                case !ok:
+                    this.errorf(c, compiler.ErrTypeMismatch, "a case label must be an int constant")
+                case seen[k]:
+                    this.errorf(c, compiler.ErrTypeMismatch, "duplicate case label %d", k)
+                default:
+                    seen[k] = true
+                    keys = append(keys, k)
+                    targets = append(targets, l)
+            }
+        }
+    }
+    // sort the keys, and their targets with them
+    for i := 1; i < len(keys); i++ {
+        for j := i; j > 0 && keys[j-1] > keys[j]; j-- {
+            keys[j-1], keys[j] = keys[j], keys[j-1]
+            targets[j-1], targets[j] = targets[j], targets[j-1]
+        }
+    }
+    if k := len(keys); k > 0 && keys[k-1] - keys[0] < 2*k {
+        table := make([]*classfile.Label, keys[k-1] - keys[0] + 1)
+        for i := range table {
+            table[i] = dflt
+        }
+        for i, k := range keys {
+            table[k - keys[0]] = targets[i]
+        }
+        this.code.TableSwitch(dflt, keys[0], table)
+    } else {
+        this.code.LookupSwitch(dflt, keys, targets)
+    }
+    this.stack(-1)
+    this.targeted[dflt] = true
+    for _, l := range targets {
+        this.targeted[l] = true
+    }
+    this.reachable = false
+
+    this.scope(func() {
+        for i, g := range n.Children[1:] {
+            this.bind(groups[i])
+            for _, s := range g.Children[len(g.Children)-1].Children {
+                this.stmt(s)
+            }
+        }
+    })
+    this.popTarget()
+    this.bind(sw.brk)
+}
+
+//
+// try with catch clauses and a finally block. A handler covers the code
+// of the try block, and starts with the exception on the stack. As javac
+// does, the finally block is copied at the end of the try block and of
+// each catch clause, before each jump out of them, and into a last
+// handler which runs it for any other exception, then throws that again.
+//
+func (this *methodGen) tryStmt(n *Node) {
+    catches := n.Children[1:]
+    try := &jumpTarget{protects: true}
+    if last := catches[len(catches)-1]; last.Name == "FINALLY" {
+        catches = catches[0:len(catches)-1]
+        try.finally = last.At(0)
+    }
+    this.targets = append(this.targets, try)
+    start, end, after := this.newLabel(), this.newLabel(), this.newLabel()
+    this.bind(start)
+    this.stmt(n.At(0))
+    this.bind(end)
+    empty := start.Offset() == end.Offset()
+    this.runFinally(try)
+    this.jumpTo(after)
+    // what the handler running the finally block covers
+    covered := [][2]*classfile.Label{{start, end}}
+    for _, c := range catches {
+        errors := this.gen.diags.Len()
+        t := this.gen.resolveType(c.At(1))
+        if this.gen.diags.Len() == errors && !this.gen.assignable(t, "Ljava/lang/Throwable;") {
+            this.errorf(c.At(1), compiler.ErrTypeMismatch, "%s is not a Throwable", typeName(t))
+        }
+        handler, handlerEnd := this.newLabel(), this.newLabel()
+        this.bind(handler)
+        if !empty {
+            this.protect(try, start, end, handler, internalName(t))
+            this.reachable = true
+        }
+        this.depth = 0
+        this.stack(1)
+        this.line(c)
+        this.scope(func() {
+            this.store(t, this.declare(c.At(2).Text, t).slot)
+            this.stmt(c.At(3))
+        })
+        this.bind(handlerEnd)
+        covered = append(covered, [2]*classfile.Label{handler, handlerEnd})
+        this.runFinally(try)
+        this.jumpTo(after)
+    }
+    this.popTarget()
+    if try.finally != nil {
+        rethrow := this.newLabel()
+        this.bind(rethrow)
+        for _, r := range covered {
+            if this.protect(try, r[0], r[1], rethrow, "") { this.reachable = true }
+        }
+        if this.reachable {
+            this.depth = 0
+            this.stack(1)
+            this.scope(func() {
+                e := this.temp("Ljava/lang/Throwable;")
+                this.store(e.desc, e.slot)
+                this.stmt(try.finally)
+                this.load(e.desc, e.slot)
+                this.op(classfile.ATHROW, -1)
+            })
+        }
+    }
+    this.bind(after)
+}
+
+//
+// protect adds a handler of try for the code from start to end but for
+// its gaps, if there is any code left.
+//
+func (this *methodGen) protect(try *jumpTarget, start, end, handler *classfile.Label, catchType string) bool {
+    ranges := [][2]*classfile.Label{{start, end}}
+    for _, g := range try.gaps {
+        split := [][2]*classfile.Label{}
+        for _, r := range ranges {
+            if g[1].Offset() <= r[0].Offset() || g[0].Offset() >= r[1].Offset() {
+                split = append(split, r)
+                continue
+            }
+            split = append(split, [2]*classfile.Label{r[0], g[0]}, [2]*classfile.Label{g[1], r[1]})
+        }
+        ranges = split
+    }
+    added := false
+    for _, r := range ranges {
+        if r[0].Offset() < r[1].Offset() {
+            this.code.AddHandler(r[0], r[1], handler, catchType)
+            added = true
+        }
+    }
+    return added
+}
+
+// the finally block of try, if any, at the end of its try block or a catch clause
+func (this *methodGen) runFinally(try *jumpTarget) {
+    if try.finally == nil || !this.reachable { return }
+    saved := this.targets
+    this.targets = this.targets[0:len(this.targets)-1]
+    this.stmt(try.finally)
+    this.targets = saved
+}
+
+// whether a jump out of targets[i:] leaves a try with a finally block
+func (this *methodGen) inFinally(i int) bool {
+    for _, t := range this.targets[i:] {
+        if t.finally != nil { return true }
+    }
+    return false
+}
+
+//
+// leave runs jump out of targets[i:] after the finally blocks it leaves,
+// the innermost first. The handlers of a try statement do not cover the
+// code from the first finally block run outside it up to the jump.
+//
+func (this *methodGen) leave(i int, jump func()) {
+    saved := this.targets
+    left := []*jumpTarget{}
+    starts := []*classfile.Label{}
+    for k := len(saved) - 1; k >= i && this.reachable; k-- {
+        t := saved[k]
+        if t.protects {
+            left, starts = append(left, t), append(starts, nil)
+        }
+        if t.finally == nil { continue }
+        l := this.newLabel()
+        this.bind(l)
+        for j := range starts {
+            if starts[j] == nil { starts[j] = l }
+        }
+        this.targets = saved[0:k]
+        this.stmt(t.finally)
+    }
+    this.targets = saved
+    if this.reachable { jump() }
+    end := this.newLabel()
+    this.bind(end)
+    for j, t := range left {
+        if starts[j] != nil {
+            t.gaps = append(t.gaps, [2]*classfile.Label{starts[j], end})
+        }
+    }
+}
+
+// assert c : m throws an AssertionError unless c; asserts are always on
+func (this *methodGen) assertStmt(n *Node) {
+    const ASSERTION_ERROR = "java/lang/AssertionError"
+    ok := this.newLabel()
+    this.branch(n.At(0), ok, true)
+    this.newObject(ASSERTION_ERROR)
+    if len(n.Children) > 1 {
+        this.exprAs(n.At(1), OBJECT)
+        this.invoke(ASSERTION_ERROR, "<init>", "(" + OBJECT + ")V", false, true)
+    } else {
+        this.invoke(ASSERTION_ERROR, "<init>", "()V", false, true)
+    }
+    this.op(classfile.ATHROW, -1)
+    this.bind(ok)
+}
@@ -0,0 +1,209 @@
+package codegen
+
+import "strings"
+
+//
+// Types are JVM descriptors: I, J, Ljava/lang/String;, [I ...
+// NULL is the type of the null literal, ERROR that of an expression
+// which could not be compiled: it converts to anything silently, so
+// that one mistake is reported once.
+//
+const (
+    VOID    = "V"
+    BOOLEAN = "Z"
+    BYTE    = "B"
+    CHAR    = "C"
+    SHORT   = "S"
+    INT     = "I"
+    LONG    = "J"
+    FLOAT   = "F"
+    DOUBLE  = "D"
+    NULL    = "null"
+    ERROR   = "<error>"
+
+    OBJECT  = "Ljava/lang/Object;"
+    STRING  = "Ljava/lang/String;"
+)
+
+var primitives = map[string]string {
+    "void":    VOID,
+    "boolean": BOOLEAN,
+    "byte":    BYTE,
+    "char":    CHAR,
+    "short":   SHORT,
+    "int":     INT,
+    "long":    LONG,
+    "float":   FLOAT,
+    "double":  DOUBLE,
+}
+
+// the class boxing each primitive type
+var boxes = map[string]string {
+    BOOLEAN: "java/lang/Boolean",
+    BYTE:    "java/lang/Byte",
+    CHAR:    "java/lang/Character",
+    SHORT:   "java/lang/Short",
+    INT:     "java/lang/Integer",
+    LONG:    "java/lang/Long",
+    FLOAT:   "java/lang/Float",
+    DOUBLE:  "java/lang/Double",
+}
+
+var unboxMethods = map[string]string {
+    BOOLEAN: "booleanValue",
+    BYTE:    "byteValue",
+    CHAR:    "charValue",
+    SHORT:   "shortValue",
+    INT:     "intValue",
+    LONG:    "longValue",
+    FLOAT:   "floatValue",
+    DOUBLE:  "doubleValue",
+}
+
+func object(internal string) string {
+    return "L" + internal + ";"
+}
+
+func arrayOf(t string, dims int) string {
+    return strings.Repeat("[", dims) + t
+}
+
+func isPrimitive(t string) bool {
+    return len(t) == 1 && t != VOID
+}
+
+func isReference(t string) bool {
+    return t == NULL || t[0] == 'L' || t[0] == '['
+}
+
+func isArray(t string) bool {
+    return t[0] == '['
+}
+
+func isWide(t string) bool {
+    return t == LONG || t == DOUBLE
+}
+
+// boolean is not numeric
+func isNumeric(t string) bool {
+    return isPrimitive(t) && t != BOOLEAN
+}
+
+// int, short, byte and char compute as int
+func isIntLike(t string) bool {
+    return t == INT || t == SHORT || t == BYTE || t == CHAR
+}
+
+func elementType(t string) string {
+    return t[1:]
+}
+
+// the internal name of a class type, Ljava/lang/String; -> java/lang/String
+func internalName(t string) string {
+    if t[0] == 'L' { return t[1:len(t)-1] }
+    return t    // arrays are their own internal name
+}
+
+// the stack slots taken by a value of type t
+func size(t string) int {
+    switch {
+        case t == VOID:  return 0
+        case isWide(t):  return 2
+    }
+    return 1
+}
+
+//
+// kind is the offset of t in the families of typed opcodes,
+// as in ILOAD, LLOAD, FLOAD, DLOAD, ALOAD.
+//
+func kind(t string) int {
+    switch t {
+        case LONG:   return 1
+        case FLOAT:  return 2
+        case DOUBLE: return 3
+    }
+    if isReference(t) { return 4 }
+    return 0
+}
+
+// the box of a primitive type, t itself for references
+func boxed(t string) string {
+    if box, exists := boxes[t]; exists {
+        return object(box)
+    }
+    return t
+}
+
+// the primitive type boxed by t, "" if t is not a box
+func unboxed(t string) string {
+    for p, box := range boxes {
+        if t == object(box) { return p }
+    }
+    return ""
+}
+
+//
+// binary numeric promotion: the type both operands of
+// an arithmetic operator are converted to
+//
+func promote(a, b string) string {
+    switch {
+        case a == DOUBLE || b == DOUBLE: return DOUBLE
+        case a == FLOAT  || b == FLOAT:  return FLOAT
+        case a == LONG   || b == LONG:   return LONG
+    }
+    return INT
+}
+
+// primitive widening, byte < short < int < long < float < double
+var widening = map[string]string {
+    BYTE:  "SIJFD",
+    SHORT: "IJFD",
+    CHAR:  "IJFD",
+    INT:   "JFD",
+    LONG:  "FD",
+    FLOAT: "D",
+}
+
+func widens(from, to string) bool {
+    return strings.Index(widening[from], to) >= 0
+}
+
+//
+// parseDescriptor splits a method descriptor into the types
+// of its parameters and its return type.
+//
+func parseDescriptor(desc string) (params []string, ret string) {
+    i := 1
+    for desc[i] != ')' {
+        start := i
+        for desc[i] == '[' { i++ }
+        if desc[i] == 'L' {
+            i = i + strings.Index(desc[i:], ";")
+        }
+        i++
+        params = append(params, desc[start:i])
+    }
+    return params, desc[i+1:]
+}
+
+func methodDescriptor(params []string, ret string) string {
+    return "(" + strings.Join(params, "") + ")" + ret
+}
+
+// java.lang.String for Ljava/lang/String;, int[] for [I
+func typeName(t string) string {
+    switch {
+        case t == NULL:
+            return "null"
+        case isArray(t):
+            return typeName(elementType(t)) + "[]"
+        case t[0] == 'L':
+            return strings.Replace(internalName(t), "/", ".", -1)
+    }
+    for name, p := range primitives {
+        if p == t { return name }
+    }
+    return t
+}
@@ -0,0 +1,528 @@
+package compiler
+
+import . "ast"
+import "strconv"
+
+//
+// DesugarCaseClasses turns every case class with a primary parameter
+// list into an ordinary class body.
+//
+//     case class Point(int x, int y = 0)
+//
+// gets, for each parameter, a private final field and a getter, plus
+//
+//     public Point(int x, int y = 0)
+//     public boolean equals(Object o)
+//     public int hashCode()
+//     public String toString()               // "Point(1, 2)"
+//     public Point copy(int x = getX(), int y = getY())
+//     public static Object[] unapply(Object o)
+//
+// unapply is the extractor behind constructor patterns: it returns the
+// field values, or null when o is not a Point. Members written by hand
+// are kept and not generated again.
+//
+// Finally calls with named arguments to a class of the unit, e.g.
+// new Point(y = 1, x = 2), are rewritten into positional calls (see
+// resolveNamedArguments).
+//
+func DesugarCaseClasses(unit *Node) *Node {
+    if unit == nil { return nil }
+    walk(unit, func(n *Node) {
+        if n.Name == "CASE_CLASS" && n.F("ARGS") != nil {
+            desugarCaseClass(n)
+        }
+    })
+    resolveNamedArguments(unit)
+    return unit
+}
+
+// walk calls visit on n and all of its descendants, parents first
+func walk(n *Node, visit func(*Node)) {
+    if n == nil { return }
+    visit(n)
+    for _, c := range n.Children {
+        walk(c, visit)
+    }
+}
+
+func desugarCaseClass(n *Node) {
+    name := n.F("IDENT").Text
+    params := n.F("ARGS").Children
+    members := n.F("MEMBERS")
+    declared := members.Children
+
+    generated := []*Node{}
+    for _, p := range params {
+        f := paramName(p)
+        generated = append(generated, stamp(NewNode0("FIELD",
+            modifierList("PRIVATE", "FINAL"),
+            clone(p.At(0)),
+            NewNode2("VAR", f)), p.Span))
+    }
+    if !declares(declared, "CONSTRUCTOR", name, len(params)) {
+        generated = append(generated, caseClassConstructor(name, params))
+    }
+    for _, p := range params {
+        if !declares(declared, "METHOD", getter(paramName(p)), 0) {
+            generated = append(generated, stamp(caseClassGetter(p), p.Span))
+        }
+    }
+
+    synthesized := []struct {
+        name  string
+        arity int
+        build func(string, []*Node) *Node
+    }{
+        {"equals",   1,           caseClassEquals},
+        {"hashCode", 0,           caseClassHashCode},
+        {"toString", 0,           caseClassToString},
+        {"copy",     len(params), caseClassCopy},
+        {"unapply",  1,           caseClassUnapply},
+    }
+    for _, s := range synthesized {
+        if !declares(declared, "METHOD", s.name, s.arity) {
+            generated = append(generated, s.build(name, params))
+        }
+    }
+
+    span := n.F("IDENT").Span
+    for _, g := range generated {
+        stamp(g, span)
+    }
+    members.Children = append(generated, declared...)
+
+    // the primary parameters now live in the members
+    children := []*Node{}
+    for _, c := range n.Children {
+        if c.Name != "ARGS" { children = append(children, c) }
+    }
+    n.Children = children
+}
+
+// a METHOD or CONSTRUCTOR called name with arity arguments
+func declares(members []*Node, kind string, name string, arity int) bool {
+    for _, m := range members {
+        if m == nil || m.Name != kind { continue }
+        if m.F("IDENT").Text == name && len(m.F("ARGS").Children) == arity {
+            return true
+        }
+    }
+    return false
+}
+
+func paramName(p *Node) string {
+    return p.At(1).Text
+}
+
+func isPrimitive(t *Node) bool {
+    return t.F("DIM") == nil && boxes[t.Text] != ""
+}
+
+var boxes = map[string]string {
+    "boolean": "java.lang.Boolean",
+    "byte":    "java.lang.Byte",
+    "char":    "java.lang.Character",
+    "short":   "java.lang.Short",
+    "int":     "java.lang.Integer",
+    "long":    "java.lang.Long",
+    "float":   "java.lang.Float",
+    "double":  "java.lang.Double",
+}
+
+// x -> getX
+func getter(field string) string {
+    if len(field) == 0 { return "get" }
+    first := field[0:1]
+    if first[0] >= 'a' && first[0] <= 'z' {
+        first = string(first[0] - 'a' + 'A')
+    }
+    return "get" + first + field[1:]
+}
+
+// public Point(int x, int y) { this.x = x; this.y = y }
+func caseClassConstructor(name string, params []*Node) *Node {
+    args := []*Node{}
+    body := []*Node{}
+    for _, p := range params {
+        f := paramName(p)
+        args = append(args, clone(p))
+        body = append(body, NewNode0("STMT",
+            NewNode3("ASSIGN_EXPR", "=", thisField(f), ident(f))))
+    }
+    return NewNode0("CONSTRUCTOR",
+        modifierList("PUBLIC"),
+        ident(name),
+        NewNode1("ARGS", args),
+        NewNode1("METHOD_BODY", body))
+}
+
+// public int getX() { return this.x }
+func caseClassGetter(p *Node) *Node {
+    f := paramName(p)
+    return method(modifierList("PUBLIC"), clone(p.At(0)), getter(f), nil,
+        NewNode0("RETURN", thisField(f)))
+}
+
+//
+// public boolean equals(Object o) {
+//     if (this == o) return true
+//     if (!(o instanceof Point)) return false
+//     Point that = (Point) o
+//     return this.x == that.x && Objects.equals(this.name, that.name)
+// }
+//
+func caseClassEquals(name string, params []*Node) *Node {
+    body := []*Node{
+        NewNode0("IF", NewNode3("BIN_OP", "==", NewNode0("THIS"), ident("o")),
+            NewNode0("RETURN", boolLiteral(true))),
+        NewNode0("IF", NewNode0("NOT", NewNode0("INSTANCE_OF", ident("o"), typeNode(name))),
+            NewNode0("RETURN", boolLiteral(false))),
+    }
+    var same *Node = nil
+    for _, p := range params {
+        f := paramName(p)
+        e := sameValue(p.At(0), thisField(f), NewNode3("FIELD_ACCESS", f, ident("that")))
+        if same == nil {
+            same = e
+        } else {
+            same = NewNode3("BIN_OP", "&&", same, e)
+        }
+    }
+    if same == nil {
+        same = boolLiteral(true)
+    } else {
+        body = append(body, NewNode1("LOCAL_VAR_DECL", []*Node{
+            NewNode0("MODIFIERS"),
+            typeNode(name),
+            NewNode3("VAR", "that", NewNode0("CAST", typeNode(name), ident("o"))),
+        }))
+    }
+    body = append(body, NewNode0("RETURN", same))
+    return method(modifierList("PUBLIC"), typeNode("boolean"), "equals",
+        []*Node{arg(typeNode("java.lang.Object"), "o")}, body...)
+}
+
+// primitives compare with ==, floating point through compare so that NaN equals NaN
+func sameValue(t *Node, a *Node, b *Node) *Node {
+    switch {
+        case isPrimitive(t) && (t.Text == "float" || t.Text == "double"):
+            cmp := call("compare", typeNode(boxes[t.Text]), a, b)
+            return NewNode3("BIN_OP", "==", cmp, intLiteral(0))
+        case isPrimitive(t):
+            return NewNode3("BIN_OP", "==", a, b)
+    }
+    return call("equals", typeNode("java.util.Objects"), a, b)
+}
+
+//
+// public int hashCode() { return (17 * 31 + this.x) * 31 + Objects.hashCode(this.name) }
+//
+// Primitives hash as their boxes do. The hashCode(x) methods of the
+// boxes are Java 8, so their computation is written out.
+//
+func caseClassHashCode(name string, params []*Node) *Node {
+    h := intLiteral(17)
+    for _, p := range params {
+        fieldHash := valueHash(p.At(0), thisField(paramName(p)))
+        h = NewNode3("BIN_OP", "+", NewNode3("BIN_OP", "*", h, intLiteral(31)), fieldHash)
+    }
+    return method(modifierList("PUBLIC"), typeNode("int"), "hashCode", nil,
+        NewNode0("RETURN", h))
+}
+
+// the hash of v, of type t
+func valueHash(t *Node, v *Node) *Node {
+    if !isPrimitive(t) {
+        return call("hashCode", typeNode("java.util.Objects"), v)
+    }
+    switch t.Text {
+        case "boolean":
+            return NewNode0("TERNARY", v, intLiteral(1231), intLiteral(1237))
+        case "long":
+            return longHash(v, clone(v))
+        case "float":
+            return call("floatToIntBits", typeNode("java.lang.Float"), v)
+        case "double":
+            bits := call("doubleToLongBits", typeNode("java.lang.Double"), v)
+            return longHash(bits, clone(bits))
+    }
+    return v    // byte, char, short and int
+}
+
+// (int) (a ^ b >>> 32), a and b being the same long value
+func longHash(a *Node, b *Node) *Node {
+    shift := NewNode3("BIN_OP", ">>>", b, intLiteral(32))
+    return NewNode0("CAST", typeNode("int"), NewNode3("BIN_OP", "^", a, shift))
+}
+
+// public String toString() { return "Point(" + this.x + ", " + this.y + ")" }
+func caseClassToString(name string, params []*Node) *Node {
+    s := stringLiteral(name + "(")
+    for i, p := range params {
+        if i > 0 {
+            s = NewNode3("BIN_OP", "+", s, stringLiteral(", "))
+        }
+        s = NewNode3("BIN_OP", "+", s, thisField(paramName(p)))
+    }
+    s = NewNode3("BIN_OP", "+", s, stringLiteral(")"))
+    return method(modifierList("PUBLIC"), typeNode("java.lang.String"), "toString", nil,
+        NewNode0("RETURN", s))
+}
+
+// public Point copy(int x = getX(), int y = getY()) { return new Point(x, y) }
+func caseClassCopy(name string, params []*Node) *Node {
+    args := []*Node{}
+    values := []*Node{}
+    for _, p := range params {
+        f := paramName(p)
+        current := NewNode0("DEFAULT", call(getter(f), NewNode0("THIS")))
+        args = append(args, NewNode0("ARG", clone(p.At(0)), ident(f), nil, current))
+        values = append(values, ident(f))
+    }
+    return method(modifierList("PUBLIC"), typeNode(name), "copy", args,
+        NewNode0("RETURN", NewNode0("NEW", typeNode(name), NewNode1("ARGUMENTS", values))))
+}
+
+//
+// public static Object[] unapply(Object o) {
+//     if (!(o instanceof Point)) return null
+//     Point that = (Point) o
+//     return new Object[] { that.x, that.y }
+// }
+//
+func caseClassUnapply(name string, params []*Node) *Node {
+    values := []*Node{}
+    for _, p := range params {
+        values = append(values, NewNode3("FIELD_ACCESS", paramName(p), ident("that")))
+    }
+    objects := NewNode3("TYPE", "java.lang.Object", NewNode2("DIM", "1"))
+    return method(modifierList("PUBLIC", "STATIC"), objects, "unapply",
+        []*Node{arg(typeNode("java.lang.Object"), "o")},
+        NewNode0("IF", NewNode0("NOT", NewNode0("INSTANCE_OF", ident("o"), typeNode(name))),
+            NewNode0("RETURN", nullLiteral())),
+        NewNode1("LOCAL_VAR_DECL", []*Node{
+            NewNode0("MODIFIERS"),
+            typeNode(name),
+            NewNode3("VAR", "that", NewNode0("CAST", typeNode(name), ident("o"))),
+        }),
+        NewNode0("RETURN", NewNode0("NEW_ARRAY", clone(objects), NewNode1("ARRAY_INIT", values))))
+}
+
+//
+// resolveNamedArguments rewrites calls with named arguments (name = value)
+// into plain positional calls where the class called is known from the
+// source alone: new C(...) of a class C of the unit, and f(...) or
+// this.f(...) inside the class declaring f. Calls on any other target
+// are left to the code generator, which knows the type of the target.
+//
+func resolveNamedArguments(unit *Node) {
+    classes := map[string]*Node{}
+    walk(unit, func(n *Node) {
+        if n.Name == "CLASS" || n.Name == "CASE_CLASS" {
+            classes[n.F("IDENT").Text] = n
+        }
+    })
+    resolveIn(unit, nil, classes)
+}
+
+// resolves the calls below n, class being the innermost class around n
+func resolveIn(n *Node, class *Node, classes map[string]*Node) {
+    if n == nil { return }
+    switch n.Name {
+        case "CLASS", "CASE_CLASS":
+            class = n
+        case "CALL":
+            target := n.At(0)
+            if class != nil && (target == nil || target.Name == "THIS") {
+                BindNamedArguments(n.At(1), declared(class, "METHOD", n.Text), target)
+            }
+        case "NEW":
+            if c := classes[n.At(0).Text]; c != nil && len(n.Children) == 2 {
+                BindNamedArguments(n.At(1), declared(c, "CONSTRUCTOR", ""), nil)
+            }
+    }
+    for _, c := range n.Children {
+        resolveIn(c, class, classes)
+    }
+}
+
+// the members of class of the given kind, called name unless they are constructors
+func declared(class *Node, kind string, name string) []*Node {
+    found := []*Node{}
+    members := class.F("MEMBERS")
+    if members == nil { return found }
+    for _, m := range members.Children {
+        if m == nil || m.Name != kind { continue }
+        if kind == "CONSTRUCTOR" || m.F("IDENT").Text == name {
+            found = append(found, m)
+        }
+    }
+    return found
+}
+
+//
+// BindNamedArguments rewrites the named arguments of a call into
+// positional ones when exactly one of candidates, the METHOD or
+// CONSTRUCTOR nodes which may be called, fits them. Otherwise
+// 'name = value' stays an ordinary assignment expression.
+//
+// Parameters left out before the last one given take their default
+// value. In a method default, 'this' stands for target, which is
+// therefore evaluated once for each such argument. Trailing defaults
+// are left out, they are passed by the overloads without them.
+//
+func BindNamedArguments(arguments *Node, candidates []*Node, target *Node) {
+    var found []*Node = nil
+    matches := 0
+    for _, c := range candidates {
+        if values := bindArguments(arguments.Children, c.F("ARGS").Children, target); values != nil {
+            found = values
+            matches++
+        }
+    }
+    if matches == 1 {
+        arguments.Children = found
+    }
+}
+
+//
+// bindArguments lines up args with params: positional arguments first,
+// then named ones, then defaults. It returns nil when args do not fit
+// params or when no argument is named.
+//
+func bindArguments(args []*Node, params []*Node, target *Node) []*Node {
+    if len(args) > len(params) { return nil }
+    values := make([]*Node, len(params))
+    named := false
+    for i, a := range args {
+        if name := argumentName(a); name != "" {
+            k := indexOfParam(params, name)
+            if k < 0 || values[k] != nil { return nil }
+            values[k] = a.At(1)
+            named = true
+        } else {
+            if named { return nil }
+            values[i] = a
+        }
+    }
+    if !named { return nil }
+    n := len(values)
+    for n > 0 && values[n - 1] == nil && params[n - 1].F("DEFAULT") != nil {
+        n--
+    }
+    values = values[0:n]
+    for k, p := range params[0:n] {
+        if values[k] != nil { continue }
+        d := p.F("DEFAULT")
+        if d == nil { return nil }
+        values[k] = withTarget(clone(d.At(0)), target)
+    }
+    return values
+}
+
+// name of a named argument 'name = value', or ""
+func argumentName(a *Node) string {
+    if a != nil && a.Name == "ASSIGN_EXPR" && a.Text == "=" && a.At(0).Name == "IDENT" {
+        return a.At(0).Text
+    }
+    return ""
+}
+
+func indexOfParam(params []*Node, name string) int {
+    for i, p := range params {
+        if paramName(p) == name { return i }
+    }
+    return -1
+}
+
+// replaces 'this' in a default value by the target of the call
+func withTarget(n *Node, target *Node) *Node {
+    if n == nil || target == nil { return n }
+    if n.Name == "THIS" { return clone(target) }
+    for i, c := range n.Children {
+        n.Children[i] = withTarget(c, target)
+    }
+    return n
+}
+
+//
+// node builders for synthesized members
+//
+
+func method(mods *Node, returnType *Node, name string, args []*Node, body...*Node) *Node {
+    return NewNode0("METHOD", mods, returnType, ident(name),
+        NewNode1("ARGS", args), NewNode1("METHOD_BODY", body))
+}
+
+func modifierList(names...string) *Node {
+    m := []*Node{}
+    for _, name := range names {
+        m = append(m, NewNode0(name))
+    }
+    return NewNode1("MODIFIERS", m)
+}
+
+func arg(t *Node, name string) *Node {
+    return NewNode0("ARG", t, ident(name), nil)
+}
+
+func ident(name string) *Node {
+    return NewNode2("IDENT", name)
+}
+
+func typeNode(name string) *Node {
+    return NewNode2("TYPE", name)
+}
+
+func thisField(name string) *Node {
+    return NewNode3("FIELD_ACCESS", name, NewNode0("THIS"))
+}
+
+// a TYPE target makes a static call, e.g. java.util.Objects.equals(a, b)
+func call(name string, target *Node, args...*Node) *Node {
+    return NewNode3("CALL", name, target, NewNode1("ARGUMENTS", args))
+}
+
+func intLiteral(v int) *Node {
+    n := NewNode2("INT_LITERAL", strconv.Itoa(v))
+    n.Value = int32(v)
+    return n
+}
+
+func boolLiteral(v bool) *Node {
+    n := NewNode2("BOOLEAN_LITERAL", strconv.Btoa(v))
+    n.Value = v
+    return n
+}
+
+func nullLiteral() *Node {
+    return NewNode2("NULL_LITERAL", "null")
+}
+
+func stringLiteral(s string) *Node {
+    n := NewNode2("STRING_LITERAL", strconv.Quote(s))
+    n.Value = s
+    return n
+}
+
+// deep copy, so that no node is shared between two places in the tree
+func clone(n *Node) *Node {
+    if n == nil { return nil }
+    c := *n
+    c.Children = make([]*Node, len(n.Children))
+    for i, child := range n.Children {
+        c.Children[i] = clone(child)
+    }
+    return &c
+}
+
+// gives synthesized nodes, which have no source of their own, the span of span
+func stamp(n *Node, span Span) *Node {
+    if n == nil { return nil }
+    if !n.Span.IsValid() { n.Span = span }
+    for _, c := range n.Children {
+        stamp(c, span)
+    }
+    return n
+}
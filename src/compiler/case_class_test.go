@@ -0,0 +1,106 @@
+package compiler_test
+
+import "testing"
+import "compiler"
+import "ast"
+
+// first node called name in n, depth first
+func find(n *ast.Node, name string) *ast.Node {
+    if n == nil { return nil }
+    if n.Name == name { return n }
+    for _, c := range n.Children {
+        if r := find(c, name); r != nil { return r }
+    }
+    return nil
+}
+
+func TestCaseClassMembers(t *testing.T) {
+    unit, diags := compiler.ParseFile("Point.kt", "case class Point(int x, String name = \"origin\")\n")
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    compiler.DesugarCaseClasses(unit)
+    class := find(unit, "CASE_CLASS")
+    if class.F("ARGS") != nil {
+        t.Fatalf("primary parameters left in %s", class)
+    }
+
+    expect := []string{
+        "FIELD x", "FIELD name", "CONSTRUCTOR Point", "METHOD getX", "METHOD getName",
+        "METHOD equals", "METHOD hashCode", "METHOD toString", "METHOD copy", "METHOD unapply",
+    }
+    members := class.F("MEMBERS").Children
+    if len(members) != len(expect) {
+        t.Fatalf("expect %d members, found %d: %s", len(expect), len(members), class)
+    }
+    for i, m := range members {
+        name := ""
+        if m.Name == "FIELD" {
+            name = m.F("VAR").Text
+        } else {
+            name = m.F("IDENT").Text
+        }
+        if m.Name + " " + name != expect[i] {
+            t.Fatalf("member %d: expect %s, found %s", i, expect[i], m)
+        }
+        if !m.Span.IsValid() {
+            t.Fatalf("member %d has no span", i)
+        }
+    }
+
+    equals := "RETURN(BIN_OP('&&'," +
+        "BIN_OP('==',FIELD_ACCESS('x',THIS),FIELD_ACCESS('x',IDENT('that')))," +
+        "CALL('equals',TYPE('java.util.Objects'),ARGUMENTS(FIELD_ACCESS('name',THIS),FIELD_ACCESS('name',IDENT('that'))))))"
+    if s := members[5].F("METHOD_BODY").At(3).String(); s != equals {
+        t.Fatalf("found:  %s\nexpect: %s", s, equals)
+    }
+    toString := "RETURN(BIN_OP('+',BIN_OP('+',BIN_OP('+',BIN_OP('+'," +
+        "STRING_LITERAL('\"Point(\"'),FIELD_ACCESS('x',THIS)),STRING_LITERAL('\", \"'))," +
+        "FIELD_ACCESS('name',THIS)),STRING_LITERAL('\")\"')))"
+    if s := members[7].F("METHOD_BODY").At(0).String(); s != toString {
+        t.Fatalf("found:  %s\nexpect: %s", s, toString)
+    }
+}
+
+func TestCaseClassNamedArguments(t *testing.T) {
+    unit, diags := compiler.ParseFile("Point.kt",
+        "case class Point(int x, int y = 0, int z = 0)\n" +
+        "class A {\n"                                    +
+        "  get(String k, Object d = null) {\n"           +
+        "  }\n"                                          +
+        "  f(p, m) {\n"                                  +
+        "    q := p.copy(y = 1)\n"                       +
+        "    r := new Point(2)\n"                        +
+        "    s := new Point(y = 1, x = 2)\n"             +
+        "    u := new Point(z = 1, x = 2)\n"             +
+        "    v := m.get(\"k\")\n"                        +
+        "    w := get(d = 1, k = \"k\")\n"               +
+        "    x := this.get(k = \"k\")\n"                 +
+        "    y := new Point(w = 1)\n"                    +
+        "  }\n"                                          +
+        "}\n")
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    compiler.DesugarCaseClasses(unit)
+    body := find(unit, "CLASS").F("MEMBERS").At(1).F("METHOD_BODY")
+
+    expect := []string{
+        // the class of p is not known here, see codegen
+        "CALL('copy',IDENT('p'),ARGUMENTS(ASSIGN_EXPR('=',IDENT('y'),INT_LITERAL('1'))))",
+        // trailing defaults are passed by overloads
+        "NEW(TYPE('Point'),ARGUMENTS(INT_LITERAL('2')))",
+        "NEW(TYPE('Point'),ARGUMENTS(INT_LITERAL('2'),INT_LITERAL('1')))",
+        "NEW(TYPE('Point'),ARGUMENTS(INT_LITERAL('2'),INT_LITERAL('0'),INT_LITERAL('1')))",
+        "CALL('get',IDENT('m'),ARGUMENTS(STRING_LITERAL('\"k\"')))",
+        "CALL('get',<nil>,ARGUMENTS(STRING_LITERAL('\"k\"'),INT_LITERAL('1')))",
+        "CALL('get',THIS,ARGUMENTS(STRING_LITERAL('\"k\"')))",
+        // no parameter w, left as an assignment
+        "NEW(TYPE('Point'),ARGUMENTS(ASSIGN_EXPR('=',IDENT('w'),INT_LITERAL('1'))))",
+    }
+    for i, e := range expect {
+        if s := body.At(i).At(1).String(); s != e {
+            t.Fatalf("found:  %s\nexpect: %s", s, e)
+        }
+    }
+}
@@ -0,0 +1,151 @@
+package compiler
+
+import "fmt"
+import . "ast"
+
+type Severity int
+
+const (
+    SeverityError Severity = iota
+    SeverityWarning
+    SeverityNote
+)
+
+var severities = map[Severity]string{
+    SeverityError:   "error",
+    SeverityWarning: "warning",
+    SeverityNote:    "note",
+}
+
+func (s Severity) String() string {
+    return severities[s]
+}
+
+//
+// Error is a diagnostic code.
+//
+type Error int
+
+const (
+    NoErr Error = iota
+    ErrRecognition
+    ErrNoViableRule
+    ErrParseFailed
+    ErrIllegalChar
+    ErrIllegalUtf8
+    ErrUnexpectedToken
+    ErrExpectSemiOrEol
+    ErrExpectModifier
+    ErrExpectAssignOp
+    ErrMalformedNumber
+    ErrNumberTooLarge
+    ErrUnterminatedString
+    ErrUnterminatedChar
+    ErrIllegalEscape
+    ErrUnterminatedComment
+    ErrUnresolved
+    ErrTypeMismatch
+    ErrUnsupported
+    ErrMissingReturn
+    ErrMissingBody
+)
+
+var errorText = map[Error]string{
+    NoErr:              "Successful",
+    ErrRecognition:     "Recognition Error",
+    ErrNoViableRule:    "No viable rule",
+    ErrParseFailed:     "Parse failed",
+    ErrIllegalChar:     "Illegal character",
+    ErrIllegalUtf8:     "Illegal UTF-8 encoding",
+    ErrUnexpectedToken: "Unexpected token",
+    ErrExpectSemiOrEol: "Expect semi-colon or EOL",
+    ErrExpectModifier:  "Expect a modifier",
+    ErrExpectAssignOp:  "Expect an assignment operator",
+    ErrMalformedNumber: "Malformed number",
+    ErrNumberTooLarge:  "Number too large",
+    ErrUnterminatedString: "Unterminated string literal",
+    ErrUnterminatedChar:   "Unterminated character literal",
+    ErrIllegalEscape:   "Illegal escape sequence",
+    ErrUnterminatedComment: "Unterminated comment",
+    ErrUnresolved:      "Unresolved name",
+    ErrTypeMismatch:    "Incompatible types",
+    ErrUnsupported:     "Not supported by the code generator",
+    ErrMissingReturn:   "Missing return statement",
+    ErrMissingBody:     "Missing method body",
+}
+
+func (e Error) String() string {
+    if str, exists := errorText[e]; exists {
+        return str
+    }
+    return "<" + e.Code() + ">"
+}
+
+// K0001, K0002, ...
+func (e Error) Code() string {
+    return fmt.Sprintf("K%04d", int(e))
+}
+
+//
+// Note is a secondary message attached to a diagnostic,
+// e.g. pointing at the opening brace of an unclosed block.
+//
+type Note struct {
+    Message string
+    Span    Span
+}
+
+type Diagnostic struct {
+    Severity Severity
+    Code     Error
+    Message  string
+    Span     Span
+    Related  []Note
+}
+
+func (d *Diagnostic) AddNote(span Span, msg string) *Diagnostic {
+    d.Related = append(d.Related, Note{Message: msg, Span: span})
+    return d
+}
+
+// A.kt:1:5: error K0006: expecting '}', found <EOF>
+func (d *Diagnostic) String() string {
+    return fmt.Sprintf("%s: %s %s: %s", d.Span, d.Severity, d.Code.Code(), d.Message)
+}
+
+//
+// DiagnosticList collects diagnostics in the order they are reported.
+// The lexer and the parser of one compilation unit share the same list.
+//
+type DiagnosticList struct {
+    items []*Diagnostic
+}
+
+func (l *DiagnosticList) Add(d *Diagnostic) *Diagnostic {
+    l.items = append(l.items, d)
+    return d
+}
+
+func (l *DiagnosticList) Errorf(code Error, span Span, format string, args...interface{}) *Diagnostic {
+    return l.Add(&Diagnostic{
+        Severity: SeverityError,
+        Code:     code,
+        Message:  fmt.Sprintf(format, args...),
+        Span:     span,
+    })
+}
+
+func (l *DiagnosticList) Items() []*Diagnostic {
+    return l.items
+}
+
+func (l *DiagnosticList) Len() int {
+    return len(l.items)
+}
+
+func (l *DiagnosticList) ErrorCount() (n int) {
+    for _, d := range l.items {
+        if d.Severity == SeverityError { n++ }
+    }
+    return
+}
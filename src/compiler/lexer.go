@@ -1,18 +1,41 @@
 package compiler
 
 import "utf8"
+import "unicode"
 import "strconv"
 import "util"
+import . "ast"
 
 import "fmt"
 
 const EOF = -1
 
 type Lexer struct {
+    file        string
     input       []byte
     readOffset  int
     ch          int
     offset      int
+
+    // position of ch
+    chOffset    int
+    line        int
+    column      int
+
+    // start of the token being scanned
+    start       Position
+
+    // comments waiting for the next token
+    pending     []*Trivia
+    doc         *Trivia
+
+    // one entry per open "${", counting the '{' opened inside it
+    templates   []int
+    // the next token is the name of a "$name", then the string goes on
+    templateName bool
+    resumeString bool
+
+    diags       *DiagnosticList
 }
 
 
@@ -36,6 +59,14 @@ func (S *Lexer) GetReadOffset() int {
 func (S *Lexer) GetCh() int {
     return S.ch
 }
+
+func (S *Lexer) GetPos() Position {
+    return S.pos()
+}
+
+func (S *Lexer) Diagnostics() *DiagnosticList {
+    return S.diags
+}
 //
 // end testing
 //
@@ -45,29 +76,51 @@ func (S *Lexer) Init(input string) *Lexer {
     S.input = []byte(input)
     S.readOffset = 0
     S.offset = 0
+    S.ch = 0
+    S.chOffset = 0
+    S.line = 1
+    S.column = 0
+    S.diags = new(DiagnosticList)
     S.advance()
     return S
 }
 
+//
+// InitFile is Init with the file name recorded in every token span.
+//
+func (S *Lexer) InitFile(file string, input string) *Lexer {
+    S.file = file
+    return S.Init(input)
+}
+
 func (S *Lexer) Consume() {
     S.advance()
 }
 
+//
+// illegal input is reported and read as a blank,
+// so that lexing can go on with the next character.
+//
 func (S *Lexer) getChar() (ch int, w int) {
     ch,w = int(S.input[S.readOffset]), 1
     switch {
         case ch == 0:
-            S.error("illegal 0")
+            S.errorAt(S.readOffset, ErrIllegalChar, "illegal 0")
+            ch = ' '
         case ch >= 0x80:
             ch,w = utf8.DecodeRune(S.input[S.readOffset:])
             if ch == utf8.RuneError && w == 1 {
-                S.error("illegal utf")
+                S.errorAt(S.readOffset, ErrIllegalUtf8, "illegal utf")
+                ch = ' '
             }
     }
     return
 }
 
 func (S *Lexer) advance() {
+    if S.ch == EOF { return }
+    prev := S.ch
+    S.chOffset = S.readOffset
     if S.readOffset < len(S.input) {
         ch,w := S.getChar()
         S.offset++
@@ -76,86 +129,656 @@ func (S *Lexer) advance() {
     } else {
         S.ch = EOF
     }
+    // CR, LF and CRLF each end a line
+    if prev == '\n' || (prev == '\r' && S.ch != '\n') {
+        S.line++
+        S.column = 1
+    } else {
+        S.column++
+    }
+}
+
+func (S *Lexer) pos() Position {
+    return Position{Line: S.line, Column: S.column, Offset: S.chOffset}
+}
+
+// position just after the current character
+func (S *Lexer) nextPos() Position {
+    if S.ch == EOF { return S.pos() }
+    return Position{Line: S.line, Column: S.column + 1, Offset: S.readOffset}
+}
+
+//
+// token creates a token spanning from the start of the current scan
+// up to (but not including) the current character.
+//
+func (S *Lexer) token(tokenType TokenType, text string) *Token {
+    return &Token{tokenType: tokenType, text: text,
+                  span: Span{File: S.file, Start: S.start, End: S.pos()}}
 }
 
 func (S *Lexer) Match(x int) {
     if x == S.ch {
         S.Consume()
     } else {
-        S.error("expect " + strconv.Itoa(x) + ", found " + strconv.Itoa(S.ch))
+        S.error(ErrIllegalChar, "expect " + strconv.Itoa(x) + ", found " + strconv.Itoa(S.ch))
     }
 }
 
+//
+// NextToken returns the next token with the comments in front of it
+// as leading trivia, and the comments following it on the same line
+// as trailing trivia. A doc comment is also attached to the first
+// token after it which is not an EOL. Inside a string, after the
+// name of a $name template, there is no trivia but string text.
+//
 func (S *Lexer) NextToken() *Token {
+    t := S.nextToken()
+    t.leading = S.pending
+    S.pending = nil
+    if t.tokenType != EOL && t.tokenType != EOF && !S.templateName && !S.resumeString {
+        S.trailingTrivia(t)
+    }
+    if t.tokenType != EOL && S.doc != nil {
+        t.doc = S.doc
+        S.doc = nil
+    }
+    return t
+}
+
+func (S *Lexer) nextToken() *Token {
+    if S.templateName {
+        S.start = S.pos()
+        S.templateName = false
+        S.resumeString = true
+        return S.keywordOrIdent(false)  // "$a$b" is two templates
+    }
+    if S.resumeString {
+        S.start = S.pos()
+        S.resumeString = false
+        return S.stringPart(util.NewStringBuffer(), util.NewStringBuffer(), TEMPLATE_END, TEMPLATE_MID)
+    }
     for S.ch != EOF {
+        S.start = S.pos()
         switch S.ch {
             case ' ', '\t': S.WS()
             case '\r','\n': return S.EOL()
-            case ';': S.Consume(); return &Token{tokenType: SEMI, text:";"}
-            case '.': S.Consume(); return &Token{tokenType: DOT,  text:"."}
-            case '{': S.Consume(); return &Token{tokenType: LCURL,text:"{"}
-            case '}': S.Consume(); return &Token{tokenType: RCURL,text:"}"}
-            case '(': S.Consume(); return &Token{tokenType: LPAR, text:"("}
-            case ')': S.Consume(); return &Token{tokenType: RPAR, text:")"}
-            case '[': S.Consume(); return &Token{tokenType: LBRAC,text:"["}
-            case ']': S.Consume(); return &Token{tokenType: RBRAC,text:"]"}
-            case '*': S.Consume(); return &Token{tokenType: STAR, text:"*"}
-            case ',': S.Consume(); return &Token{tokenType: COMMA,text:","}
-            case ':': S.Consume(); return &Token{tokenType: COLON,text:":"}
-            case '?': S.Consume(); return &Token{tokenType: QUESTION,text:"?"}
-            case '|': S.Consume(); return &Token{tokenType: OR,   text:"|"}
-            case '&': S.Consume(); return &Token{tokenType: AND,  text:"&"}
-            case '^': S.Consume(); return &Token{tokenType: XOR,  text:"^"}
-            case '!': S.Consume(); return &Token{tokenType: NOT,  text:"!"}
-        	case '=': S.Consume(); return &Token{tokenType: EQUAL,text:"="}
+            case '/':
+                if S.peek() == '/' || S.peek() == '*' {
+                    c := S.Comment()
+                    S.pending = append(S.pending, c)
+                    if c.Kind == DOC_COMMENT {
+                        S.doc = c
+                    }
+                    continue
+                }
+                return S.Operator()
+            case ';': S.Consume(); return S.token(SEMI,     ";")
+            case '.':
+                if isDigit(S.peek()) {
+                    return S.Number()
+                }
+                return S.Operator()
+            case '"':  return S.StringLiteral()
+            case '\'': return S.CharLiteral()
+            case '{':
+                if n := len(S.templates); n > 0 {
+                    S.templates[n-1]++
+                }
+                S.Consume(); return S.token(LCURL,    "{")
+            case '}':
+                if n := len(S.templates); n > 0 {
+                    if S.templates[n-1] == 0 {
+                        return S.TemplateContinuation()
+                    }
+                    S.templates[n-1]--
+                }
+                S.Consume(); return S.token(RCURL,    "}")
+            case '(': S.Consume(); return S.token(LPAR,     "(")
+            case ')': S.Consume(); return S.token(RPAR,     ")")
+            case '[': S.Consume(); return S.token(LBRAC,    "[")
+            case ']': S.Consume(); return S.token(RBRAC,    "]")
+            case ',': S.Consume(); return S.token(COMMA,    ",")
+            case '*', ':', '?', '|', '&', '^', '!', '=',
+                 '+', '-', '<', '>', '%', '~', '@':
+                return S.Operator()
             default:
                 if S.isLetter() {
                     return S.KeywordOrIdent()
                 }
-                S.error(fmt.Sprintf("invalid character: '%c' (%d)", S.ch, S.ch))
+                if isDigit(S.ch) {
+                    return S.Number()
+                }
+                S.error(ErrIllegalChar, fmt.Sprintf("invalid character: '%c' (%d)", S.ch, S.ch))
+                S.Consume()
         }
     }
-    return &Token{tokenType:EOF,text:"<EOF>"}
+    S.start = S.pos()
+    return S.token(EOF, "<EOF>")
 }
 
+//
+// Java letters: unicode letters, '_' and '$'
+//
 func (S *Lexer) isLetter() bool {
     ch := S.ch
-    return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+    return ch == '_' || ch == '$' || (ch >= 0 && unicode.IsLetter(ch))
 }
 
-func (S *Lexer) LETTER() {
-    if S.isLetter() {
-        S.Consume()
-    } else {
-        S.error("expecting LETTER; found " + strconv.Itoa(S.ch))
-    }
+var keywords = map[string]TokenType {
+    "abstract":     ABSTRACT,
+    "assert":       ASSERT,
+    "boolean":      BOOLEAN,
+    "break":        BREAK,
+    "byte":         BYTE,
+    "case":         CASE,
+    "catch":        CATCH,
+    "char":         CHAR,
+    "class":        CLASS,
+    "const":        CONST,
+    "continue":     CONTINUE,
+    "def":          DEF,
+    "default":      DEFAULT,
+    "do":           DO,
+    "double":       DOUBLE,
+    "else":         ELSE,
+    "enum":         ENUM,
+    "extends":      EXTENDS,
+    "final":        FINAL,
+    "finally":      FINALLY,
+    "float":        FLOAT,
+    "for":          FOR,
+    "goto":         GOTO,
+    "if":           IF,
+    "implements":   IMPLEMENTS,
+    "import":       IMPORT,
+    "instanceof":   INSTANCE_OF,
+    "int":          INT,
+    "interface":    INTERFACE,
+    "long":         LONG,
+    "match":        MATCH,
+    "native":       NATIVE,
+    "new":          NEW,
+    "package":      PACKAGE,
+    "private":      PRIVATE,
+    "protected":    PROTECTED,
+    "public":       PUBLIC,
+    "return":       RETURN,
+    "short":        SHORT,
+    "static":       STATIC,
+    "strictfp":     STRICTFP,
+    "super":        SUPER,
+    "switch":       SWITCH,
+    "synchronized": SYNC,
+    "this":         THIS,
+    "throw":        THROW,
+    "throws":       THROWS,
+    "transient":    TRANSIENT,
+    "try":          TRY,
+    "val":          VAL,
+    "void":         VOID,
+    "volatile":     VOLATILE,
+    "while":        WHILE,
 }
 
+//
+// identifier: letter (letter | digit)*
+//
 func (S *Lexer) KeywordOrIdent() *Token {
+    return S.keywordOrIdent(true)
+}
+
+// an identifier, stopping at '$' unless dollar
+func (S *Lexer) keywordOrIdent(dollar bool) *Token {
     buf := util.NewStringBuffer()
-    for S.isLetter()  {
-        buf.Append(S.ch); S.LETTER()
+    for (S.isLetter() && (dollar || S.ch != '$')) || isDigit(S.ch) {
+        buf.Append(S.ch); S.Consume()
     }
     str := buf.String()
     switch str {
-        case "import":
-            return &Token{tokenType:IMPORT, text:str}
-        case "static":
-            return &Token{tokenType:STATIC, text:str}
-        case "package":
-            return &Token{tokenType:PACKAGE,text:str}
-        case "class":
-            return &Token{tokenType:CLASS,  text:str}
-        case "case":
-            return &Token{tokenType:CASE,   text:str}
-        case "match":
-            return &Token{tokenType:MATCH,  text:str}
-        case "return":
-            return &Token{tokenType:RETURN, text:str}
+        case "true":
+            return S.literal(TRUE,  str, true)
+        case "false":
+            return S.literal(FALSE, str, false)
+        case "null":
+            return S.literal(NULL,  str, nil)
+    }
+    if tokenType, exists := keywords[str]; exists {
+        return S.token(tokenType, str)
+    }
+    return S.token(IDENT, str)
+}
+
+var operators = map[string]TokenType {
+    "&":  AND,      "&&": AND_AND,  "&=": AND_ASSIGN,
+    "|":  OR,       "||": OR_OR,    "|=": OR_ASSIGN,
+    "^":  XOR,      "^=": XOR_ASSIGN,
+    "!":  NOT,      "!=": NE,
+    "=":  EQUAL,    "==": EQ,       "=>": FAT_ARROW,
+    "+":  PLUS,     "++": INC,      "+=": PLUS_ASSIGN,
+    "-":  MINUS,    "--": DEC,      "-=": MINUS_ASSIGN,  "->": ARROW,
+    "*":  STAR,     "*=": STAR_ASSIGN,  "*.": SPREAD_DOT,
+    "/":  DIV,      "/=": DIV_ASSIGN,
+    "%":  PERCENT,  "%=": PERCENT_ASSIGN,
+    "<":  LANGLE,   "<=": LE,       "<<": SHL,      "<<=": SHL_ASSIGN,
+    ">":  RANGLE,   ">=": GE,       ">>=": SHR_ASSIGN,  ">>>=": USHR_ASSIGN,
+    ":":  COLON,    "::": COLON_COLON,  ":=": INFER_ASSIGN,
+    "?":  QUESTION, "?.": SAFE_DOT, "?:": ELVIS,
+    ".":  DOT,      "..": RANGE,    "...": ELLIPSIS,    "..<": RANGE_EXCL,
+    "~":  TILD,
+    "@":  AT,
+}
+
+//
+// Operator reads the longest operator starting at ch.
+//
+// '>>' and '>>>' are not tokens, they are read as separate '>'
+// so that `List<List<T>>` closes two type argument lists; the
+// parser takes adjacent '>'s as a shift operator.
+// `a*.5` and `a?.5` are not spread or safe navigation.
+//
+func (S *Lexer) Operator() *Token {
+    end := S.readOffset + 3
+    if end > len(S.input) { end = len(S.input) }
+    candidate := string(S.ch) + string(S.input[S.readOffset:end])
+    for n := len(candidate); n > 0; n-- {
+        op := candidate[0:n]
+        tokenType, exists := operators[op]
+        if !exists { continue }
+        if (op == "*." || op == "?.") && n < len(candidate) && isDigit(int(candidate[n])) {
+            continue
+        }
+        for i := 0; i < n; i++ {
+            S.Consume()
+        }
+        return S.token(tokenType, op)
+    }
+    S.error(ErrIllegalChar, fmt.Sprintf("invalid character: '%c' (%d)", S.ch, S.ch))
+    S.Consume()
+    return S.nextToken()
+}
+
+// the character after ch
+func (S *Lexer) peek() int {
+    if S.readOffset >= len(S.input) { return EOF }
+    ch,_ := utf8.DecodeRune(S.input[S.readOffset:])
+    return ch
+}
+
+func (S *Lexer) literal(tokenType TokenType, text string, value interface{}) *Token {
+    t := S.token(tokenType, text)
+    t.value = value
+    return t
+}
+
+func isDigit(ch int) bool {
+    return ch >= '0' && ch <= '9'
+}
+
+func digitVal(ch int) int {
+    switch {
+        case '0' <= ch && ch <= '9': return ch - '0'
+        case 'a' <= ch && ch <= 'f': return ch - 'a' + 10
+        case 'A' <= ch && ch <= 'F': return ch - 'A' + 10
+    }
+    return 16 // larger than any base
+}
+
+//
+// number
+//     :   ('0x'|'0X') hexDigits ('l'|'L')?
+//     |   ('0b'|'0B') binaryDigits ('l'|'L')?
+//     |   '0' octalDigits ('l'|'L')?
+//     |   digits ('l'|'L')?
+//     |   digits? ('.' digits)? exponent? ('f'|'F'|'d'|'D')?
+//
+// Digits may be separated by '_'. A '.' not followed by a digit
+// is not part of the number, so `1..10` lexes as 1, .., 10.
+//
+func (S *Lexer) Number() *Token {
+    raw := util.NewStringBuffer()   // source text
+    num := util.NewStringBuffer()   // digits only, for strconv
+    base := 10
+    isFloat := false
+
+    if S.ch == '0' && (S.peek() == 'x' || S.peek() == 'X' || S.peek() == 'b' || S.peek() == 'B') {
+        raw.Append(S.ch); S.Consume()
+        base = 2
+        if S.ch == 'x' || S.ch == 'X' { base = 16 }
+        raw.Append(S.ch); S.Consume()
+        if S.digits(raw, num, base) == 0 {
+            S.error(ErrMalformedNumber, "missing digits in " + raw.String())
+            num.Append('0')
+        }
+    } else {
+        S.digits(raw, num, 10)
+        if S.ch == '.' && isDigit(S.peek()) {
+            isFloat = true
+            raw.Append(S.ch); num.Append(S.ch); S.Consume()
+            S.digits(raw, num, 10)
+        }
+        if S.ch == 'e' || S.ch == 'E' {
+            isFloat = true
+            raw.Append(S.ch); num.Append(S.ch); S.Consume()
+            if S.ch == '+' || S.ch == '-' {
+                raw.Append(S.ch); num.Append(S.ch); S.Consume()
+            }
+            if S.digits(raw, num, 10) == 0 {
+                S.error(ErrMalformedNumber, "malformed exponent in " + raw.String())
+                num.Append('0')
+            }
+        }
+        if !isFloat && S.ch != 'f' && S.ch != 'F' && S.ch != 'd' && S.ch != 'D' {
+            if str := num.String(); len(str) > 1 && str[0] == '0' {
+                base = 8
+            }
+        }
+    }
+
+    tokenType := INT_LITERAL
+    switch S.ch {
+        case 'l', 'L':
+            if !isFloat { tokenType = LONG_LITERAL; raw.Append(S.ch); S.Consume() }
+        case 'f', 'F':
+            if base == 10 { tokenType = FLOAT_LITERAL; raw.Append(S.ch); S.Consume() }
+        case 'd', 'D':
+            if base == 10 { tokenType = DOUBLE_LITERAL; raw.Append(S.ch); S.Consume() }
+        default:
+            if isFloat { tokenType = DOUBLE_LITERAL }
+    }
+    if S.isLetter() || isDigit(S.ch) {
+        for S.isLetter() || isDigit(S.ch) {
+            raw.Append(S.ch); S.Consume()
+        }
+        S.error(ErrMalformedNumber, "malformed number " + raw.String())
+        return S.literal(tokenType, raw.String(), zeroOf(tokenType))
+    }
+    return S.numberLiteral(tokenType, raw.String(), num.String(), base)
+}
+
+//
+// digits reads digits (and '_' between them) into raw, and the
+// digits alone into num. It returns the number of digits read.
+//
+func (S *Lexer) digits(raw, num *util.StringBuffer, base int) (n int) {
+    max := base
+    if max < 10 { max = 10 } // 8 and 9 are reported by numberLiteral
+    underscore := false
+    for digitVal(S.ch) < max || (S.ch == '_' && n > 0) {
+        underscore = S.ch == '_'
+        if !underscore {
+            num.Append(S.ch)
+            n++
+        }
+        raw.Append(S.ch); S.Consume()
+    }
+    if underscore {
+        S.error(ErrMalformedNumber, "'_' must be followed by a digit")
+    }
+    return
+}
+
+func zeroOf(tokenType TokenType) interface{} {
+    switch tokenType {
+        case LONG_LITERAL:   return int64(0)
+        case FLOAT_LITERAL:  return float32(0)
+        case DOUBLE_LITERAL: return float64(0)
+    }
+    return int32(0)
+}
+
+//
+// values are int32, int64, float32 and float64 as in Java.
+// Decimal 2147483648 (and the long equivalent) is only valid
+// as the operand of unary minus, which the parser checks. Its
+// value is the minimum.
+//
+func (S *Lexer) numberLiteral(tokenType TokenType, text, num string, base int) *Token {
+    switch tokenType {
+        case FLOAT_LITERAL:
+            v, err := strconv.Atof32(num)
+            if err != nil {
+                S.error(ErrNumberTooLarge, "floating-point number too large: " + text)
+            }
+            return S.literal(tokenType, text, v)
+        case DOUBLE_LITERAL:
+            v, err := strconv.Atof64(num)
+            if err != nil {
+                S.error(ErrNumberTooLarge, "floating-point number too large: " + text)
+            }
+            return S.literal(tokenType, text, v)
+    }
+
+    for _, ch := range num {
+        if digitVal(ch) >= base {
+            S.error(ErrMalformedNumber, fmt.Sprintf("invalid digit '%c' in %s", ch, text))
+            return S.literal(tokenType, text, zeroOf(tokenType))
+        }
+    }
+    v, err := strconv.Btoui64(num, base)
+    if tokenType == LONG_LITERAL {
+        if err != nil || (base == 10 && v > 1<<63) {
+            S.error(ErrNumberTooLarge, "long number too large: " + text)
+            return S.literal(tokenType, text, zeroOf(tokenType))
+        }
+        return S.literal(tokenType, text, int64(v))
+    }
+    if err != nil || (base == 10 && v > 1<<31) || v > 1<<32-1 {
+        S.error(ErrNumberTooLarge, "integer number too large: " + text)
+        return S.literal(tokenType, text, zeroOf(tokenType))
+    }
+    return S.literal(tokenType, text, int32(uint32(v)))
+}
+
+//
+// stringLiteral: '"' (escapeSequence | ~('\\'|'"'|'\r'|'\n'))* '"'
+//
+// A string with "${expression}" or "$name" in it is a template.
+// "a${x}b$y" is read as the tokens
+//
+//     TEMPLATE_BEGIN('"a${') x TEMPLATE_MID('}b$') y TEMPLATE_END('"')
+//
+// the value of each template token being its text segment.
+// Write \$ for a plain '$'.
+//
+func (S *Lexer) StringLiteral() *Token {
+    raw := util.NewStringBuffer()
+    val := util.NewStringBuffer()
+    raw.Append(S.ch); S.Consume()
+    return S.stringPart(raw, val, STRING_LITERAL, TEMPLATE_BEGIN)
+}
+
+// the '}' closing a "${" and the string following it
+func (S *Lexer) TemplateContinuation() *Token {
+    S.templates = S.templates[0:len(S.templates)-1]
+    raw := util.NewStringBuffer()
+    raw.Append(S.ch); S.Consume()
+    return S.stringPart(raw, util.NewStringBuffer(), TEMPLATE_END, TEMPLATE_MID)
+}
+
+//
+// stringPart reads up to the closing '"', giving a token of type last,
+// or up to an interpolation, giving a token of type part.
+//
+func (S *Lexer) stringPart(raw, val *util.StringBuffer, last, part TokenType) *Token {
+    for S.ch != '"' {
+        switch S.ch {
+            case EOF, '\r', '\n':
+                S.error(ErrUnterminatedString, "string literal not terminated")
+                return S.literal(last, raw.String(), val.String())
+            case '\\':
+                if ch := S.escapeSeq(raw); ch >= 0 {
+                    val.Append(ch)
+                }
+            case '$':
+                next := S.peek()
+                if next == '{' {
+                    raw.Append(S.ch); S.Consume()
+                    raw.Append(S.ch); S.Consume()
+                    S.templates = append(S.templates, 0)
+                    return S.literal(part, raw.String(), val.String())
+                }
+                if next == '_' || (next >= 0 && unicode.IsLetter(next)) {
+                    raw.Append(S.ch); S.Consume()
+                    S.templateName = true
+                    return S.literal(part, raw.String(), val.String())
+                }
+                raw.Append(S.ch); val.Append(S.ch); S.Consume()
+            default:
+                raw.Append(S.ch); val.Append(S.ch); S.Consume()
+        }
+    }
+    raw.Append(S.ch); S.Consume()
+    return S.literal(last, raw.String(), val.String())
+}
+
+//
+// charLiteral: '\'' (escapeSequence | ~('\''|'\\'|'\r'|'\n')) '\''
+//
+// the value is an int holding one UTF-16 code unit
+//
+func (S *Lexer) CharLiteral() *Token {
+    raw := util.NewStringBuffer()
+    raw.Append(S.ch); S.Consume()
+    v := 0
+    switch S.ch {
+        case EOF, '\r', '\n', '\'':
+            S.error(ErrUnterminatedChar, "empty character literal")
+        case '\\':
+            v = S.escapeSeq(raw)
         default:
-            return &Token{tokenType:IDENT,  text:str}
+            v = S.ch
+            raw.Append(S.ch); S.Consume()
+    }
+    if S.ch != '\'' {
+        S.error(ErrUnterminatedChar, "character literal not terminated")
+        return S.literal(CHAR_LITERAL, raw.String(), 0)
+    }
+    raw.Append(S.ch); S.Consume()
+    if v > 0xFFFF {
+        S.error(ErrIllegalChar, "character literal out of range: " + raw.String())
+        v = 0
+    }
+    if v < 0 { v = 0 }
+    return S.literal(CHAR_LITERAL, raw.String(), v)
+}
+
+//
+// escapeSequence
+//     :   '\\' ('b'|'t'|'n'|'f'|'r'|'\"'|'\''|'\\'|'$')
+//     |   '\\' octalDigit (octalDigit (octalDigit)?)?
+//     |   '\\' 'u'+ hexDigit hexDigit hexDigit hexDigit
+//
+// A surrogate pair written as two \u escapes decodes to a single
+// character. It returns -1 for an illegal escape.
+//
+func (S *Lexer) escapeSeq(raw *util.StringBuffer) int {
+    ch := S.escape(raw)
+    if ch >= 0xD800 && ch < 0xDC00 && S.ch == '\\' && S.peek() == 'u' {
+        low := S.escape(raw)
+        if low >= 0xDC00 && low < 0xE000 {
+            return 0x10000 + (ch - 0xD800) << 10 + (low - 0xDC00)
+        }
+        S.error(ErrIllegalEscape, "illegal surrogate pair in " + raw.String())
+        return -1
+    }
+    return ch
+}
+
+func (S *Lexer) escape(raw *util.StringBuffer) int {
+    raw.Append(S.ch); S.Consume() // '\\'
+    ch := S.ch
+    switch ch {
+        case 'b': ch = '\b'
+        case 't': ch = '\t'
+        case 'n': ch = '\n'
+        case 'f': ch = '\f'
+        case 'r': ch = '\r'
+        case '"', '\'', '\\', '$':
+        case 'u':
+            for S.ch == 'u' {
+                raw.Append(S.ch); S.Consume()
+            }
+            v := 0
+            for i := 0; i < 4; i++ {
+                if digitVal(S.ch) >= 16 {
+                    S.error(ErrIllegalEscape, "illegal unicode escape")
+                    return -1
+                }
+                v = v*16 + digitVal(S.ch)
+                raw.Append(S.ch); S.Consume()
+            }
+            return v
+        case '0', '1', '2', '3', '4', '5', '6', '7':
+            v := 0
+            max := 3
+            if ch > '3' { max = 2 }
+            for i := 0; i < max && S.ch >= '0' && S.ch <= '7'; i++ {
+                v = v*8 + digitVal(S.ch)
+                raw.Append(S.ch); S.Consume()
+            }
+            return v
+        default:
+            S.error(ErrIllegalEscape, fmt.Sprintf("illegal escape character '%c'", ch))
+            return -1
+    }
+    raw.Append(S.ch); S.Consume()
+    return ch
+}
+
+//
+// comment
+//     :   '//' ~('\n'|'\r')*
+//     |   '/*' .* '*/'
+//     |   '/**' .* '*/'
+//
+func (S *Lexer) Comment() *Trivia {
+    start := S.pos()
+    buf := util.NewStringBuffer()
+    buf.Append(S.ch); S.Consume() // '/'
+    kind := LINE_COMMENT
+    if S.ch == '/' {
+        for S.ch != '\n' && S.ch != '\r' && S.ch != EOF {
+            buf.Append(S.ch); S.Consume()
+        }
+    } else {
+        buf.Append(S.ch); S.Consume() // '*'
+        kind = BLOCK_COMMENT
+        if S.ch == '*' && S.peek() != '/' { // but "/**/" is empty
+            kind = DOC_COMMENT
+        }
+        for {
+            if S.ch == EOF {
+                S.error(ErrUnterminatedComment, "comment not terminated")
+                break
+            }
+            if S.ch == '*' && S.peek() == '/' {
+                buf.Append(S.ch); S.Consume()
+                buf.Append(S.ch); S.Consume()
+                break
+            }
+            buf.Append(S.ch); S.Consume()
+        }
+    }
+    return &Trivia{Kind: kind, Text: buf.String(),
+                   Span: Span{File: S.file, Start: start, End: S.pos()}}
+}
+
+//
+// comments after t up to the end of the line
+//
+func (S *Lexer) trailingTrivia(t *Token) {
+    for {
+        S.WS()
+        if S.ch != '/' || (S.peek() != '/' && S.peek() != '*') {
+            return
+        }
+        c := S.Comment()
+        t.trailing = append(t.trailing, c)
+        if c.Kind == LINE_COMMENT {
+            return
+        }
     }
-    return nil
 }
 
 func (S *Lexer) WS() {
@@ -173,9 +796,22 @@ func (S *Lexer) EOL() *Token {
     } else if S.ch == '\n' {  // LF
         S.Consume()
     }
-    return &Token{tokenType: EOL, text:"<EOL>"}
+    return S.token(EOL, "<EOL>")
 }
 
-func (S *Lexer) error(msg string) {
-    panic(msg)
+//
+// error reports a problem at the current character.
+//
+func (S *Lexer) error(code Error, msg string) {
+    S.diags.Errorf(code, Span{File: S.file, Start: S.pos(), End: S.nextPos()}, "%s", msg)
+}
+
+//
+// errorAt reports a problem at a byte offset while the current
+// character is being decoded, i.e. one character after pos().
+//
+func (S *Lexer) errorAt(offset int, code Error, msg string) {
+    p := Position{Line: S.line, Column: S.column + 1, Offset: offset}
+    if S.ch == '\n' { p.Line++; p.Column = 1 }
+    S.diags.Errorf(code, Span{File: S.file, Start: p, End: p}, "%s", msg)
 }
@@ -50,4 +50,234 @@ func TestToken(t *testing.T) {
     if tok.GetTokenType() != compiler.PACKAGE {
         t.Fatalf("Fail : PACKAGE not found")
     }
-}
\ No newline at end of file
+}
+
+func TestTokenSpan(t *testing.T) {
+    l := new(compiler.Lexer).InitFile("A.kt", "package a\n  class xyz")
+    expect := []struct{ line, col, offset, endCol int }{
+        {1, 1, 0, 8},   // package
+        {1, 9, 8, 10},  // a
+        {1, 10, 9, 1},  // <EOL>
+        {2, 3, 12, 8},  // class
+        {2, 9, 18, 12}, // xyz
+    }
+    for i := 0; i < len(expect); i++ {
+        span := l.NextToken().GetSpan()
+        e := expect[i]
+        if span.File != "A.kt" {
+            t.Fatalf("token %d: file = %s", i, span.File)
+        }
+        if span.Start.Line != e.line || span.Start.Column != e.col ||
+           span.Start.Offset != e.offset || span.End.Column != e.endCol {
+            t.Fatalf("token %d: span = %v-%v", i, span.Start, span.End)
+        }
+    }
+}
+
+func TestInvalidCharacter(t *testing.T) {
+    l := new(compiler.Lexer).Init("a # b")
+    if tok := l.NextToken(); tok.GetText() != "a" {
+        t.Fatalf("expect 'a', found '%s'", tok.GetText())
+    }
+    if tok := l.NextToken(); tok.GetText() != "b" {
+        t.Fatalf("expect 'b', found '%s'", tok.GetText())
+    }
+    diags := l.Diagnostics().Items()
+    if len(diags) != 1 || diags[0].Code != compiler.ErrIllegalChar {
+        t.Fatalf("expect one illegal character, found %v", diags)
+    }
+    if diags[0].Span.Start.Column != 3 {
+        t.Fatalf("wrong position: %v", diags[0].Span)
+    }
+}
+
+func TestNumberLiterals(t *testing.T) {
+    expect := []struct {
+        src       string
+        tokenType compiler.TokenType
+        value     interface{}
+    }{
+        {"0",           compiler.INT_LITERAL,    int32(0)},
+        {"1_000_000",   compiler.INT_LITERAL,    int32(1000000)},
+        {"0x7fff_ffff", compiler.INT_LITERAL,    int32(2147483647)},
+        {"0xFFFFFFFF",  compiler.INT_LITERAL,    int32(-1)},
+        {"017",         compiler.INT_LITERAL,    int32(15)},
+        {"0b1010",      compiler.INT_LITERAL,    int32(10)},
+        {"10L",         compiler.LONG_LITERAL,   int64(10)},
+        {"0x1l",        compiler.LONG_LITERAL,   int64(1)},
+        {"1.5",         compiler.DOUBLE_LITERAL, float64(1.5)},
+        {".5e1",        compiler.DOUBLE_LITERAL, float64(5)},
+        {"1e-2d",       compiler.DOUBLE_LITERAL, float64(0.01)},
+        {"2f",          compiler.FLOAT_LITERAL,  float32(2)},
+        {"3.25F",       compiler.FLOAT_LITERAL,  float32(3.25)},
+    }
+    for _, e := range expect {
+        l := new(compiler.Lexer).Init(e.src)
+        tok := l.NextToken()
+        if tok.GetTokenType() != e.tokenType || tok.GetText() != e.src {
+            t.Fatalf("%s: wrong token %s '%s'", e.src, tok.GetTokenType(), tok.GetText())
+        }
+        if tok.GetValue() != e.value {
+            t.Fatalf("%s: wrong value %v", e.src, tok.GetValue())
+        }
+        if l.Diagnostics().Len() != 0 {
+            t.Fatalf("%s: unexpected %s", e.src, l.Diagnostics().Items()[0])
+        }
+    }
+}
+
+func TestMalformedNumbers(t *testing.T) {
+    for _, src := range []string{"09", "0x", "1_", "1e", "2147483649", "0b102", "12abc"} {
+        l := new(compiler.Lexer).Init(src)
+        l.NextToken()
+        if l.Diagnostics().Len() != 1 {
+            t.Fatalf("%s: expect an error", src)
+        }
+    }
+}
+
+func TestStringAndCharLiterals(t *testing.T) {
+    l := new(compiler.Lexer).Init(`"a\tb\"A\101นี้😀" 'x' '\n' 'ก' true null`)
+    tok := l.NextToken()
+    if tok.GetTokenType() != compiler.STRING_LITERAL {
+        t.Fatalf("STRING_LITERAL not found")
+    }
+    if tok.GetValue() != "a\tb\"AAนี้\U0001F600" {
+        t.Fatalf("wrong string value %q", tok.GetValue())
+    }
+    for _, ch := range []int{'x', '\n', 'ก'} {
+        tok = l.NextToken()
+        if tok.GetTokenType() != compiler.CHAR_LITERAL || tok.GetValue() != ch {
+            t.Fatalf("wrong char %s %v", tok.GetText(), tok.GetValue())
+        }
+    }
+    if tok = l.NextToken(); tok.GetTokenType() != compiler.TRUE || tok.GetValue() != true {
+        t.Fatalf("true not found")
+    }
+    if tok = l.NextToken(); tok.GetTokenType() != compiler.NULL || tok.GetValue() != nil {
+        t.Fatalf("null not found")
+    }
+    if l.Diagnostics().Len() != 0 {
+        t.Fatalf("unexpected %s", l.Diagnostics().Items()[0])
+    }
+}
+
+func TestUnterminatedString(t *testing.T) {
+    l := new(compiler.Lexer).Init("\"abc\nx")
+    if tok := l.NextToken(); tok.GetValue() != "abc" {
+        t.Fatalf("wrong value %v", tok.GetValue())
+    }
+    if l.Diagnostics().Len() != 1 || l.Diagnostics().Items()[0].Code != compiler.ErrUnterminatedString {
+        t.Fatalf("expect unterminated string")
+    }
+}
+
+func TestCommentTrivia(t *testing.T) {
+    l := new(compiler.Lexer).Init(
+        "// header\n"             +
+        "/** Doc of A */\n"       +
+        "class /* c */ A // tail\n" +
+        "x / y")
+    tok := l.NextToken()    // EOL after header
+    if tok.GetTokenType() != compiler.EOL || len(tok.GetLeading()) != 1 ||
+       tok.GetLeading()[0].Text != "// header" || tok.GetLeading()[0].Kind != compiler.LINE_COMMENT {
+        t.Fatalf("line comment not found")
+    }
+    l.NextToken()           // EOL after doc
+    tok = l.NextToken()
+    if tok.GetTokenType() != compiler.CLASS || tok.GetDoc() == nil ||
+       tok.GetDoc().Text != "/** Doc of A */" || tok.GetDoc().Kind != compiler.DOC_COMMENT {
+        t.Fatalf("doc comment not attached")
+    }
+    if len(tok.GetTrailing()) != 1 || tok.GetTrailing()[0].Kind != compiler.BLOCK_COMMENT {
+        t.Fatalf("trailing block comment not found")
+    }
+    tok = l.NextToken()
+    if tok.GetText() != "A" || len(tok.GetTrailing()) != 1 || tok.GetTrailing()[0].Text != "// tail" {
+        t.Fatalf("trailing line comment not found")
+    }
+    if tok = l.NextToken(); tok.GetTokenType() != compiler.EOL {
+        t.Fatalf("EOL after line comment not found")
+    }
+    l.NextToken()
+    if tok = l.NextToken(); tok.GetTokenType() != compiler.DIV {
+        t.Fatalf("DIV not found")
+    }
+}
+
+func TestStringTemplate(t *testing.T) {
+    l := new(compiler.Lexer).Init(`"a${ {x} }b$y.z" "\$c"`)
+    expect := []struct {
+        tokenType compiler.TokenType
+        text      string
+        value     interface{}
+    }{
+        {compiler.TEMPLATE_BEGIN, `"a${`, "a"},
+        {compiler.LCURL,          "{",    nil},
+        {compiler.IDENT,          "x",    nil},
+        {compiler.RCURL,          "}",    nil},
+        {compiler.TEMPLATE_MID,   "}b$",  "b"},
+        {compiler.IDENT,          "y",    nil},
+        {compiler.TEMPLATE_END,   `.z"`,  ".z"},
+        {compiler.STRING_LITERAL, `"\$c"`, "$c"},
+    }
+    for i, e := range expect {
+        tok := l.NextToken()
+        if tok.GetTokenType() != e.tokenType || tok.GetText() != e.text || tok.GetValue() != e.value {
+            t.Fatalf("token %d: found %s '%s' %v", i, tok.GetTokenType(), tok.GetText(), tok.GetValue())
+        }
+    }
+    if l.Diagnostics().Len() != 0 {
+        t.Fatalf("unexpected %s", l.Diagnostics().Items()[0])
+    }
+}
+
+func TestOperators(t *testing.T) {
+    l := new(compiler.Lexer).Init("a>>>=b?.c?:d..<e*.f->g::h:=i>>j*.5")
+    expect := []compiler.TokenType{
+        compiler.IDENT, compiler.USHR_ASSIGN,
+        compiler.IDENT, compiler.SAFE_DOT,
+        compiler.IDENT, compiler.ELVIS,
+        compiler.IDENT, compiler.RANGE_EXCL,
+        compiler.IDENT, compiler.SPREAD_DOT,
+        compiler.IDENT, compiler.ARROW,
+        compiler.IDENT, compiler.COLON_COLON,
+        compiler.IDENT, compiler.INFER_ASSIGN,
+        compiler.IDENT, compiler.RANGLE, compiler.RANGLE,
+        compiler.IDENT, compiler.STAR, compiler.DOUBLE_LITERAL,
+        compiler.EOF,
+    }
+    for i, tt := range expect {
+        tok := l.NextToken()
+        if tok.GetTokenType() != tt {
+            t.Fatalf("token %d: expect %s, found %s '%s'", i, tt, tok.GetTokenType(), tok.GetText())
+        }
+    }
+    if l.Diagnostics().Len() != 0 {
+        t.Fatalf("unexpected %s", l.Diagnostics().Items()[0])
+    }
+}
+
+func TestKeywordsAndIdentifiers(t *testing.T) {
+    l := new(compiler.Lexer).Init("public synchronized val def x1 _a $b 変数 matches")
+    expect := []struct {
+        tokenType compiler.TokenType
+        text      string
+    }{
+        {compiler.PUBLIC, "public"},
+        {compiler.SYNC,   "synchronized"},
+        {compiler.VAL,    "val"},
+        {compiler.DEF,    "def"},
+        {compiler.IDENT,  "x1"},
+        {compiler.IDENT,  "_a"},
+        {compiler.IDENT,  "$b"},
+        {compiler.IDENT,  "変数"},
+        {compiler.IDENT,  "matches"},
+    }
+    for _, e := range expect {
+        tok := l.NextToken()
+        if tok.GetTokenType() != e.tokenType || tok.GetText() != e.text {
+            t.Fatalf("expect %s '%s', found %s '%s'", e.tokenType, e.text, tok.GetTokenType(), tok.GetText())
+        }
+    }
+}
@@ -39,7 +39,7 @@ func TestBlankType(t *testing.T) {
     parser := new(compiler.Parser).Init(lexer)
     node   := parser.TypeDecl()
 
-    class := CLASS(IDENT("A"),MEMBERS())
+    class := CLASS(MODIFIERS(),IDENT("A"),MEMBERS())
     if node.String() != class {
         t.Fatalf("CLASS not parsed")
     }
@@ -62,7 +62,7 @@ func TestTypeWithMainMethod(t *testing.T) {
             IDENT("main"),
             args,
             "METHOD_BODY")
-    class  := CLASS(IDENT("A"),MEMBERS(mainMethod))
+    class  := CLASS(MODIFIERS(),IDENT("A"),MEMBERS(mainMethod))
 
     if node.String() != class {
         t.Fatalf("CLASS not parsed")
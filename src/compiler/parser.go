@@ -4,21 +4,17 @@ import "container/vector"
 import "util"
 import . "ast"
 import "strconv"
-
-// import "fmt"
+import "unicode"
+import "utf8"
 
 const FAILED = -1
 
-type Error string
-var (
-    NoErr = Error("Successful")
-    ErrRecognition  = Error("Recognition Error")
-    ErrNoViableRule = Error("No viable rule")
-    ErrParseFailed  = Error("Parse failed")
-)
-
-func (e Error) String() string {
-    return string(e)
+//
+// bailout is the panic value used to abandon a rule after
+// a syntax error has been reported.
+//
+type bailout struct {
+    diag *Diagnostic
 }
 
 type Parser struct {
@@ -26,12 +22,18 @@ type Parser struct {
     lookahead *vector.Vector
     markers   *vector.Vector
     p         int
+    last      *Token    // most recently consumed token
+    diags     *DiagnosticList
+    enclosing string    // class whose members are being parsed, for constructors
+    closure   bool      // whether statements are those of a closure, for command calls
+    negated   *Token    // the token right after a unary minus
 
     listMemo  map[int]int
 }
 
 func (this *Parser) Init(input *Lexer) *Parser {
     this.input = input
+    this.diags = input.diags
     this.lookahead = new(vector.Vector)
     this.markers   = new(vector.Vector)
     this.sync(1)
@@ -39,6 +41,7 @@ func (this *Parser) Init(input *Lexer) *Parser {
 }
 
 func (this *Parser) Consume() {
+    this.last = this.LT(1)
     this.p++
     if this.p == this.lookahead.Len() && !this.IsSpeculating() {
         this.p = 0
@@ -92,7 +95,131 @@ func (this *Parser) Match(x TokenType) (t *Token) {
         // fmt.Printf("matched %s\n", t)
         return
     }
-    panic("Token not match. Found:" + t.tokenType.String() + ", Expect: " + tokens[x])
+    this.fail(ErrUnexpectedToken, "expecting '%s', found '%s'", tokens[x], t.text)
+    return
+}
+
+func (this *Parser) Diagnostics() *DiagnosticList {
+    return this.diags
+}
+
+//
+// fail reports a syntax error at LT(1) and abandons the current rule.
+// Nothing is reported while speculating, the caller just backtracks.
+//
+func (this *Parser) fail(code Error, format string, args...interface{}) {
+    var d *Diagnostic
+    if !this.IsSpeculating() && !this.reportedAt(this.LT(1)) {
+        d = this.diags.Errorf(code, this.LT(1).span, format, args...)
+    }
+    panic(bailout{d})
+}
+
+//
+// an error cascading out of nested rules at the same token
+// is reported only once.
+//
+func (this *Parser) reportedAt(t *Token) bool {
+    items := this.diags.Items()
+    if len(items) == 0 { return false }
+    span := items[len(items)-1].Span
+    return span.File == t.span.File && span.Start.Offset == t.span.Start.Offset
+}
+
+//
+// try runs rule and reports whether it finished without a syntax error.
+// Other panics are not ours and propagate.
+//
+func (this *Parser) try(rule func() *Node) (n *Node, ok bool) {
+    defer func() {
+        if e := recover(); e != nil {
+            if _, isBailout := e.(bailout); !isBailout {
+                panic(e)
+            }
+            ok = false
+        }
+    }()
+    n = rule()
+    ok = true
+    return
+}
+
+//
+// Parse parses a whole compilation unit. Syntax errors do not panic,
+// they are returned as diagnostics together with what could be parsed.
+//
+func (this *Parser) Parse() (*Node, []*Diagnostic) {
+    start := this.LT(1)
+    unit, ok := this.try(func() *Node { return this.CompilationUnit() })
+    if !ok {
+        unit = this.node(start, NewNode0("UNIT", this.node(start, NewNode0("ERROR"))))
+    }
+    return unit, this.diags.Items()
+}
+
+//
+// recoverRule parses rule in panic mode: after a syntax error the
+// input is skipped up to the next statement boundary and an ERROR
+// node stands for what could not be parsed.
+//
+func (this *Parser) recoverRule(rule func() *Node) *Node {
+    if this.IsSpeculating() { return rule() }
+    start := this.LT(1)
+    n, ok := this.try(rule)
+    if ok { return n }
+    this.resync()
+    // always make progress, e.g. on a stray '}' at the top level
+    if this.LT(1) == start && this.LA(1) != EOF {
+        this.Consume()
+    }
+    return this.node(start, NewNode0("ERROR"))
+}
+
+//
+// resync skips tokens up to and including the next EOL or ';',
+// or up to (but not including) the '}' closing the current block.
+// Nested blocks are skipped as a whole.
+//
+func (this *Parser) resync() {
+    depth := 0
+    for this.LA(1) != EOF {
+        switch this.LA(1) {
+            case LCURL:
+                depth++
+            case RCURL:
+                if depth == 0 { return }
+                depth--
+                if depth == 0 && this.LA(2) != EOL && this.LA(2) != SEMI {
+                    this.Consume()
+                    return
+                }
+            case EOL, SEMI:
+                if depth == 0 {
+                    this.Consume()
+                    return
+                }
+        }
+        this.Consume()
+    }
+}
+
+func ParseFile(file string, src string) (*Node, []*Diagnostic) {
+    lexer := new(Lexer).InitFile(file, src)
+    return new(Parser).Init(lexer).Parse()
+}
+
+//
+// node stamps n with the span from the start token of a rule
+// up to the last consumed token. A rule that consumed nothing
+// gets an empty span at the start token.
+//
+func (this *Parser) node(start *Token, n *Node) *Node {
+    if n == nil { return nil }
+    end := start.span.Start
+    if this.last != nil && this.last.span.End.Offset > end.Offset {
+        end = this.last.span.End
+    }
+    return n.WithSpan(Span{File: start.span.File, Start: start.span.Start, End: end})
 }
 
 func (this *Parser) Mark() int {
@@ -120,7 +247,7 @@ func (this *Parser) AlreadyParsedRule(memoization map[int]int) bool {
         return false
     }
     if memoI == FAILED {
-        panic(ErrParseFailed)
+        panic(bailout{nil})
     }
     this.Seek(memoI)
     return true
@@ -143,68 +270,173 @@ func (this *Parser) Memoize(memoization map[int]int,
 //
 // Production Rules
 //
+// Each rule is exported so a single construct can be parsed on its own,
+// as the tests do. A rule reports a syntax error as a diagnostic and then
+// panics with a bailout, which only Parse and ParseFile recover from.
 //
+
+// compilationUnit
+//     :   ( (annotations)? packageDeclaration )?
+//         (importDeclaration)*
+//         (typeDeclaration)*
+//
+// UNIT(PACKAGE?, IMPORTS, (CLASS|CASE_CLASS)*)
 func (this *Parser) CompilationUnit() *Node {
-    for this.LA(1) == EOL { this.Match(EOL) }
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    start := this.LT(1)
+    unit := []*Node{}
+
+    // file-level annotations belong to the package,
+    // or to the first type declaration when there is no package
+    var annotations *Node = nil
+    doc := this.LT(1).doc
     if  this.LA(1) == AT && this.LA(2) == IDENT {
-        // TODO: annotations()
+        annotations = this.Annotations()
+        for this.LA(1)==EOL { this.Match(EOL) }
     }
     if  this.LA(1) == PACKAGE {
-        packageDecl := this.PackageDecl()
-        return NewNode0("UNIT", packageDecl)
+        packageDecl := this.recoverRule(func() *Node { return this.PackageDecl() })
+        if annotations != nil && packageDecl.Name == "PACKAGE" {
+            packageDecl.Children = append(packageDecl.Children, annotations)
+            packageDecl.Span = Cover(annotations.Span, packageDecl.Span)
+            annotations = nil
+        }
+        unit = append(unit, packageDecl)
     }
-    if  this.LA(1) == IMPORT {
-        this.ImportDecls()
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+
+    unit = append(unit, this.ImportDecls())
+
+    if annotations != nil {
+        unit = append(unit, this.recoverRule(func() *Node {
+            return withDoc(this.typeDecl(this.Modifiers(annotations.Children...)), doc)
+        }))
     }
-    this.TypeDecls()
-    return nil
+    unit = append(unit, this.TypeDecls().Children...)
+    return this.node(start, NewNode1("UNIT", unit))
 }
 
 func (this *Parser) PackageDecl() *Node {
-    this.Match(PACKAGE)
+    start := this.Match(PACKAGE)
     qname := this.QNAME()
-    return NewNode0("PACKAGE", qname)
+    return this.node(start, NewNode0("PACKAGE", qname))
 }
 
 func (this *Parser) ImportDecls() *Node {
     for this.LA(1)==SEMI || this.LA(1)==EOL {
-        // this.semiOrEol()
+        this.semiOrEol()
     }
+    start := this.LT(1)
     imports := []*Node{}
-    imports = append(imports, this.ImportDecl())
     for this.LA(1) == IMPORT {
-        imports = append(imports, this.ImportDecl())
+        imports = append(imports, this.recoverRule(func() *Node {
+            return this.ImportDecl()
+        }))
+        for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
     }
-    return NewNode1("IMPORTS", imports)
+    return this.node(start, NewNode1("IMPORTS", imports))
 }
 
 func (this *Parser) ImportDecl() *Node {
-    this.Match(IMPORT)
+    start := this.Match(IMPORT)
     foundStatic := false
     if this.LA(1) == STATIC {
         foundStatic = true
         this.Match(STATIC)
     }
     qname := this.QnameForImport()
-    this.semiOrEol()
+    var n *Node
     if foundStatic {
-        return NewNode0("IMPORT_STATIC", qname)
+        n = this.node(start, NewNode0("IMPORT_STATIC", qname))
+    } else {
+        n = this.node(start, NewNode0("IMPORT", qname))
     }
-    return NewNode0("IMPORT", qname)
+    this.semiOrEol()
+    return n
 }
 
+//
+// typeDecls: (typeDecl (';'|EOL)*)*
+//
 func (this *Parser) TypeDecls() *Node {
-    return nil
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    start := this.LT(1)
+    types := []*Node{}
+    for this.LA(1) != EOF {
+        types = append(types, this.recoverRule(func() *Node {
+            return this.TypeDecl()
+        }))
+        for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    }
+    return this.node(start, NewNode1("TYPES", types))
 }
 
 func (this *Parser) IDENT() *Node {
-    return NewNode2("IDENT", this.Match(IDENT).text)
+    t := this.Match(IDENT)
+    return NewNode2("IDENT", t.text).WithSpan(t.span)
 }
 
-// typeDecl: 'class' name '{' '}'
+// typeDecl
+//     :   classDeclaration
+//     |   interfaceDeclaration
+//     |   enumDeclaration
+//     |   annotationTypeDeclaration
 func (this *Parser) TypeDecl() *Node {
     for this.LA(1)==EOL { this.Match(EOL) }
+    doc := this.LT(1).doc
+    return withDoc(this.typeDecl(this.Modifiers()), doc)
+}
+
+func withDoc(n *Node, doc *Trivia) *Node {
+    if doc != nil {
+        n.Doc = doc.Text
+    }
+    return n
+}
 
+// 'class', 'case' 'class', 'interface', 'enum' or '@' 'interface'
+func (this *Parser) isTypeDeclStart() bool {
+    switch this.LA(1) {
+        case CLASS, INTERFACE, ENUM:
+            return true
+        case CASE:
+            return this.LA(2) == CLASS
+        case AT:
+            return this.LA(2) == INTERFACE
+    }
+    return false
+}
+
+func (this *Parser) typeDecl(modifiers *Node) *Node {
+    switch this.LA(1) {
+        case INTERFACE: return this.interfaceDecl(modifiers)
+        case ENUM:      return this.enumDecl(modifiers)
+        case AT:        return this.annotationTypeDecl(modifiers)
+    }
+    return this.classDecl(modifiers)
+}
+
+//
+// declaration builds kind(modifiers, name, parts...), leaving out the
+// missing parts. Modifiers and name come first as in METHOD and FIELD.
+//
+func (this *Parser) declaration(start *Token, kind string, modifiers *Node, name *Node, parts...*Node) *Node {
+    children := []*Node{modifiers, name}
+    for _, p := range parts {
+        if p != nil { children = append(children, p) }
+    }
+    n := this.node(start, NewNode1(kind, children))
+    n.Span = Cover(modifiers.Span, n.Span)
+    return n
+}
+
+// classDeclaration
+//     :   modifiers 'class' IDENTIFIER typeParameters?
+//         ('extends' type)? ('implements' typeList)? classBody
+//     |   modifiers 'case' 'class' IDENTIFIER typeParameters? ('(' argumentDecls ')')?
+//         ('extends' type)? ('implements' typeList)? classBody?
+func (this *Parser) classDecl(modifiers *Node) *Node {
+    start := this.LT(1)
     caseClass := false
 
     if this.LA(1) == CASE {
@@ -212,15 +444,220 @@ func (this *Parser) TypeDecl() *Node {
         this.Match(CASE)
     }
     this.Match(CLASS)
-    name := this.IDENT(); for this.LA(1)==EOL { this.Match(EOL) }
+    name := this.IDENT()
+    typeParams := this.typeParametersOpt()
+
+    // case class Point(int x, int y)
+    var params *Node = nil
+    if caseClass && this.LA(1) == LPAR {
+        this.Match(LPAR)
+        params = this.ArgumentDecls()
+        this.Match(RPAR)
+    }
+    var extends *Node = nil
+    if this.LA(1) == EXTENDS {
+        extendsStart := this.Match(EXTENDS)
+        extends = this.node(extendsStart, NewNode0("EXTENDS", this.Type()))
+    }
+    implements := this.typeListOpt(IMPLEMENTS, "IMPLEMENTS")
+    for this.LA(1)==EOL { this.Match(EOL) }
+
+    var members *Node
+    if caseClass && this.LA(1) != LCURL {
+        members = this.node(this.LT(1), NewNode0("MEMBERS"))
+    } else {
+        members = this.inClass(name.Text, func() *Node { return this.ClassBody() })
+    }
+
+    kind := "CLASS"
+    if(caseClass) {
+        kind = "CASE_CLASS"
+    }
+    return this.declaration(start, kind, modifiers, name, typeParams, params, extends, implements, members)
+}
+
+//
+// inClass runs rule with name as the enclosing class, so that members
+// called name are taken as constructors. Anonymous classes have none.
+// The statements of their methods are no longer those of a closure.
+//
+func (this *Parser) inClass(name string, rule func() *Node) *Node {
+    outer, closure := this.enclosing, this.closure
+    this.enclosing, this.closure = name, false
+    defer func() { this.enclosing, this.closure = outer, closure }()
+    return rule()
+}
+
+// classBody: '{' members '}'
+func (this *Parser) ClassBody() *Node {
+    for this.LA(1)==EOL { this.Match(EOL) }
     this.Match(LCURL)
     members := this.Members()
     this.Match(RCURL)
+    return members
+}
 
-    if(caseClass) {
-        return NewNode0("CASE_CLASS", name, members)
+// typeParameters
+//     :   '<' typeParameter (',' typeParameter)* '>'
+func (this *Parser) typeParametersOpt() *Node {
+    if this.LA(1) != LANGLE { return nil }
+    start := this.Match(LANGLE)
+    params := []*Node{this.TypeParameter()}
+    for this.LA(1) == COMMA {
+        this.Match(COMMA)
+        params = append(params, this.TypeParameter())
+    }
+    this.Match(RANGLE)
+    return this.node(start, NewNode1("TYPE_PARAMS", params))
+}
+
+// typeParameter
+//     :   IDENTIFIER ('extends' type ('&' type)*)?
+func (this *Parser) TypeParameter() *Node {
+    start := this.LT(1)
+    name := this.Match(IDENT).text
+    bounds := []*Node{}
+    if this.LA(1) == EXTENDS {
+        this.Match(EXTENDS)
+        bounds = append(bounds, this.Type())
+        for this.LA(1) == AND {
+            this.Match(AND)
+            bounds = append(bounds, this.Type())
+        }
     }
-    return NewNode0("CLASS", name, members)
+    return this.node(start, NewNode3("TYPE_PARAM", name, bounds...))
+}
+
+// (keyword type (',' type)*)?
+func (this *Parser) typeListOpt(keyword TokenType, kind string) *Node {
+    if this.LA(1) != keyword { return nil }
+    start := this.Match(keyword)
+    types := []*Node{this.Type()}
+    for this.LA(1) == COMMA {
+        this.Match(COMMA)
+        types = append(types, this.Type())
+    }
+    return this.node(start, NewNode1(kind, types))
+}
+
+// interfaceDeclaration
+//     :   modifiers 'interface' IDENTIFIER typeParameters? ('extends' typeList)? interfaceBody
+func (this *Parser) interfaceDecl(modifiers *Node) *Node {
+    start := this.Match(INTERFACE)
+    name := this.IDENT()
+    typeParams := this.typeParametersOpt()
+    extends := this.typeListOpt(EXTENDS, "EXTENDS")
+    members := this.inClass(name.Text, func() *Node { return this.ClassBody() })
+    return this.declaration(start, "INTERFACE", modifiers, name, typeParams, extends, members)
+}
+
+// enumDeclaration
+//     :   modifiers 'enum' IDENTIFIER ('implements' typeList)?
+//         '{' enumConstants? ','? (';' classBodyDeclaration*)? '}'
+func (this *Parser) enumDecl(modifiers *Node) *Node {
+    start := this.Match(ENUM)
+    name := this.IDENT()
+    implements := this.typeListOpt(IMPLEMENTS, "IMPLEMENTS")
+    for this.LA(1)==EOL { this.Match(EOL) }
+    this.Match(LCURL);  for this.LA(1)==EOL { this.Match(EOL) }
+
+    constantsStart := this.LT(1)
+    constants := []*Node{}
+    if this.LA(1) == IDENT || this.LA(1) == AT {
+        constants = append(constants, this.EnumConstant())
+        for this.LA(1) == COMMA {
+            this.Match(COMMA);  for this.LA(1)==EOL { this.Match(EOL) }
+            if this.LA(1) != IDENT && this.LA(1) != AT { break }
+            constants = append(constants, this.EnumConstant())
+        }
+    }
+    enumConstants := this.node(constantsStart, NewNode1("ENUM_CONSTANTS", constants))
+    members := this.inClass(name.Text, func() *Node { return this.Members() })
+    this.Match(RCURL)
+    return this.declaration(start, "ENUM", modifiers, name, implements, enumConstants, members)
+}
+
+// enumConstant
+//     :   annotations? IDENTIFIER arguments? classBody?
+func (this *Parser) EnumConstant() *Node {
+    start := this.LT(1)
+    var annotations *Node = nil
+    if this.LA(1) == AT {
+        annotations = this.Annotations()
+        for this.LA(1)==EOL { this.Match(EOL) }
+    }
+    doc := this.LT(1).doc
+    name := this.Match(IDENT).text
+    children := []*Node{}
+    if annotations != nil {
+        children = append(children, annotations)
+    }
+    if this.LA(1) == LPAR {
+        children = append(children, this.Arguments())
+    }
+    if this.LA(1) == LCURL {
+        children = append(children, this.inClass("", func() *Node { return this.ClassBody() }))
+    }
+    return withDoc(this.node(start, NewNode3("ENUM_CONSTANT", name, children...)), doc)
+}
+
+// annotationTypeDeclaration
+//     :   modifiers '@' 'interface' IDENTIFIER annotationTypeBody
+func (this *Parser) annotationTypeDecl(modifiers *Node) *Node {
+    start := this.Match(AT)
+    this.Match(INTERFACE)
+    name := this.IDENT()
+    for this.LA(1)==EOL { this.Match(EOL) }
+    this.Match(LCURL)
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    membersStart := this.LT(1)
+    members := []*Node{}
+    for this.LA(1) != RCURL && this.LA(1) != EOF {
+        members = append(members, this.recoverRule(func() *Node {
+            return this.AnnotationTypeElementDecl()
+        }))
+        for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    }
+    body := this.node(membersStart, NewNode1("MEMBERS", members))
+    this.Match(RCURL)
+    return this.declaration(start, "ANNOTATION_TYPE", modifiers, name, body)
+}
+
+// annotationTypeElementDeclaration
+//     :   modifiers type IDENTIFIER '(' ')' ('default' elementValue)?
+//     |   fieldDeclaration
+//     |   typeDecl
+func (this *Parser) AnnotationTypeElementDecl() *Node {
+    start := this.LT(1)
+    modifiers := this.Modifiers()
+    if this.isTypeDeclStart() {
+        return withDoc(this.typeDecl(modifiers), start.doc)
+    }
+    if !this.isMethodDecl() {
+        return this.fieldDecl(start, modifiers)
+    }
+    t := this.Type()
+    name := this.IDENT()
+    this.Match(LPAR)
+    this.Match(RPAR)
+    children := []*Node{modifiers, t, name}
+    if this.LA(1) == DEFAULT {
+        defaultStart := this.Match(DEFAULT)
+        children = append(children, this.node(defaultStart, NewNode0("DEFAULT", this.ElementValue())))
+    }
+    return withDoc(this.node(start, NewNode1("ANNOTATION_METHOD", children)), start.doc)
+}
+
+// elementValue
+//     :   conditionalExpression
+//     |   annotation
+//     |   elementValueArrayInitializer
+func (this *Parser) ElementValue() *Node {
+    switch this.LA(1) {
+        case AT:    return this.Annotation()
+        case LCURL: return this.ElementValueArrayInitializer()
+    }
+    return this.ConditionalExpression()
 }
 
 func (this *Parser) semiOrEol() {
@@ -229,7 +666,7 @@ func (this *Parser) semiOrEol() {
         case EOL:  this.Match(EOL);  return
         case EOF:  this.Match(EOF);  return
     }
-    panic("Expect semi-colon or EOL")
+    this.fail(ErrExpectSemiOrEol, "expecting ';' or end of line, found '%s'", this.LT(1).text)
 }
 
 func (this *Parser) Members() *Node {
@@ -237,28 +674,108 @@ func (this *Parser) Members() *Node {
     for this.LA(1)==SEMI || this.LA(1)==EOL {
         this.semiOrEol()
     }
-    for this.LA(1) != RCURL {
-        members = append(members, this.MemberDecl())
+    start := this.LT(1)
+    for this.LA(1) != RCURL && this.LA(1) != EOF {
+        members = append(members, this.recoverRule(func() *Node {
+            return this.MemberDecl()
+        }))
+        for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
     }
+    n := this.node(start, NewNode1("MEMBERS", members))
 
     for this.LA(1)==EOL { this.Match(EOL) }
 
-    return NewNode1("MEMBERS", members)
+    return n
 }
 
+// memberDecl
+//     :   modifiers block
+//     |   constructorDeclaration
+//     |   methodDeclaration
+//     |   fieldDeclaration
+//     |   typeDecl
 func (this *Parser) MemberDecl() *Node {
-    //if(LA(1) in MODIFIER_LIST)
-    //fieldDecl()
-    return this.MethodDecl()
+    for this.LA(1)==EOL { this.Match(EOL) }
+    start := this.LT(1)
+    modifiers := this.Modifiers()
+    var n *Node
+    switch {
+        case this.isTypeDeclStart():
+            n = withDoc(this.typeDecl(modifiers), start.doc)
+        case this.LA(1) == LCURL:
+            n = this.node(start, NewNode0("INIT_BLOCK", modifiers, this.Block()))
+        case this.LA(1) == IDENT && this.LA(2) == LPAR && this.LT(1).text == this.enclosing:
+            return this.constructorDecl(start, modifiers)
+        case this.isMethodDecl():
+            return this.methodDecl(start, modifiers)
+        default:
+            n = this.fieldDecl(start, modifiers)
+    }
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    return n
+}
+
+// [type] IDENTIFIER '('
+func (this *Parser) isMethodDecl() bool {
+    if this.LA(1) == IDENT && this.LA(2) == LPAR { return true }
+    return this.speculate(func() {
+        this.Type()
+        this.Match(IDENT)
+        this.Match(LPAR)
+    })
+}
+
+// constructorDeclaration
+//     :   modifiers IDENTIFIER '(' argumentDecls ')' methodBody
+func (this *Parser) constructorDecl(start *Token, modifiers *Node) *Node {
+    name := this.IDENT()
+    this.Match(LPAR)
+    argDecls := this.ArgumentDecls()
+    this.Match(RPAR);  for this.LA(1)==EOL { this.Match(EOL) }
+    body := this.MethodBodyDecl()
+    n := withDoc(this.node(start, NewNode0("CONSTRUCTOR", modifiers, name, argDecls, body)), start.doc)
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    return n
+}
+
+// fieldDeclaration
+//     :   modifiers type? variableDeclarator (',' variableDeclarator)*
+//
+// Without a type the field is a java.lang.Object, see ArgumentDecl.
+//
+func (this *Parser) fieldDecl(start *Token, modifiers *Node) *Node {
+    t := DEFAULT_TYPE
+    if !this.isUntypedField() {
+        t = this.Type()
+    }
+    children := []*Node{modifiers, t, this.VariableDeclarator()}
+    for this.LA(1) == COMMA {
+        this.Match(COMMA)
+        children = append(children, this.VariableDeclarator())
+    }
+    return withDoc(this.node(start, NewNode1("FIELD", children)), start.doc)
+}
+
+// a name directly followed by '=', ',' or the end of the declaration
+func (this *Parser) isUntypedField() bool {
+    if this.LA(1) != IDENT { return false }
+    switch this.LA(2) {
+        case EQUAL, COMMA, SEMI, EOL, RCURL, EOF:
+            return true
+    }
+    return false
 }
 
 func (this *Parser) MethodDecl() *Node  {
     for this.LA(1)==EOL { this.Match(EOL) }
 
-    modifiers := this.Modifiers()
+    start := this.LT(1)
+    return this.methodDecl(start, this.Modifiers())
+}
 
+func (this *Parser) methodDecl(start *Token, modifiers *Node) *Node {
     var returnType *Node = nil
-    if this.LA(2) == IDENT {
+    if this.LA(1) != IDENT || this.LA(2) != LPAR {
         returnType = this.Type()
     }
     methodName := this.IDENT()
@@ -272,130 +789,867 @@ func (this *Parser) MethodDecl() *Node  {
         body = this.MethodBodyDecl()
     }
 
+    var n *Node
+    if body == nil {
+        n = this.node(start, NewNode0("INTERFACE_METHOD", modifiers, returnType, methodName, argDecls))
+    } else {
+        n = this.node(start, NewNode0("METHOD", modifiers, returnType, methodName, argDecls, body))
+    }
+    withDoc(n, start.doc)
+
     for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
 
-    if body == nil {
-        return NewNode0("INTERFACE_METHOD", modifiers, returnType, methodName, argDecls)
+    return n
+}
+
+var primitiveTypes = map[TokenType]bool {
+    VOID:    true,
+    BOOLEAN: true,
+    BYTE:    true,
+    CHAR:    true,
+    SHORT:   true,
+    INT:     true,
+    LONG:    true,
+    FLOAT:   true,
+    DOUBLE:  true,
+}
+
+//
+// type
+//     :   (primitiveType | qname typeArguments?) ('[' ']')*
+//
+func (this *Parser) Type() *Node {
+    start := this.LT(1)
+    var name string
+    children := []*Node{}
+    if primitiveTypes[this.LA(1)] {
+        name = this.Match(this.LA(1)).text
+    } else {
+        name = this.QNAME().Text
+        if this.LA(1) == LANGLE {
+            children = append(children, this.TypeArguments())
+        }
+    }
+    dim := 0
+    for this.LA(1) == LBRAC && this.LA(2) == RBRAC {
+        this.Match(LBRAC)
+        this.Match(RBRAC)
+        dim++
+    }
+    if dim > 0 {
+        children = append(children, NewNode2("DIM", strconv.Itoa(dim)))
+    }
+    return this.node(start, NewNode3("TYPE", name, children...))
+}
+
+// typeArguments
+//     :   '<' (typeArgument (',' typeArgument)*)? '>'
+//
+// '<>' leaves the arguments to be inferred.
+//
+func (this *Parser) TypeArguments() *Node {
+    start := this.Match(LANGLE)
+    args := []*Node{}
+    if this.LA(1) != RANGLE {
+        args = append(args, this.TypeArgument())
+        for this.LA(1) == COMMA {
+            this.Match(COMMA)
+            args = append(args, this.TypeArgument())
+        }
+    }
+    this.Match(RANGLE)
+    return this.node(start, NewNode1("TYPE_ARGS", args))
+}
+
+// typeArgument
+//     :   type
+//     |   '?' (('extends' | 'super') type)?
+func (this *Parser) TypeArgument() *Node {
+    start := this.LT(1)
+    if this.LA(1) != QUESTION {
+        return this.Type()
+    }
+    this.Match(QUESTION)
+    switch this.LA(1) {
+        case EXTENDS, SUPER:
+            bound := this.Match(this.LA(1)).text
+            return this.node(start, NewNode3("WILDCARD", bound, this.Type()))
+    }
+    return this.node(start, NewNode0("WILDCARD"))
+}
+
+var modifiers = map[TokenType]bool {
+    AT:       true,
+    PUBLIC:   true,
+    PROTECTED:true,
+    PRIVATE:  true,
+    STATIC:   true,
+    ABSTRACT: true,
+    FINAL:    true,
+    NATIVE:   true,
+    SYNC:     true,
+    TRANSIENT:true,
+    VOLATILE: true,
+    STRICTFP: true,
+}
+
+//
+// methodBodyDecl: { blockStatement* }
+//
+func (this *Parser) MethodBodyDecl() *Node {
+    // println "methodBodyDecl"
+    start := this.Match(LCURL);  for this.LA(1)==EOL { this.Match(EOL) }
+    blockStmts := this.blockStatements()
+    this.Match(RCURL)
+    return this.node(start, NewNode1("METHOD_BODY", blockStmts))
+}
+
+//
+// block: { blockStatement* }
+//
+func (this *Parser) Block() *Node {
+    start := this.Match(LCURL);  for this.LA(1)==EOL { this.Match(EOL) }
+    blockStmts := this.blockStatements()
+    this.Match(RCURL)
+    return this.node(start, NewNode1("BLOCK", blockStmts))
+}
+
+// statements up to the closing '}', each followed by ';' or EOL
+func (this *Parser) blockStatements() []*Node {
+    blockStmts := []*Node{}
+    for this.LA(1) != RCURL && this.LA(1) != EOF {
+        blockStmts = append(blockStmts, this.recoverRule(func() *Node {
+            return this.BlockStatement()
+        }))
+        for this.LA(1)==SEMI || this.LA(1)==EOL {
+        	this.semiOrEol()
+    	}
+    }
+    return blockStmts
+}
+
+// blockStatement
+//     :   localVariableDeclarationStatement
+//     |   classOrInterfaceDeclaration
+//     |   statement
+func (this *Parser) BlockStatement() *Node {
+    // a,b
+    if this.LA(1) == IDENT && this.LA(2) == COMMA {
+        return this.MultipleVarDeclStmt()
+    // a :=
+    } else if this.LA(1) == IDENT && this.LA(2) == INFER_ASSIGN {
+        return this.InferLocalVarDeclStmt()
+    // a =
+    } else if this.LA(1) == IDENT && this.LA(2) == EQUAL {
+        return this.LocalVarDeclStmt()
+    // class A { }
+    } else if this.isTypeDeclStart() || this.isLocalTypeDecl() {
+        start := this.LT(1)
+        return withDoc(this.typeDecl(this.Modifiers()), start.doc)
+    // println it
+    } else if this.isCommandCall() {
+        return this.CommandCall()
+    // int a, String b
+    } else if this.isLocalVariableDeclaration() {
+        return this.LocalVariableDeclaration()
+    }
+    return this.Statement()
+}
+
+//
+// In a closure, as in Groovy, println it calls println: a name starting
+// a statement and followed by an argument is a local variable type only
+// when it begins with an upper case letter.
+//
+func (this *Parser) isCommandCall() bool {
+    if !this.closure || this.LA(1) != IDENT { return false }
+    if next := this.LA(2); next == LPAR || !castFollow[next] && next != TEMPLATE_BEGIN {
+        return false
+    }
+    first, _ := utf8.DecodeRuneInString(this.LT(1).text)
+    return !unicode.IsUpper(first)
+}
+
+// commandCall: IDENTIFIER expression (',' expression)*
+func (this *Parser) CommandCall() *Node {
+    start := this.LT(1)
+    name := this.Match(IDENT).text
+    args := []*Node{this.Expression()}
+    for this.LA(1) == COMMA {
+        this.Match(COMMA)
+        args = append(args, this.Expression())
+    }
+    arguments := NewNode1("ARGUMENTS", args).WithSpan(Cover(args[0].Span, args[len(args)-1].Span))
+    call := this.node(start, NewNode3("CALL", name, nil, arguments))
+    return this.node(start, NewNode0("STMT", call))
+}
+
+//
+// a(,b)+ (:)?= expression
+//
+// a, b := f() declares a and b, a, b = f() assigns to them.
+//
+func (this *Parser) MultipleVarDeclStmt() *Node {
+    start := this.LT(1)
+    names := []*Node{this.IDENT()}
+    for this.LA(1) == COMMA {
+        this.Match(COMMA)
+        names = append(names, this.IDENT())
+    }
+    op := this.LT(1)
+    if op.tokenType == INFER_ASSIGN {
+        this.Match(INFER_ASSIGN)
+        for _, n := range names { n.Name = "LOCAL_VAR" }
+    } else {
+        this.Match(EQUAL)
+    }
+    vars := NewNode1("VARS", names)
+    expr := this.Expression()
+    return this.node(start, NewNode3("MULTI_ASSIGN", op.text, vars, expr))
+}
+
+func (this *Parser) InferLocalVarDeclStmt() *Node {
+    start := this.LT(1)
+    ident := this.IDENT()
+    ident.Name = "LOCAL_VAR"
+    this.Match(INFER_ASSIGN)
+    expr := this.Expression()
+    return this.node(start, NewNode0("INFER_ASSIGN", ident, expr))
+}
+
+func (this *Parser) LocalVarDeclStmt() *Node {
+    start := this.LT(1)
+    ident := this.IDENT()
+    this.Match(EQUAL)
+    expr := this.Expression()
+    return this.node(start, NewNode0("ASSIGN", ident, expr))
+}
+
+// modifiers followed by a class, interface or enum
+func (this *Parser) isLocalTypeDecl() bool {
+    if !modifiers[this.LA(1)] { return false }
+    return this.speculate(func() {
+        this.Modifiers()
+        if !this.isTypeDeclStart() {
+            this.fail(ErrNoViableRule, "not a type declaration")
+        }
+    })
+}
+
+// variableModifiers type IDENTIFIER
+func (this *Parser) isLocalVariableDeclaration() bool {
+    tok := this.LA(1)
+    if tok != IDENT && tok != FINAL && tok != AT && !primitiveTypes[tok] {
+        return false
+    }
+    return this.speculate(func() {
+        this.Modifiers()
+        this.Type()
+        this.Match(IDENT)
+    })
+}
+
+// localVariableDeclaration
+//     :   variableModifiers type
+//         variableDeclarator
+//         (',' variableDeclarator
+//         )*
+func (this *Parser) LocalVariableDeclaration() *Node {
+    start := this.LT(1)
+    modifiers := this.Modifiers()
+    t := this.Type()
+    vars := []*Node{modifiers, t, this.VariableDeclarator()}
+    for this.LA(1) == COMMA {
+        this.Match(COMMA)
+        vars = append(vars, this.VariableDeclarator())
+    }
+    return this.node(start, NewNode1("LOCAL_VAR_DECL", vars))
+}
+
+// variableDeclarator
+//     :   IDENTIFIER ('=' variableInitializer)?
+func (this *Parser) VariableDeclarator() *Node {
+    start := this.LT(1)
+    name := this.Match(IDENT).text
+    if this.LA(1) == EQUAL {
+        this.Match(EQUAL)
+        return this.node(start, NewNode3("VAR", name, this.VariableInitializer()))
+    }
+    return this.node(start, NewNode2("VAR", name))
+}
+
+// statement
+//     :   block
+//     |   'assert' expression (':' expression)?
+//     |   'if' parExpression statement ('else' statement)?
+//     |   forstatement
+//     |   'while' parExpression statement
+//     |   'do' statement 'while' parExpression
+//     |   trystatement
+//     |   'switch' parExpression '{' switchBlockStatementGroups '}'
+//     |   'synchronized' parExpression block
+//     |   'return' (expression )?
+//     |   'throw' expression
+//     |   'break' (IDENTIFIER)?
+//     |   'continue' (IDENTIFIER)?
+//     |   expression
+//     |   IDENTIFIER ':' statement
+//     |   ';'
+//
+// Statements are terminated by ';' or EOL, which is left to the enclosing block.
+//
+func (this *Parser) Statement() *Node {
+    start := this.LT(1)
+    switch this.LA(1) {
+        case LCURL:
+            return this.Block()
+        case ASSERT:
+            this.Match(ASSERT)
+            cond := this.Expression()
+            if this.LA(1) == COLON {
+                this.Match(COLON)
+                return this.node(start, NewNode0("ASSERT", cond, this.Expression()))
+            }
+            return this.node(start, NewNode0("ASSERT", cond))
+        case IF:
+            return this.IfStatement()
+        case FOR:
+            return this.ForStatement()
+        case WHILE:
+            this.Match(WHILE)
+            cond := this.ParExpression()
+            return this.node(start, NewNode0("WHILE", cond, this.body()))
+        case DO:
+            this.Match(DO)
+            body := this.body()
+            this.skipEolBefore(WHILE)
+            this.Match(WHILE)
+            return this.node(start, NewNode0("DO", body, this.ParExpression()))
+        case TRY:
+            return this.TryStatement()
+        case SWITCH:
+            return this.SwitchStatement()
+        case SYNC:
+            this.Match(SYNC)
+            lock := this.ParExpression()
+            return this.node(start, NewNode0("SYNCHRONIZED", lock, this.Block()))
+        case RETURN:
+            this.Match(RETURN)
+            if this.isEndOfStatement() {
+                return this.node(start, NewNode0("RETURN"))
+            }
+            return this.node(start, NewNode0("RETURN", this.Expression()))
+        case THROW:
+            this.Match(THROW)
+            return this.node(start, NewNode0("THROW", this.Expression()))
+        case BREAK, CONTINUE:
+            name := "BREAK"
+            if this.Match(this.LA(1)).tokenType == CONTINUE { name = "CONTINUE" }
+            if this.LA(1) == IDENT {
+                return this.node(start, NewNode0(name, this.IDENT()))
+            }
+            return this.node(start, NewNode0(name))
+        case SEMI:
+            return this.node(start, NewNode0("EMPTY"))
+        case IDENT:
+            if this.LA(2) == COLON {
+                label := this.IDENT()
+                this.Match(COLON)
+                return this.node(start, NewNode0("LABELED", label, this.body()))
+            }
+    }
+    return this.node(start, NewNode0("STMT", this.Expression()))
+}
+
+// ';', EOL or the end of the enclosing block
+func (this *Parser) isEndOfStatement() bool {
+    switch this.LA(1) {
+        case SEMI, EOL, RCURL, EOF: return true
+    }
+    return false
+}
+
+//
+// skipEolBefore consumes line breaks (and a ';' ending the previous statement)
+// if they are followed by tok, so that 'else', 'catch', 'finally' and the 'while'
+// of a do statement may start a new line.
+//
+func (this *Parser) skipEolBefore(tok TokenType) bool {
+    i := 1
+    for this.LA(i) == EOL || (i == 1 && this.LA(i) == SEMI) { i++ }
+    if this.LA(i) != tok { return false }
+    for ; i > 1; i-- { this.Consume() }
+    return true
+}
+
+// the statement controlled by if, while, for, do or a label
+func (this *Parser) body() *Node {
+    for this.LA(1)==EOL { this.Match(EOL) }
+    return this.Statement()
+}
+
+// parExpression
+//     :   '(' expression ')'
+func (this *Parser) ParExpression() *Node {
+    this.Match(LPAR)
+    e := this.Expression()
+    this.Match(RPAR)
+    return e
+}
+
+// 'if' parExpression statement ('else' statement)?
+func (this *Parser) IfStatement() *Node {
+    start := this.Match(IF)
+    cond := this.ParExpression()
+    then := this.body()
+    if this.skipEolBefore(ELSE) {
+        this.Match(ELSE)
+        return this.node(start, NewNode0("IF", cond, then, this.body()))
+    }
+    return this.node(start, NewNode0("IF", cond, then))
+}
+
+// forstatement
+//     :   'for' '(' variableModifiers type? IDENTIFIER ':' expression ')' statement
+//     |   'for' '(' forInit? ';' expression? ';' expressionList? ')' statement
+//
+// The type of the enhanced for loop variable defaults to Object.
+//
+func (this *Parser) ForStatement() *Node {
+    start := this.Match(FOR)
+    this.Match(LPAR)
+    if this.isForEach() {
+        modifiers := this.Modifiers()
+        t := DEFAULT_TYPE
+        if this.LA(2) != COLON { t = this.Type() }
+        name := this.IDENT()
+        this.Match(COLON)
+        iterable := this.Expression()
+        this.Match(RPAR)
+        return this.node(start, NewNode0("FOR_EACH", modifiers, t, name, iterable, this.body()))
+    }
+
+    initStart := this.LT(1)
+    var init *Node
+    if this.LA(1) == SEMI {
+        init = this.node(initStart, NewNode0("FOR_INIT"))
+    } else if this.LA(1) == IDENT && this.LA(2) == INFER_ASSIGN {
+        init = this.node(initStart, NewNode0("FOR_INIT", this.InferLocalVarDeclStmt()))
+    } else if this.isLocalVariableDeclaration() {
+        init = this.node(initStart, NewNode0("FOR_INIT", this.LocalVariableDeclaration()))
+    } else {
+        init = this.node(initStart, NewNode1("FOR_INIT", this.expressionList()))
+    }
+    this.Match(SEMI)
+
+    var cond *Node = nil
+    if this.LA(1) != SEMI { cond = this.Expression() }
+    this.Match(SEMI)
+
+    updateStart := this.LT(1)
+    update := this.node(updateStart, NewNode0("FOR_UPDATE"))
+    if this.LA(1) != RPAR {
+        update = this.node(updateStart, NewNode1("FOR_UPDATE", this.expressionList()))
+    }
+    this.Match(RPAR)
+    return this.node(start, NewNode0("FOR", init, cond, update, this.body()))
+}
+
+// variableModifiers type? IDENTIFIER ':'
+func (this *Parser) isForEach() bool {
+    return this.speculate(func() {
+        this.Modifiers()
+        if this.LA(2) != COLON { this.Type() }
+        this.Match(IDENT)
+        this.Match(COLON)
+    })
+}
+
+// expressionList
+//     :   expression (',' expression)*
+func (this *Parser) expressionList() []*Node {
+    list := []*Node{this.Expression()}
+    for this.LA(1) == COMMA {
+        this.Match(COMMA)
+        list = append(list, this.Expression())
+    }
+    return list
+}
+
+// trystatement
+//     :   'try' block
+//         (   catches 'finally' block
+//         |   catches
+//         |   'finally' block
+//         )
+func (this *Parser) TryStatement() *Node {
+    start := this.Match(TRY)
+    children := []*Node{this.Block()}
+    for this.skipEolBefore(CATCH) {
+        children = append(children, this.CatchClause())
+    }
+    if this.skipEolBefore(FINALLY) {
+        finallyStart := this.Match(FINALLY)
+        children = append(children, this.node(finallyStart, NewNode0("FINALLY", this.Block())))
+    }
+    if len(children) == 1 {
+        this.fail(ErrUnexpectedToken, "expecting 'catch' or 'finally', found '%s'", this.LT(1).text)
+    }
+    return this.node(start, NewNode1("TRY", children))
+}
+
+// catchClause
+//     :   'catch' '(' variableModifiers type IDENTIFIER ')' block
+func (this *Parser) CatchClause() *Node {
+    start := this.Match(CATCH)
+    this.Match(LPAR)
+    modifiers := this.Modifiers()
+    t := this.Type()
+    name := this.IDENT()
+    this.Match(RPAR)
+    for this.LA(1)==EOL { this.Match(EOL) }
+    return this.node(start, NewNode0("CATCH", modifiers, t, name, this.Block()))
+}
+
+// 'switch' parExpression '{' switchBlockStatementGroup* '}'
+func (this *Parser) SwitchStatement() *Node {
+    start := this.Match(SWITCH)
+    children := []*Node{this.ParExpression()}
+    for this.LA(1)==EOL { this.Match(EOL) }
+    this.Match(LCURL)
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    for this.LA(1) != RCURL && this.LA(1) != EOF {
+        children = append(children, this.SwitchBlockStatementGroup())
+    }
+    this.Match(RCURL)
+    return this.node(start, NewNode1("SWITCH", children))
+}
+
+// switchBlockStatementGroup
+//     :   switchLabel+ blockStatement*
+func (this *Parser) SwitchBlockStatementGroup() *Node {
+    start := this.LT(1)
+    labels := []*Node{this.SwitchLabel()}
+    for this.LA(1) == CASE || this.LA(1) == DEFAULT {
+        labels = append(labels, this.SwitchLabel())
+    }
+    blockStart := this.LT(1)
+    blockStmts := []*Node{}
+    for this.LA(1) != CASE && this.LA(1) != DEFAULT && this.LA(1) != RCURL && this.LA(1) != EOF {
+        blockStmts = append(blockStmts, this.recoverRule(func() *Node {
+            return this.BlockStatement()
+        }))
+        for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    }
+    labels = append(labels, this.node(blockStart, NewNode1("BLOCK", blockStmts)))
+    return this.node(start, NewNode1("CASE_GROUP", labels))
+}
+
+// switchLabel
+//     :   'case' expression ':'
+//     |   'default' ':'
+func (this *Parser) SwitchLabel() *Node {
+    start := this.LT(1)
+    var n *Node
+    if this.LA(1) == DEFAULT {
+        this.Match(DEFAULT)
+        n = NewNode0("DEFAULT")
+    } else {
+        this.Match(CASE)
+        n = NewNode0("CASE", this.Expression())
+    }
+    this.Match(COLON)
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    return this.node(start, n)
+}
+
+// IDENTIFIER '->' or '(' argumentDecls ')' '->'
+func (this *Parser) isLambda() bool {
+    if this.LA(1) == IDENT { return this.LA(2) == ARROW }
+    if this.LA(1) != LPAR { return false }
+    return this.speculate(func() {
+        this.Match(LPAR)
+        this.ArgumentDecls()
+        this.Match(RPAR)
+        this.Match(ARROW)
+    })
+}
+
+// lambdaExpression
+//     :   (IDENTIFIER | '(' argumentDecls ')') '->' (expression | block)
+func (this *Parser) LambdaExpression() *Node {
+    start := this.LT(1)
+    var args *Node
+    if this.LA(1) == IDENT {
+        name := this.IDENT()
+        args = this.node(start, NewNode0("ARGS", NewNode0("ARG", DEFAULT_TYPE, name, nil)))
+    } else {
+        this.Match(LPAR)
+        args = this.ArgumentDecls()
+        this.Match(RPAR)
+    }
+    this.Match(ARROW)
+    if this.LA(1) == LCURL {
+        return this.node(start, NewNode0("LAMBDA", args, this.Block()))
+    }
+    return this.node(start, NewNode0("LAMBDA", args, this.Expression()))
+}
+
+//
+// closure
+//     :   '{' (argumentDecls? '->')? blockStatement* '}'
+//
+// Without '->' the closure takes one argument called 'it'.
+//
+func (this *Parser) Closure() *Node {
+    start := this.Match(LCURL)
+    var args *Node
+    if this.isClosureArgs() {
+        if this.LA(1) == ARROW {
+            args = this.node(this.LT(1), NewNode0("ARGS"))
+        } else {
+            args = this.ArgumentDecls()
+        }
+        this.Match(ARROW)
+    } else {
+        it := NewNode0("ARG", DEFAULT_TYPE, NewNode2("IDENT", "it"), nil)
+        args = this.node(this.LT(1), NewNode0("ARGS", it))
+    }
+    for this.LA(1)==EOL { this.Match(EOL) }
+    bodyStart := this.LT(1)
+    outer := this.closure
+    this.closure = true
+    defer func() { this.closure = outer }()
+    body := this.node(bodyStart, NewNode1("BLOCK", this.blockStatements()))
+    this.Match(RCURL)
+    return this.node(start, NewNode0("CLOSURE", args, body))
+}
+
+// argumentDecls? '->'
+func (this *Parser) isClosureArgs() bool {
+    if this.LA(1) == ARROW { return true }
+    return this.speculate(func() {
+        this.ArgumentDecls()
+        this.Match(ARROW)
+    })
+}
+
+// a closure right after a call or a name is its last argument
+var acceptsClosure = map[string]bool {
+    "IDENT":        true,
+    "FIELD_ACCESS": true,
+    "CALL":         true,
+}
+
+// list.each { ... } is list.each({ ... })
+func (this *Parser) TrailingClosure(start *Token, target *Node) *Node {
+    closure := this.Closure()
+    switch target.Name {
+        case "IDENT":
+            args := NewNode0("ARGUMENTS", closure)
+            return this.node(start, NewNode3("CALL", target.Text, nil, args))
+        case "FIELD_ACCESS":
+            args := NewNode0("ARGUMENTS", closure)
+            return this.node(start, NewNode3("CALL", target.Text, target.At(0), args))
+    }
+    args := target.At(1)
+    args.Children = append(args.Children, closure)
+    args.Span = Cover(args.Span, closure.Span)
+    return this.node(start, target)
+}
+
+// methodRef
+//     :   primary '::' (IDENTIFIER | 'new')
+func (this *Parser) MethodRef(start *Token, target *Node) *Node {
+    this.Match(COLON_COLON)
+    var name string
+    if this.LA(1) == NEW {
+        name = this.Match(NEW).text
+    } else {
+        name = this.Match(IDENT).text
     }
-    return NewNode0("METHOD", modifiers, returnType, methodName, argDecls, body)
+    return this.node(start, NewNode3("METHOD_REF", name, target))
 }
 
 //
-// type: qname []*
+// matchExpression
+//     :   expression? 'match' '{' caseClause* '}'
 //
-func (this *Parser) Type() *Node {
-    qname := this.QNAME()
-    dim := 0
-    if this.LA(1) == LBRAC {
-        this.Match(LBRAC)
-        this.Match(RBRAC)
-        dim++
+// A match without a subject has no child other than its case clauses.
+//
+func (this *Parser) MatchExpression(start *Token, subject *Node) *Node {
+    this.Match(MATCH);  for this.LA(1)==EOL { this.Match(EOL) }
+    this.Match(LCURL)
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
+    children := []*Node{}
+    if subject != nil {
+        children = append(children, subject)
     }
-    if dim > 0 {
-        return NewNode3("TYPE", qname.Text, NewNode2("DIM", strconv.Itoa(dim)))
+    for this.LA(1) != RCURL && this.LA(1) != EOF {
+        children = append(children, this.recoverRule(func() *Node {
+            return this.CaseClause()
+        }))
+        for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
     }
-    return NewNode2("TYPE", qname.Text)
-}
-
-var modifiers = map[TokenType]bool {
-    AT:       true,
-    PUBLIC:   true,
-    PROTECTED:true,
-    STATIC:   true,
-    ABSTRACT: true,
-    FINAL:    true,
-    NATIVE:   true,
-    SYNC:     true,
-    TRANSIENT:true,
-    VOLATILE: true,
-    STRICTFP: true,
+    this.Match(RCURL)
+    return this.node(start, NewNode1("MATCH", children))
 }
 
 //
-// methodBodyDecl: { blockStatement* }
+// caseClause
+//     :   'case' pattern ('if' expression)? '=>' blockStatement*
 //
-func (this *Parser) MethodBodyDecl() *Node {
-    // println "methodBodyDecl"
-    this.Match(LCURL);  for this.LA(1)==EOL { this.Match(EOL) }
-    blockStmts := []*Node{}
-    for this.LA(1) != RCURL {
-        blockStmts = append(blockStmts, this.BlockStatement())
-        for this.LA(1)==SEMI || this.LA(1)==EOL {
-        	this.semiOrEol()
-    	}
+// The body runs up to the next 'case' or the closing '}'.
+//
+func (this *Parser) CaseClause() *Node {
+    start := this.Match(CASE)
+    children := []*Node{this.Pattern()}
+    if this.LA(1) == IF {
+        guardStart := this.Match(IF)
+        children = append(children, this.node(guardStart, NewNode0("GUARD", this.Expression())))
     }
-    this.Match(RCURL)
-    return NewNode1("METHOD_BODY", blockStmts)
-}
+    this.Match(FAT_ARROW)
+    for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
 
-// blockStatement
-//     :   localVariableDeclarationStatement
-//     |   classOrInterfaceDeclaration
-//     |   statement
-func (this *Parser) BlockStatement() *Node {
-    // a,b
-    if this.LA(1) == IDENT && this.LA(2) == COMMA {
-        return this.MultipleVarDeclStmt()
-    // a :=
-    } else if this.LA(1) == IDENT && this.LA(2) == COLON && this.LA(3) == EQUAL {
-        return this.InferLocalVarDeclStmt()
-    // a =
-    } else if this.LA(1) == IDENT && this.LA(2) == EQUAL {
-        return this.LocalVarDeclStmt()
+    bodyStart := this.LT(1)
+    blockStmts := []*Node{}
+    for this.LA(1) != CASE && this.LA(1) != RCURL && this.LA(1) != EOF {
+        blockStmts = append(blockStmts, this.recoverRule(func() *Node {
+            return this.BlockStatement()
+        }))
+        for this.LA(1)==SEMI || this.LA(1)==EOL { this.semiOrEol() }
     }
-    //return this.Statement()
-    return NewNode0("STMT", this.IDENT())
+    children = append(children, this.node(bodyStart, NewNode1("BLOCK", blockStmts)))
+    return this.node(start, NewNode1("CASE_CLAUSE", children))
 }
 
 //
-// a(,b)+ (:)?= expression
+// pattern
+//     :   simplePattern ('|' simplePattern)*
 //
-func (this *Parser) MultipleVarDeclStmt() *Node {
-    return NewNode0("STMT", this.IDENT())
+func (this *Parser) Pattern() *Node {
+    start := this.LT(1)
+    p := this.SimplePattern()
+    if this.LA(1) != OR { return p }
+    alternatives := []*Node{p}
+    for this.LA(1) == OR {
+        this.Match(OR)
+        alternatives = append(alternatives, this.SimplePattern())
+    }
+    return this.node(start, NewNode3("PATTERN", "alternative", alternatives...))
 }
 
-func (this *Parser) InferLocalVarDeclStmt() *Node {
-    ident := this.IDENT()
-    this.Match(COLON)
-    this.Match(EQUAL)
-    expr := this.Expression()
-    return NewNode0("INFER_ASSIGN", ident, expr)
+//
+// simplePattern
+//     :   '_'                                  wildcard
+//     |   '_' ':' type                         type
+//     |   IDENTIFIER ':' type                  type, binding the value
+//     |   IDENTIFIER                           binding
+//     |   qname '(' (pattern (',' pattern)*)? ')'  constructor
+//     |   '-'? literal                         literal
+//     |   '(' pattern ')'
+//
+func (this *Parser) SimplePattern() *Node {
+    start := this.LT(1)
+    switch this.LA(1) {
+        case LPAR:
+            this.Match(LPAR)
+            p := this.Pattern()
+            this.Match(RPAR)
+            return p
+        case MINUS:
+            this.Match(MINUS)
+            lit := this.Literal()
+            return this.node(start, NewNode3("PATTERN", "literal", this.node(start, NewNode0("U_MINUS", lit))))
+        case IDENT:
+            if this.LA(2) == DOT || this.LA(2) == LPAR {
+                return this.ConstructorPattern()
+            }
+            name := this.IDENT()
+            var binding *Node = nil
+            if name.Text != "_" { binding = name }
+            if this.LA(1) == COLON {
+                this.Match(COLON)
+                t := this.Type()
+                if binding == nil {
+                    return this.node(start, NewNode3("PATTERN", "type", t))
+                }
+                return this.node(start, NewNode3("PATTERN", "type", t, binding))
+            }
+            if binding == nil {
+                return this.node(start, NewNode2("PATTERN", "wildcard"))
+            }
+            return this.node(start, NewNode3("PATTERN", "bind", binding))
+    }
+    if _, isLiteral := literals[this.LA(1)]; isLiteral {
+        return this.node(start, NewNode3("PATTERN", "literal", this.Literal()))
+    }
+    this.fail(ErrNoViableRule, "expecting a pattern, found '%s'", this.LT(1).text)
+    return nil
 }
 
-func (this *Parser) LocalVarDeclStmt() *Node {
-    ident := this.IDENT()
-    this.Match(EQUAL)
-    expr := this.Expression()
-    return NewNode0("ASSIGN", ident, expr)
+// qname '(' (pattern (',' pattern)*)? ')'
+func (this *Parser) ConstructorPattern() *Node {
+    start := this.LT(1)
+    qname := this.QNAME()
+    children := []*Node{this.node(start, NewNode2("TYPE", qname.Text))}
+    this.Match(LPAR)
+    if this.LA(1) != RPAR {
+        children = append(children, this.Pattern())
+        for this.LA(1) == COMMA {
+            this.Match(COMMA)
+            children = append(children, this.Pattern())
+        }
+    }
+    this.Match(RPAR)
+    return this.node(start, NewNode3("PATTERN", "constructor", children...))
 }
 
 // expression
-//     :   conditionalExpression
+//     :   lambdaExpression
+//     |   conditionalExpression ('match' matchBody)*
 //         (assignmentOperator expression
 //         )?
 func (this *Parser) Expression() *Node {
+    if this.isLambda() {
+        return this.LambdaExpression()
+    }
+    start := this.LT(1)
     c := this.ConditionalExpression()
-    if this.LA(1) == EQUAL || this.LA(2) == EQUAL {
+    for this.LA(1) == MATCH {
+        c = this.MatchExpression(start, c)
+    }
+    if this.isAssignmentOperator() {
         a := this.AssignmentOperator()
         e := this.Expression()
-        return NewNode0("EXPR", a, e)
+        return this.node(start, NewNode3("ASSIGN_EXPR", a.Text, c, e))
     }
-    return NewNode0("EXPR", c)
+    return c
 }
 
 // conditionalExpression
 //     :   conditionalOrExpression
-//         ('?' expression ':' conditionalExpression
+//         (   '?' expression ':' conditionalExpression
+//         |   '?:' conditionalExpression
 //         )?
+//
+// x ?: y is x unless x is null, then y.
 func (this *Parser) ConditionalExpression() *Node {
-    this.ConditionalOrExpression()
+    start := this.LT(1)
+    c := this.ConditionalOrExpression()
     if this.LA(1) == QUESTION {
         this.Match(QUESTION)
-        this.Expression()
+        a := this.Expression()
         this.Match(COLON)
-        this.ConditionalExpression()
+        b := this.ConditionalExpression()
+        return this.node(start, NewNode0("TERNARY", c, a, b))
     }
-    return nil
+    if this.LA(1) == ELVIS {
+        this.Match(ELVIS)
+        b := this.ConditionalExpression()
+        return this.node(start, NewNode0("ELVIS", c, b))
+    }
+    return c
 }
 
 // conditionalOrExpression
@@ -403,11 +1657,14 @@ func (this *Parser) ConditionalExpression() *Node {
 //         ('||' conditionalAndExpression
 //         )*
 func (this *Parser) ConditionalOrExpression() *Node {
-    this.ConditionalAndExpression()
-    for this.LA(1) == OR && this.LA(2) == OR {
-        this.ConditionalAndExpression()
+    start := this.LT(1)
+    n := this.ConditionalAndExpression()
+    for this.LA(1) == OR_OR {
+        this.Match(OR_OR)
+        r := this.ConditionalAndExpression()
+        n = this.node(start, NewNode3("BIN_OP", "||", n, r))
     }
-    return nil
+    return n
 }
 
 // conditionalAndExpression
@@ -415,11 +1672,14 @@ func (this *Parser) ConditionalOrExpression() *Node {
 //         ('&&' inclusiveOrExpression
 //         )*
 func (this *Parser) ConditionalAndExpression() *Node {
-    this.InclusiveOrExpression()
-    for this.LA(1) == AND && this.LA(2) == AND {
-        this.InclusiveOrExpression()
+    start := this.LT(1)
+    n := this.InclusiveOrExpression()
+    for this.LA(1) == AND_AND {
+        this.Match(AND_AND)
+        r := this.InclusiveOrExpression()
+        n = this.node(start, NewNode3("BIN_OP", "&&", n, r))
     }
-    return nil
+    return n
 }
 
 // inclusiveOrExpression
@@ -427,11 +1687,14 @@ func (this *Parser) ConditionalAndExpression() *Node {
 //         ('|' exclusiveOrExpression
 //         )*
 func (this *Parser) InclusiveOrExpression() *Node {
-    this.ExclusiveOrExpression()
+    start := this.LT(1)
+    n := this.ExclusiveOrExpression()
     for this.LA(1) == OR {
-        this.ExclusiveOrExpression()
+        this.Match(OR)
+        r := this.ExclusiveOrExpression()
+        n = this.node(start, NewNode3("BIN_OP", "|", n, r))
     }
-    return nil
+    return n
 }
 
 // exclusiveOrExpression
@@ -439,11 +1702,14 @@ func (this *Parser) InclusiveOrExpression() *Node {
 //         ('^' andExpression
 //         )*
 func (this *Parser) ExclusiveOrExpression() *Node {
-    this.AndExpression()
+    start := this.LT(1)
+    n := this.AndExpression()
     for this.LA(1) == XOR {
-        this.AndExpression()
+        this.Match(XOR)
+        r := this.AndExpression()
+        n = this.node(start, NewNode3("BIN_OP", "^", n, r))
     }
-    return nil
+    return n
 }
 
 // andExpression
@@ -451,11 +1717,14 @@ func (this *Parser) ExclusiveOrExpression() *Node {
 //         ('&' equalityExpression
 //         )*
 func (this *Parser) AndExpression() *Node {
-    this.EqualityExpression()
+    start := this.LT(1)
+    n := this.EqualityExpression()
     for this.LA(1) == AND {
-        this.EqualityExpression()
+        this.Match(AND)
+        r := this.EqualityExpression()
+        n = this.node(start, NewNode3("BIN_OP", "&", n, r))
     }
-    return nil
+    return n
 }
 
 // equalityExpression
@@ -467,18 +1736,14 @@ func (this *Parser) AndExpression() *Node {
 //             instanceOfExpression
 //         )*
 func (this *Parser) EqualityExpression() *Node {
-    this.InstanceOfExpression()
-    tok1 := this.LA(1)
-    for tok1 == EQUAL || tok1 == NOT {
-        if(tok1 == EQUAL) {
-            this.Match(EQUAL)
-        } else {
-            this.Match(NOT)
-        }
-        this.Match(EQUAL)
-        this.InstanceOfExpression()
+    start := this.LT(1)
+    n := this.InstanceOfExpression()
+    for this.LA(1) == EQ || this.LA(1) == NE {
+        op := this.Match(this.LA(1)).text
+        r := this.InstanceOfExpression()
+        n = this.node(start, NewNode3("BIN_OP", op, n, r))
     }
-    return nil
+    return n
 }
 
 // instanceOfExpression
@@ -486,52 +1751,69 @@ func (this *Parser) EqualityExpression() *Node {
 //         ('instanceof' type
 //         )?
 func (this *Parser) InstanceOfExpression() *Node {
-    this.RelationalExpression()
+    start := this.LT(1)
+    n := this.RelationalExpression()
     if this.LA(1) == INSTANCE_OF {
         this.Match(INSTANCE_OF)
-        this.Type()
+        t := this.Type()
+        return this.node(start, NewNode0("INSTANCE_OF", n, t))
     }
-    return nil
+    return n
 }
 
 //
 // relationalExpression
-//     :   shiftExpression (relationalOp shiftExpression)*
+//     :   rangeExpression (relationalOp rangeExpression)*
 //
 func (this *Parser) RelationalExpression() *Node {
-    this.ShiftExpression()
-    for this.LA(1) == LANGLE || this.LA(1)== RANGLE {
-        this.RelationalOp()
-        this.ShiftExpression()
+    start := this.LT(1)
+    n := this.RangeExpression()
+    for relationalOps[this.LA(1)] {
+        op := this.RelationalOp()
+        r := this.RangeExpression()
+        n = this.node(start, NewNode3("BIN_OP", op.Text, n, r))
     }
-    return nil
+    return n
+}
+
+//
+// rangeExpression
+//     :   shiftExpression (('..' | '..<') shiftExpression)?
+//
+// 1..10 includes 10, 1..<10 does not.
+//
+func (this *Parser) RangeExpression() *Node {
+    start := this.LT(1)
+    n := this.ShiftExpression()
+    if this.LA(1) == RANGE || this.LA(1) == RANGE_EXCL {
+        op := this.Match(this.LA(1)).text
+        r := this.ShiftExpression()
+        return this.node(start, NewNode3("RANGE", op, n, r))
+    }
+    return n
+}
+
+var relationalOps = map[TokenType]bool {
+    LE:     true,
+    GE:     true,
+    LANGLE: true,
+    RANGLE: true,
 }
 
 //
 // relationalOp
-//     :    '<' '='
-//     |    '>' '='
+//     :    '<='
+//     |    '>='
 //     |    '<'
 //     |    '>'
 //
 func (this *Parser) RelationalOp() *Node {
-    tok1,tok2 := this.LA(1),this.LA(2)
-    if tok1 == LANGLE {
-        this.Match(LANGLE)
-        if tok2 == EQUAL {
-            this.Match(EQUAL)
-            return NewNode0("LESS_THAN_OR_EQUAL")
-        }
-        return NewNode0("LESS_THAN")
-    } else if tok1 == RANGLE {
-        this.Match(RANGLE)
-        if tok2 == EQUAL {
-            this.Match(EQUAL)
-            return NewNode0("GREATER_THAN_OR_EQUAL")
-        }
-        return NewNode0("GREATER_THAN")
+    start := this.LT(1)
+    if relationalOps[this.LA(1)] {
+        return this.node(start, NewNode2("OP", this.Match(this.LA(1)).text))
     }
-    panic("Unreachable code")
+    this.fail(ErrNoViableRule, "expecting a relational operator, found '%s'", this.LT(1).text)
+    return nil
 }
 
 // shiftExpression 
@@ -539,27 +1821,44 @@ func (this *Parser) RelationalOp() *Node {
 //         (shiftOp additiveExpression
 //         )*
 func (this *Parser) ShiftExpression() *Node {
-    this.AdditiveExpression()
-    for this.LA(1) == LANGLE || this.LA(1)== RANGLE {
-        this.ShiftOp()
-        this.AdditiveExpression()
+    start := this.LT(1)
+    n := this.AdditiveExpression()
+    for this.isShiftOp() {
+        op := this.ShiftOp()
+        r := this.AdditiveExpression()
+        n = this.node(start, NewNode3("BIN_OP", op.Text, n, r))
     }
-    return nil
+    return n
+}
+
+// '<<', or '>' '>' with nothing in between
+func (this *Parser) isShiftOp() bool {
+    return this.LA(1) == SHL ||
+           (this.LA(1) == RANGLE && this.LA(2) == RANGLE && this.adjacent(1))
+}
+
+// LT(i) and LT(i+1) are written without space in between
+func (this *Parser) adjacent(i int) bool {
+    return this.LT(i).span.End.Offset == this.LT(i+1).span.Start.Offset
 }
 
 // shiftOp 
-//     :    '<' '<'
+//     :    '<<'
 //     |    '>' '>' '>'
 //     |    '>' '>'
 func (this *Parser) ShiftOp() *Node {
-    if this.LA(1) == LANGLE {
-        this.Match(LANGLE)
-        this.Match(LANGLE)
-        return NewNode0("SHL")
+    start := this.LT(1)
+    if this.LA(1) == SHL {
+        this.Match(SHL)
+        return this.node(start, NewNode2("OP", "<<"))
     } else {
         this.Match(RANGLE)
-        this.Match(RANGLE)    
-        return NewNode0("SHR")   
+        this.Match(RANGLE)
+        if this.LA(1) == RANGLE && this.last.span.End.Offset == this.LT(1).span.Start.Offset {
+            this.Match(RANGLE)
+            return this.node(start, NewNode2("OP", ">>>"))
+        }
+        return this.node(start, NewNode2("OP", ">>"))
     }
     panic("Unreachable code")
 }
@@ -573,18 +1872,22 @@ func (this *Parser) ShiftOp() *Node {
 //             multiplicativeExpression
 //          )*
 func (this *Parser) AdditiveExpression() *Node {
-    this.MultiplicativeExpression()
+    start := this.LT(1)
+    n := this.MultiplicativeExpression()
     tok1 := this.LA(1)
     for tok1 == PLUS || tok1 == MINUS {
+        op := "+"
         if tok1 == PLUS {
             this.Match(PLUS)  
         } else {
             this.Match(MINUS)
+            op = "-"
         }
-        this.MultiplicativeExpression()
+        r := this.MultiplicativeExpression()
+        n = this.node(start, NewNode3("BIN_OP", op, n, r))
         tok1 = this.LA(1)
     }
-    return nil
+    return n
 }
 
 // multiplicativeExpression 
@@ -598,20 +1901,16 @@ func (this *Parser) AdditiveExpression() *Node {
 //             unaryExpression
 //         )*
 func (this *Parser) MultiplicativeExpression() *Node {
-    this.UnaryExpression()
+    start := this.LT(1)
+    n := this.UnaryExpression()
     tok := this.LA(1)
     for tok == STAR || tok == DIV || tok == PERCENT {
-        if tok == STAR {
-            this.Match(STAR)
-        } else if tok == DIV {
-            this.Match(DIV)
-        } else {
-            this.Match(PERCENT)
-        }
-        this.UnaryExpression()
+        op := this.Match(tok).text
+        r := this.UnaryExpression()
+        n = this.node(start, NewNode3("BIN_OP", op, n, r))
         tok = this.LA(1)
     }
-    return nil
+    return n
 }
 
 // unaryExpression 
@@ -621,29 +1920,23 @@ func (this *Parser) MultiplicativeExpression() *Node {
 //     |   '--' unaryExpression
 //     |   unaryExpressionNotPlusMinus
 func (this *Parser) UnaryExpression() *Node {
-    tok1, tok2 := this.LA(1), this.LA(2)
-    if tok1 == PLUS {
-        this.Match(PLUS)
-        if tok2 == PLUS {
+    start := this.LT(1)
+    switch this.LA(1) {
+        case PLUS:
             this.Match(PLUS)
-            return NewNode0("INC", this.UnaryExpression())
-        }
-        return NewNode0("U_PLUS", this.UnaryExpression())
-    } else if tok1 == MINUS {
-        this.Match(MINUS)
-        if tok2 == MINUS {
+            return this.node(start, NewNode0("U_PLUS", this.UnaryExpression()))
+        case MINUS:
             this.Match(MINUS)
-            return NewNode0("DEC", this.UnaryExpression())
-        }
-        return NewNode0("U_MINUS", this.UnaryExpression())
-    } else {
-        return this.UnaryExpressionNotPlusMinus()        
+            this.negated = this.LT(1)
+            return this.node(start, NewNode0("U_MINUS", this.UnaryExpression()))
+        case INC:
+            this.Match(INC)
+            return this.node(start, NewNode0("INC", this.UnaryExpression()))
+        case DEC:
+            this.Match(DEC)
+            return this.node(start, NewNode0("DEC", this.UnaryExpression()))
     }
-    panic("Unreachable code")    
-}
-
-func (this *Parser) _UnaryExpressionNotPlusMinus() *Node {
-	return nil
+    return this.UnaryExpressionNotPlusMinus()
 }
 
 // unaryExpressionNotPlusMinus 
@@ -652,28 +1945,471 @@ func (this *Parser) _UnaryExpressionNotPlusMinus() *Node {
 //     |   castExpression
 //     |   primary (selector)* ('++' | '--')?
 func (this *Parser) UnaryExpressionNotPlusMinus() *Node {
+    start := this.LT(1)
     tok1 := this.LA(1)
-    //,tok2,tok3 := this.LA(1),this.LA(2),this.LA(3)
     if tok1 == TILD {
         this.Match(TILD)        
-        return NewNode0("TILD", this.UnaryExpression())
+        return this.node(start, NewNode0("TILD", this.UnaryExpression()))
     } else if tok1 == NOT {
         this.Match(NOT)
-        return NewNode0("NOT", this.UnaryExpression())                
-    } else if tok1 == LPAR {
-        return this.Primary()        
-    } else {
+        return this.node(start, NewNode0("NOT", this.UnaryExpression()))
+    } else if tok1 == LPAR && this.isCast() {
         return this.CastExpression()
     }
-    panic("Unreachable code")    
+    n := this.Primary()
+    for {
+        if selectorStart[this.LA(1)] {
+            n = this.Selector(start, n)
+        } else if this.LA(1) == COLON_COLON {
+            n = this.MethodRef(start, n)
+        } else if this.LA(1) == LCURL && acceptsClosure[n.Name] {
+            n = this.TrailingClosure(start, n)
+        } else {
+            break
+        }
+    }
+    if this.LA(1) == INC {
+        this.Match(INC)
+        return this.node(start, NewNode0("POST_INC", n))
+    } else if this.LA(1) == DEC {
+        this.Match(DEC)
+        return this.node(start, NewNode0("POST_DEC", n))
+    }
+    return n
 }
 
-func (this *Parser) Primary() *Node {
-	return nil
+//
+// speculate runs rule without reporting anything and rewinds
+// the input afterwards. It tells whether rule would succeed.
+//
+func (this *Parser) speculate(rule func()) bool {
+    last := this.last
+    this.Mark()
+    _, ok := this.try(func() *Node { rule(); return nil })
+    this.Release()
+    this.last = last
+    return ok
+}
+
+// '(' type ')' followed by something that can be casted,
+// anything for a primitive type as in (int) -x
+func (this *Parser) isCast() bool {
+    return this.speculate(func() {
+        this.Match(LPAR)
+        t := this.Type()
+        this.Match(RPAR)
+        if !castFollow[this.LA(1)] && !isPrimitive(t) {
+            this.fail(ErrNoViableRule, "not a cast")
+        }
+    })
+}
+
+//
+// tokens that may start the operand of a cast
+//
+var castFollow = map[TokenType]bool {
+    IDENT: true,
+    LPAR:  true,
+    THIS:  true,
+    SUPER: true,
+    NEW:   true,
+    NOT:   true,
+    TILD:  true,
+
+    INT_LITERAL:    true,
+    LONG_LITERAL:   true,
+    FLOAT_LITERAL:  true,
+    DOUBLE_LITERAL: true,
+    CHAR_LITERAL:   true,
+    STRING_LITERAL: true,
+    TRUE:  true,
+    FALSE: true,
+    NULL:  true,
 }
 
+// castExpression
+//     :   '(' primitiveType ')' unaryExpression
+//     |   '(' type ')' unaryExpressionNotPlusMinus
 func (this *Parser) CastExpression() *Node {
-	return nil
+    start := this.Match(LPAR)
+    t := this.Type()
+    this.Match(RPAR)
+    var e *Node
+    if isPrimitive(t) {
+        e = this.UnaryExpression()
+    } else {
+        e = this.UnaryExpressionNotPlusMinus()
+    }
+    return this.node(start, NewNode0("CAST", t, e))
+}
+
+// primary
+//     :   parExpression
+//     |   'this' (arguments)?
+//     |   'super' (arguments)?
+//     |   IDENTIFIER (arguments)?
+//     |   literal
+//     |   creator
+func (this *Parser) Primary() *Node {
+    start := this.LT(1)
+    if _, isLiteral := literals[this.LA(1)]; isLiteral {
+        return this.Literal()
+    }
+    switch this.LA(1) {
+        case LPAR:
+            this.Match(LPAR)
+            e := this.Expression()
+            this.Match(RPAR)
+            return e
+        case THIS, SUPER:
+            t := this.Match(this.LA(1))
+            if this.LA(1) == LPAR {
+                args := this.Arguments()
+                return this.node(start, NewNode3("CALL", t.text, nil, args))
+            }
+            if t.tokenType == THIS {
+                return this.node(start, NewNode0("THIS"))
+            }
+            return this.node(start, NewNode0("SUPER"))
+        case IDENT:
+            if this.LA(2) == LPAR {
+                name := this.Match(IDENT).text
+                args := this.Arguments()
+                return this.node(start, NewNode3("CALL", name, nil, args))
+            }
+            return this.IDENT()
+        case NEW:
+            return this.Creator()
+        case MATCH:
+            return this.MatchExpression(start, nil)
+        case LCURL:
+            return this.Closure()
+        case LBRAC:
+            return this.CollectionLiteral()
+        case TEMPLATE_BEGIN:
+            return this.InterpolatedString()
+    }
+    this.fail(ErrNoViableRule, "expecting an expression, found '%s'", this.LT(1).text)
+    return nil
+}
+
+//
+// interpolatedString
+//     :   TEMPLATE_BEGIN expression (TEMPLATE_MID expression)* TEMPLATE_END
+//
+// The children are the text segments as STRING_LITERAL, empty ones
+// left out, and the embedded expressions in source order.
+//
+func (this *Parser) InterpolatedString() *Node {
+    start := this.LT(1)
+    parts := this.segment([]*Node{}, this.Match(TEMPLATE_BEGIN))
+    for {
+        parts = append(parts, this.Expression())
+        if this.LA(1) != TEMPLATE_MID { break }
+        parts = this.segment(parts, this.Match(TEMPLATE_MID))
+    }
+    parts = this.segment(parts, this.Match(TEMPLATE_END))
+    return this.node(start, NewNode1("INTERPOLATED_STRING", parts))
+}
+
+func (this *Parser) segment(parts []*Node, t *Token) []*Node {
+    text, _ := t.value.(string)
+    if len(text) == 0 { return parts }
+    n := NewNode2("STRING_LITERAL", strconv.Quote(text)).WithSpan(t.span)
+    n.Value = text
+    return append(parts, n)
+}
+
+//
+// collectionLiteral
+//     :   '[' ']'
+//     |   '[' ':' ']'
+//     |   '[' expression (',' expression)* ','? ']'
+//     |   '[' mapEntry (',' mapEntry)* ','? ']'
+//
+// The first element tells a list from a map. There is no set literal,
+// a list stands for a set where one is expected, as in Set s = [1, 2].
+//
+func (this *Parser) CollectionLiteral() *Node {
+    start := this.Match(LBRAC); for this.LA(1)==EOL { this.Match(EOL) }
+    if this.LA(1) == COLON {
+        this.Match(COLON)
+        for this.LA(1)==EOL { this.Match(EOL) }
+        this.Match(RBRAC)
+        return this.node(start, NewNode0("MAP_LITERAL"))
+    }
+    elements := []*Node{}
+    isMap := false
+    for this.LA(1) != RBRAC {
+        if len(elements) == 0 {
+            isMap = this.LA(1) == IDENT && this.LA(2) == COLON || this.isMapEntry()
+        }
+        if isMap {
+            elements = append(elements, this.MapEntry())
+        } else {
+            elements = append(elements, this.Expression())
+        }
+        for this.LA(1)==EOL { this.Match(EOL) }
+        if this.LA(1) != COMMA { break }
+        this.Match(COMMA); for this.LA(1)==EOL { this.Match(EOL) }
+    }
+    this.Match(RBRAC)
+    if isMap {
+        return this.node(start, NewNode1("MAP_LITERAL", elements))
+    }
+    return this.node(start, NewNode1("LIST_LITERAL", elements))
+}
+
+// expression ':'
+func (this *Parser) isMapEntry() bool {
+    return this.speculate(func() {
+        this.Expression()
+        this.Match(COLON)
+    })
+}
+
+//
+// mapEntry
+//     :   (IDENTIFIER | expression) ':' expression
+//
+// A bare name is a string key, [a: 1] is ["a": 1].
+// Use (a): 1 for the value of a variable.
+//
+func (this *Parser) MapEntry() *Node {
+    start := this.LT(1)
+    var key *Node
+    if this.LA(1) == IDENT && this.LA(2) == COLON {
+        t := this.Match(IDENT)
+        key = NewNode2("STRING_LITERAL", strconv.Quote(t.text)).WithSpan(t.span)
+        key.Value = t.text
+    } else {
+        key = this.Expression()
+    }
+    this.Match(COLON); for this.LA(1)==EOL { this.Match(EOL) }
+    value := this.Expression()
+    return this.node(start, NewNode0("ENTRY", key, value))
+}
+
+var literals = map[TokenType]string {
+    INT_LITERAL:    "INT_LITERAL",
+    LONG_LITERAL:   "LONG_LITERAL",
+    FLOAT_LITERAL:  "FLOAT_LITERAL",
+    DOUBLE_LITERAL: "DOUBLE_LITERAL",
+    CHAR_LITERAL:   "CHAR_LITERAL",
+    STRING_LITERAL: "STRING_LITERAL",
+    TRUE:           "BOOLEAN_LITERAL",
+    FALSE:          "BOOLEAN_LITERAL",
+    NULL:           "NULL_LITERAL",
+}
+
+// literal
+//     :   intLiteral
+//     |   longLiteral
+//     |   floatLiteral
+//     |   doubleLiteral
+//     |   charLiteral
+//     |   stringLiteral
+//     |   'true'
+//     |   'false'
+//     |   'null'
+//
+// the node text is the source text, the decoded value is in Value
+func (this *Parser) Literal() *Node {
+    t := this.LT(1)
+    name, isLiteral := literals[t.tokenType]
+    if !isLiteral {
+        this.fail(ErrNoViableRule, "expecting a literal, found '%s'", t.text)
+    }
+    this.Consume()
+    if isMinimum(t) && t != this.negated && !this.IsSpeculating() && !this.reportedAt(t) {
+        kind := "integer"
+        if t.tokenType == LONG_LITERAL { kind = "long" }
+        this.diags.Errorf(ErrNumberTooLarge, t.span, "%s number too large: %s", kind, t.text)
+    }
+    n := NewNode2(name, t.text).WithSpan(t.span)
+    n.Value = t.value
+    return n
+}
+
+// decimal 2147483648 or 9223372036854775808L, only valid right after a unary minus
+func isMinimum(t *Token) bool {
+    if t.text[0] == '0' { return false }
+    switch v := t.value.(type) {
+        case int32:
+            return t.tokenType == INT_LITERAL && v == -1<<31
+        case int64:
+            return t.tokenType == LONG_LITERAL && v == -1<<63
+    }
+    return false
+}
+
+var selectorStart = map[TokenType]bool {
+    DOT:        true,
+    SAFE_DOT:   true,
+    SPREAD_DOT: true,
+    LBRAC:      true,
+}
+
+// selector
+//     :   '.' IDENTIFIER (arguments)?
+//     |   '.' 'class'
+//     |   '?.' IDENTIFIER (arguments)?
+//     |   '*.' IDENTIFIER (arguments)?
+//     |   '[' expression ']'
+//
+// a?.b is SAFE_NAV(a.b): null when a is null.
+// list*.b is SPREAD(list.b): the list of b of every element of list.
+func (this *Parser) Selector(start *Token, target *Node) *Node {
+    switch this.LA(1) {
+        case LBRAC:
+            this.Match(LBRAC)
+            index := this.Expression()
+            this.Match(RBRAC)
+            return this.node(start, NewNode0("INDEX", target, index))
+        case SAFE_DOT:
+            this.Match(SAFE_DOT)
+            return this.node(start, NewNode0("SAFE_NAV", this.member(start, target)))
+        case SPREAD_DOT:
+            this.Match(SPREAD_DOT)
+            return this.node(start, NewNode0("SPREAD", this.member(start, target)))
+    }
+    this.Match(DOT)
+    if this.LA(1) == CLASS {
+        this.Match(CLASS)
+        return this.node(start, NewNode0("CLASS_LITERAL", target))
+    }
+    return this.member(start, target)
+}
+
+// IDENTIFIER (arguments)?
+func (this *Parser) member(start *Token, target *Node) *Node {
+    name := this.Match(IDENT).text
+    if this.LA(1) == LPAR {
+        args := this.Arguments()
+        return this.node(start, NewNode3("CALL", name, target, args))
+    }
+    return this.node(start, NewNode3("FIELD_ACCESS", name, target))
+}
+
+// arguments
+//     :   '(' (expression (',' expression)*)? ')'
+func (this *Parser) Arguments() *Node {
+    start := this.Match(LPAR); for this.LA(1)==EOL { this.Match(EOL) }
+    args := []*Node{}
+    if this.LA(1) != RPAR {
+        args = append(args, this.Expression())
+        for this.LA(1)==EOL { this.Match(EOL) }
+        for this.LA(1) == COMMA {
+            this.Match(COMMA); for this.LA(1)==EOL { this.Match(EOL) }
+            args = append(args, this.Expression())
+            for this.LA(1)==EOL { this.Match(EOL) }
+        }
+    }
+    this.Match(RPAR)
+    return this.node(start, NewNode1("ARGUMENTS", args))
+}
+
+// creator
+//     :   'new' type arguments (classBody)?
+//     |   'new' type ('[' expression ']')+ ('[' ']')*
+//     |   'new' type ('[' ']')+ arrayInitializer
+func (this *Parser) Creator() *Node {
+    start := this.Match(NEW)
+    t := this.Type()
+    switch this.LA(1) {
+        case LPAR:
+            args := this.Arguments()
+            if this.LA(1) == LCURL {
+                this.Match(LCURL)
+                members := this.inClass("", func() *Node { return this.Members() })
+                this.Match(RCURL)
+                return this.node(start, NewNode0("NEW", t, args, members))
+            }
+            return this.node(start, NewNode0("NEW", t, args))
+        case LBRAC:
+            dims := []*Node{nil}
+            for this.LA(1) == LBRAC && this.LA(2) != RBRAC {
+                this.Match(LBRAC)
+                dims = append(dims, this.Expression())
+                this.Match(RBRAC)
+            }
+            n := len(dims) - 1
+            for this.LA(1) == LBRAC {
+                this.Match(LBRAC)
+                this.Match(RBRAC)
+                n++
+            }
+            dims[0] = arrayOf(t, n)
+            return this.node(start, NewNode1("NEW_ARRAY", dims))
+        case LCURL:
+            if t.F("DIM") != nil {
+                init := this.ArrayInitializer()
+                return this.node(start, NewNode0("NEW_ARRAY", t, init))
+            }
+    }
+    this.fail(ErrNoViableRule, "expecting '(' or '[' after 'new %s'", t.Text)
+    return nil
+}
+
+//
+// arrayOf adds dim dimensions to type t
+//
+func arrayOf(t *Node, dim int) *Node {
+    if d := t.F("DIM"); d != nil {
+        n, _ := strconv.Atoi(d.Text)
+        dim += n
+    }
+    children := []*Node{}
+    for _, c := range t.Children {
+        if c.Name != "DIM" { children = append(children, c) }
+    }
+    children = append(children, NewNode2("DIM", strconv.Itoa(dim)))
+    return NewNode3(t.Name, t.Text, children...).WithSpan(t.Span)
+}
+
+// arrayInitializer
+//     :   '{' (variableInitializer (',' variableInitializer)* )? (',')? '}'
+func (this *Parser) ArrayInitializer() *Node {
+    start := this.Match(LCURL); for this.LA(1)==EOL { this.Match(EOL) }
+    elements := []*Node{}
+    for this.LA(1) != RCURL {
+        elements = append(elements, this.VariableInitializer())
+        for this.LA(1)==EOL { this.Match(EOL) }
+        if this.LA(1) != COMMA { break }
+        this.Match(COMMA); for this.LA(1)==EOL { this.Match(EOL) }
+    }
+    this.Match(RCURL)
+    return this.node(start, NewNode1("ARRAY_INIT", elements))
+}
+
+// variableInitializer
+//     :   arrayInitializer
+//     |   expression
+func (this *Parser) VariableInitializer() *Node {
+    if this.LA(1) == LCURL {
+        return this.ArrayInitializer()
+    }
+    return this.Expression()
+}
+
+func (this *Parser) isAssignmentOperator() bool {
+    return assignmentOps[this.LA(1)]
+}
+
+var assignmentOps = map[TokenType]bool {
+    EQUAL:          true,
+    PLUS_ASSIGN:    true,
+    MINUS_ASSIGN:   true,
+    STAR_ASSIGN:    true,
+    DIV_ASSIGN:     true,
+    AND_ASSIGN:     true,
+    OR_ASSIGN:      true,
+    XOR_ASSIGN:     true,
+    PERCENT_ASSIGN: true,
+    SHL_ASSIGN:     true,
+    SHR_ASSIGN:     true,
+    USHR_ASSIGN:    true,
+    INFER_ASSIGN:   true,
 }
 
 // assignmentOperator
@@ -686,61 +2422,69 @@ func (this *Parser) CastExpression() *Node {
 //     |   '|='
 //     |   '^='
 //     |   '%='
-//     |    '<' '<' '='
-//     |    '>' '>' '>' '='
-//     |    '>' '>' '='
+//     |   '<<='
+//     |   '>>>='
+//     |   '>>='
+//     |   ':='
 //     ;
 func (this *Parser) AssignmentOperator() *Node {
-    t1 := this.LA(1)
-    t2 := this.LA(2)
-    // #TODO
-    switch {
-        case t1 == EQUAL:
-            this.Match(EQUAL)
-            return NewNode0("ASSIGN_OP")
-        case t1 == PLUS && t2 == EQUAL:
-            this.Match(PLUS); this.Match(EQUAL)
-            return NewNode0("PLUS_ASSIGN_OP")
-        case t1 == COLON && t2 == EQUAL:
-            this.Match(COLON); this.Match(EQUAL)
-            return NewNode0("INFER_ASSIGN_OP")
+    start := this.LT(1)
+    if assignmentOps[this.LA(1)] {
+        return this.node(start, NewNode2("ASSIGN_OP", this.Match(this.LA(1)).text))
     }
-    panic("assign op")
+    this.fail(ErrExpectAssignOp, "expecting an assignment operator, found '%s'", this.LT(1).text)
+    return nil
 }
 
 //
 // modifiers: modifier*
 //
-func (this *Parser) Modifiers() *Node {
+// Modifiers optionally starts with modifiers already parsed,
+// e.g. the annotations in front of the first type of a file.
+//
+func (this *Parser) Modifiers(parsed...*Node) *Node {
+    start := this.LT(1)
     m := []*Node{}
-    for modifiers[this.LA(1)] == true {
+    m = append(m, parsed...)
+    for modifiers[this.LA(1)] == true && !(this.LA(1) == AT && this.LA(2) == INTERFACE) {
         m = append(m, this.Modifier())
+        // annotations usually stand on a line of their own
+        if m[len(m)-1].Name == "ANNOTATION" {
+            for this.LA(1)==EOL { this.Match(EOL) }
+        }
     }
-    return NewNode1("MODIFIERS", m)
+    n := this.node(start, NewNode1("MODIFIERS", m))
+    if len(parsed) > 0 {
+        n.Span = Cover(parsed[0].Span, n.Span)
+    }
+    return n
 }
 
 func (this *Parser) Modifier() *Node {
+    start := this.LT(1)
     switch this.LA(1) {
         case AT:        return this.Annotation()
-        case PUBLIC:    this.Match(PUBLIC)    ; return NewNode0("PUBLIC")
-        case PROTECTED: this.Match(PROTECTED) ; return NewNode0("PROTECTED")
-        case STATIC:    this.Match(STATIC)    ; return NewNode0("STATIC")
-        case ABSTRACT:  this.Match(ABSTRACT)  ; return NewNode0("ABSTRACT")
-        case FINAL:     this.Match(FINAL)     ; return NewNode0("FINAL")
-        case NATIVE:    this.Match(NATIVE)    ; return NewNode0("NATIVE")
-        case SYNC:      this.Match(SYNC)      ; return NewNode0("SYNC")
-        case TRANSIENT: this.Match(TRANSIENT) ; return NewNode0("TRANSIENT")
-        case VOLATILE:  this.Match(VOLATILE)  ; return NewNode0("VOLATILE")
-        case STRICTFP:  this.Match(STRICTFP)  ; return NewNode0("STRICTFP")
+        case PUBLIC:    this.Match(PUBLIC)    ; return this.node(start, NewNode0("PUBLIC"))
+        case PROTECTED: this.Match(PROTECTED) ; return this.node(start, NewNode0("PROTECTED"))
+        case PRIVATE:   this.Match(PRIVATE)   ; return this.node(start, NewNode0("PRIVATE"))
+        case STATIC:    this.Match(STATIC)    ; return this.node(start, NewNode0("STATIC"))
+        case ABSTRACT:  this.Match(ABSTRACT)  ; return this.node(start, NewNode0("ABSTRACT"))
+        case FINAL:     this.Match(FINAL)     ; return this.node(start, NewNode0("FINAL"))
+        case NATIVE:    this.Match(NATIVE)    ; return this.node(start, NewNode0("NATIVE"))
+        case SYNC:      this.Match(SYNC)      ; return this.node(start, NewNode0("SYNC"))
+        case TRANSIENT: this.Match(TRANSIENT) ; return this.node(start, NewNode0("TRANSIENT"))
+        case VOLATILE:  this.Match(VOLATILE)  ; return this.node(start, NewNode0("VOLATILE"))
+        case STRICTFP:  this.Match(STRICTFP)  ; return this.node(start, NewNode0("STRICTFP"))
 
         default:
-            panic("expecting a modifier, found " + this.LA(1).String())
+            this.fail(ErrExpectModifier, "expecting a modifier, found '%s'", this.LT(1).text)
     }
     return nil
 }
 
 func (this *Parser) ArgumentDecls() *Node {
-    if this.LA(1) == RPAR { return NewNode0("ARGS") }
+    start := this.LT(1)
+    if this.LA(1) == RPAR { return this.node(start, NewNode0("ARGS")) }
 
     a := []*Node{}
     a = append(a, this.ArgumentDecl())
@@ -748,36 +2492,62 @@ func (this *Parser) ArgumentDecls() *Node {
         this.Match(COMMA)
         a = append(a, this.ArgumentDecl())
     }
-    return NewNode1("ARGS", a)
+    return this.node(start, NewNode1("ARGS", a))
 }
 
 
 var DEFAULT_TYPE = &Node{Name:"TYPE", Text:"java.lang.Object"}
 
+// what may follow the name of an argument declared without a type
+var untypedArgFollow = map[TokenType]bool {
+    COMMA: true,
+    RPAR:  true,
+    EQUAL: true,
+    ARROW: true,    // { x -> ... }
+}
+
 func (this *Parser) ArgumentDecl() *Node {
+    start := this.LT(1)
     var annotations *Node = nil
     if this.LA(1) == AT {
         annotations = this.Annotations()
     }
     argType := DEFAULT_TYPE
-    if this.LA(2) == LBRAC || this.LA(2) == IDENT {
+    varargs := false
+    if this.LA(1) != IDENT || !untypedArgFollow[this.LA(2)] {
         argType = this.Type()
+        // String... args is a String[] args
+        if this.LA(1) == ELLIPSIS {
+            this.Match(ELLIPSIS)
+            argType = arrayOf(argType, 1)
+            varargs = true
+        }
     }
     name := this.IDENT()
-    return NewNode0("ARG", argType, name, annotations)
+    children := []*Node{argType, name, annotations}
+    if this.LA(1) == EQUAL {
+        defaultStart := this.Match(EQUAL)
+        children = append(children, this.node(defaultStart, NewNode0("DEFAULT", this.Expression())))
+    }
+    if varargs {
+        children = append(children, NewNode0("VARARGS"))
+    }
+    return this.node(start, NewNode1("ARG", children))
 }
 
 func (this *Parser) QNAME() *Node {
+    start := this.LT(1)
     sb := util.NewStringBuffer()
     sb.AppendStr(this.Match(IDENT).text)
     for this.LA(1) == DOT {
         sb.AppendStr(this.Match(DOT).text)
         sb.AppendStr(this.Match(IDENT).text)
     }
-    return NewNode2("QNAME", sb.String())
+    return this.node(start, NewNode2("QNAME", sb.String()))
 }
 
 func (this *Parser) QnameForImport() *Node {
+    start := this.LT(1)
     sb := util.NewStringBuffer()
     sb.AppendStr(this.Match(IDENT).text)
     for this.LA(1) == DOT {
@@ -788,7 +2558,7 @@ func (this *Parser) QnameForImport() *Node {
             sb.AppendStr(this.Match(IDENT).text)
         }
     }
-    return NewNode2("QNAME", sb.String())
+    return this.node(start, NewNode2("QNAME", sb.String()))
 }
 
 
@@ -796,24 +2566,65 @@ func (this *Parser) QnameForImport() *Node {
 // annotations: annotation*
 //
 func (this *Parser) Annotations() *Node {
+    start := this.LT(1)
     anns := []*Node{}
     anns = append(anns, this.Annotation())
-    for this.LA(1) == AT {
+    for this.skipEolBefore(AT) {
         anns = append(anns, this.Annotation())
     }
-    return NewNode1("ANNOTATIONS", anns)
+    return this.node(start, NewNode1("ANNOTATIONS", anns))
 }
 
 //
-// annotation: '@' ident '(' args ')'
+// annotation
+//     :   '@' qualifiedName ('(' (elementValuePairs | elementValue)? ')')?
+//
+// A single value is the element called 'value': @A(1) is @A(value = 1).
 //
 func (this *Parser) Annotation() *Node {
-    this.Match(AT)
-    this.Match(IDENT)
+    start := this.Match(AT)
+    name := this.QNAME().Text
+    values := []*Node{}
     if this.LA(1) == LPAR {
-        this.Match(LPAR)
-        // annotationArgs()
+        this.Match(LPAR);  for this.LA(1)==EOL { this.Match(EOL) }
+        if this.LA(1) == IDENT && this.LA(2) == EQUAL {
+            values = append(values, this.ElementValuePair())
+            for this.LA(1) == COMMA {
+                this.Match(COMMA);  for this.LA(1)==EOL { this.Match(EOL) }
+                values = append(values, this.ElementValuePair())
+            }
+        } else if this.LA(1) != RPAR {
+            valueStart := this.LT(1)
+            values = append(values, this.node(valueStart, NewNode3("ELEMENT", "value", this.ElementValue())))
+        }
+        for this.LA(1)==EOL { this.Match(EOL) }
         this.Match(RPAR)
     }
-    return NewNode0("ANNOTATION" /* #TODO */)
+    return this.node(start, NewNode3("ANNOTATION", name, values...))
+}
+
+// elementValuePair
+//     :   IDENTIFIER '=' elementValue
+func (this *Parser) ElementValuePair() *Node {
+    start := this.LT(1)
+    name := this.Match(IDENT).text
+    this.Match(EQUAL)
+    value := this.ElementValue()
+    for this.LA(1)==EOL { this.Match(EOL) }
+    return this.node(start, NewNode3("ELEMENT", name, value))
+}
+
+// elementValueArrayInitializer
+//     :   '{' (elementValue (',' elementValue)*)? ','? '}'
+func (this *Parser) ElementValueArrayInitializer() *Node {
+    start := this.Match(LCURL); for this.LA(1)==EOL { this.Match(EOL) }
+    elements := []*Node{}
+    for this.LA(1) != RCURL {
+        elements = append(elements, this.ElementValue())
+        for this.LA(1)==EOL { this.Match(EOL) }
+        if this.LA(1) != COMMA { break }
+        this.Match(COMMA); for this.LA(1)==EOL { this.Match(EOL) }
+    }
+    this.Match(RCURL)
+    return this.node(start, NewNode1("ARRAY_INIT", elements))
 }
@@ -9,6 +9,7 @@ import "reflect"
 import "strings"
 import "sut/govy"
 import "ast"
+import . "util"
 
 func invokeByName(obj interface{}, name string, in...reflect.Value) []reflect.Value {
     ov := reflect.NewValue(obj)
@@ -85,3 +86,142 @@ func TestTypeWithReflection(t *testing.T) {
         }
     }
 }
+
+func TestNodeSpan(t *testing.T) {
+    lexer  := new(compiler.Lexer).Init(
+    "class A {\n"             +
+    "   static main(args){\n" +
+    "   }\n"                  +
+    "}\n"                     )
+    parser := new(compiler.Parser).Init(lexer)
+    node   := parser.TypeDecl()
+
+    if node.Span.Start.Line != 1 || node.Span.Start.Column != 1 ||
+       node.Span.End.Line != 4 || node.Span.End.Column != 2 {
+        t.Fatalf("CLASS span: %v-%v", node.Span.Start, node.Span.End)
+    }
+    method := node.F("MEMBERS").At(0)
+    if method.Span.Start.Line != 2 || method.Span.Start.Column != 4 ||
+       method.Span.End.Line != 3 || method.Span.End.Column != 5 {
+        t.Fatalf("METHOD span: %v-%v", method.Span.Start, method.Span.End)
+    }
+    name := method.F("IDENT")
+    if name.Span.Start.Column != 11 || name.Span.End.Column != 15 {
+        t.Fatalf("IDENT span: %v-%v", name.Span.Start, name.Span.End)
+    }
+}
+
+func TestParseErrorDiagnostic(t *testing.T) {
+    _, diags := compiler.ParseFile("A.kt", "package a.b.\n")
+    if len(diags) != 1 {
+        t.Fatalf("expect 1 diagnostic, found %d", len(diags))
+    }
+    d := diags[0]
+    if d.Code != compiler.ErrUnexpectedToken || d.Severity != compiler.SeverityError {
+        t.Fatalf("wrong diagnostic: %s", d)
+    }
+    if d.String() != "A.kt:1:13: error K0006: expecting '<IDENT>', found '<EOL>'" {
+        t.Fatalf("wrong message: %s", d)
+    }
+}
+
+func TestRecoverFromBrokenPackage(t *testing.T) {
+    unit, diags := compiler.ParseFile("A.kt", "package ;\nclass A {\n}\n")
+    if len(diags) != 1 || unit == nil || unit.F("CLASS") == nil {
+        t.Fatalf("expect the class after a broken package, found %v with %v", unit, diags)
+    }
+    // a syntax error outside any declaration still gives a unit
+    unit, diags = compiler.ParseFile("A.kt", "@A(\n")
+    if len(diags) == 0 || unit == nil || unit.String() != "UNIT(ERROR)" {
+        t.Fatalf("expect UNIT(ERROR), found %v with %v", unit, diags)
+    }
+}
+
+func TestRecoverFromBrokenMembers(t *testing.T) {
+    lexer  := new(compiler.Lexer).Init(
+    "class A {\n"   +
+    "  foo(,) {\n"  +
+    "  }\n"         +
+    "  bar() {\n"   +
+    "  }\n"         +
+    "  baz(a,) {\n" +
+    "  }\n"         +
+    "}\n"           )
+    parser := new(compiler.Parser).Init(lexer)
+    node   := parser.TypeDecl()
+
+    bar   := METHOD(MODIFIERS(), NIL, IDENT("bar"), ARGS(), "METHOD_BODY")
+    class := CLASS(MODIFIERS(), IDENT("A"), MEMBERS("ERROR", bar, "ERROR"))
+    if node.String() != class {
+        t.Fatalf("found:  %s\nexpect: %s", node, class)
+    }
+    diags := parser.Diagnostics().Items()
+    if len(diags) != 2 {
+        t.Fatalf("expect 2 diagnostics, found %d", len(diags))
+    }
+    if diags[0].Span.Start.Line != 2 || diags[1].Span.Start.Line != 6 {
+        t.Fatalf("wrong lines: %s, %s", diags[0], diags[1])
+    }
+}
+
+func TestDocComments(t *testing.T) {
+    unit, diags := compiler.ParseFile("A.kt",
+    "/**\n"                   +
+    " * Class A.\n"           +
+    " */\n"                   +
+    "class A {\n"             +
+    "   // not a doc\n"       +
+    "   /** Entry point. */\n" +
+    "   static main(args){\n" +
+    "   }\n"                  +
+    "}\n"                     )
+    if len(diags) != 0 {
+        t.Fatalf("unexpected %s", diags[0])
+    }
+    class := unit.F("CLASS")
+    if class.Doc != "/**\n * Class A.\n */" {
+        t.Fatalf("wrong class doc: %s", class.Doc)
+    }
+    if method := class.F("MEMBERS").At(0); method.Doc != "/** Entry point. */" {
+        t.Fatalf("wrong method doc: %s", method.Doc)
+    }
+}
+
+func TestSplitOperatorIsRejected(t *testing.T) {
+    for _, expr := range []string{"a | | b", "a > > b", "a + = b"} {
+        _, diags := compiler.ParseFile("A.kt", "class A {\n  f() {\n    x = " + expr + "\n  }\n}\n")
+        if len(diags) != 1 {
+            t.Fatalf("%s: expect 1 diagnostic, found %v", expr, diags)
+        }
+        if d := diags[0]; d.Code != compiler.ErrNoViableRule || d.Span.Start.Column != 13 {
+            t.Fatalf("%s: wrong diagnostic: %s", expr, d)
+        }
+    }
+}
+
+func TestMinimumNeedsUnaryMinus(t *testing.T) {
+    _, diags := compiler.ParseFile("A.kt",
+    "class A {\n"                      +
+    "  f() {\n"                        +
+    "    a := -2147483648\n"           +
+    "    b := -9223372036854775808L\n" +
+    "    c := 0x80000000\n"            +
+    "    x := 2147483648\n"            +
+    "    y := 9223372036854775808L\n"  +
+    "    z := -(2147483648)\n"         +
+    "  }\n"                            +
+    "}\n"                              )
+    expect := []string{
+        "A.kt:6:10: error K0011: integer number too large: 2147483648",
+        "A.kt:7:10: error K0011: long number too large: 9223372036854775808L",
+        "A.kt:8:12: error K0011: integer number too large: 2147483648",
+    }
+    if len(diags) != len(expect) {
+        t.Fatalf("expect %d diagnostics, found %v", len(expect), diags)
+    }
+    for i, d := range diags {
+        if d.Code != compiler.ErrNumberTooLarge || d.String() != expect[i] {
+            t.Fatalf("expect %s, found %s", expect[i], d)
+        }
+    }
+}
@@ -1,12 +1,37 @@
 package compiler
 
 import "strconv"
+import . "ast"
 
 type TokenType int
 
+type TriviaKind int
+
+const (
+    LINE_COMMENT TriviaKind = iota
+    BLOCK_COMMENT
+    DOC_COMMENT
+)
+
+//
+// Trivia is source text that does not take part in parsing.
+// It is kept on the tokens for formatters and doc generators.
+//
+type Trivia struct {
+    Kind TriviaKind
+    Text string
+    Span Span
+}
+
 type Token struct {
     tokenType TokenType
     text      string   
+    span      Span
+    value     interface{}   // decoded literal value
+
+    leading   []*Trivia
+    trailing  []*Trivia
+    doc       *Trivia
 }
 
 //
@@ -19,6 +44,26 @@ func (t *Token) GetTokenType() TokenType {
 func (t *Token) GetText() string {
     return t.text
 }
+
+func (t *Token) GetSpan() Span {
+    return t.span
+}
+
+func (t *Token) GetValue() interface{} {
+    return t.value
+}
+
+func (t *Token) GetLeading() []*Trivia {
+    return t.leading
+}
+
+func (t *Token) GetTrailing() []*Trivia {
+    return t.trailing
+}
+
+func (t *Token) GetDoc() *Trivia {
+    return t.doc
+}
 //
 // for testing purpose
 //
@@ -28,50 +73,127 @@ const (
 
     ABSTRACT
     AND
+    AND_AND
+    AND_ASSIGN
+    ARROW
+    ASSERT
     AT
+    BOOLEAN
+    BREAK
+    BYTE
     CASE
+    CATCH
+    CHAR
+    CHAR_LITERAL
     CLASS
     COLON
+    COLON_COLON
     COMMA
+    CONST
+    CONTINUE
+    DEC
+    DEF
     DEFAULT
     DIV
+    DIV_ASSIGN
+    DO
     DOT
+    DOUBLE
+    DOUBLE_LITERAL
+    ELLIPSIS
+    ELSE
+    ELVIS
+    ENUM
     EOL
+    EQ
     EQUAL
+    EXTENDS
+    FALSE
+    FAT_ARROW
     FINAL
+    FINALLY
+    FLOAT
+    FLOAT_LITERAL
+    FOR
+    GE
+    GOTO
     IDENT    
+    IF
+    IMPLEMENTS
     IMPORT
+    INC
+    INFER_ASSIGN
     INSTANCE_OF
+    INT
+    INTERFACE
+    INT_LITERAL
     LANGLE
     LCURL
+    LONG
+    LONG_LITERAL
     LPAR
     LBRAC    
+    LE
     MATCH
     MINUS
+    MINUS_ASSIGN
     NATIVE
+    NE
+    NEW
     NOT
+    NULL
     OR
+    OR_ASSIGN
+    OR_OR
     PACKAGE
     PERCENT
+    PERCENT_ASSIGN
     PLUS
+    PLUS_ASSIGN
+    PRIVATE
     PROTECTED
     PUBLIC
     QNAME
     QUESTION
+    RANGE
+    RANGE_EXCL
     RANGLE
     RCURL
     RPAR
     RBRAC
     RETURN
+    SAFE_DOT
     SEMI
+    SHL
+    SHL_ASSIGN
+    SHORT
+    SHR_ASSIGN
+    SPREAD_DOT
     STAR
+    STAR_ASSIGN
     STATIC
     STRICTFP
+    STRING_LITERAL
+    SUPER
+    SWITCH
     SYNC
+    TEMPLATE_BEGIN
+    TEMPLATE_END
+    TEMPLATE_MID
+    THIS
+    THROW
+    THROWS
     TRANSIENT
     TILD
+    TRUE
+    TRY
+    USHR_ASSIGN
+    VAL
+    VOID
     VOLATILE
+    WHILE
     XOR
+    XOR_ASSIGN
 )
 
 var tokens = map[TokenType]string{
@@ -81,53 +203,132 @@ var tokens = map[TokenType]string{
 
     ABSTRACT: "abstract",
     AND:      "&",
+    AND_AND:  "&&",
+    AND_ASSIGN: "&=",
+    ARROW:    "->",
+    ASSERT:   "assert",
     AT:       "@",
+    BOOLEAN:  "boolean",
+    BREAK:    "break",
+    BYTE:     "byte",
     CASE:     "case",
+    CATCH:    "catch",
+    CHAR:     "char",
+    CHAR_LITERAL: "<CHAR_LITERAL>",
     CLASS:    "class",
     
     COLON:    ":",
+    COLON_COLON: "::",
     COMMA:    ",",    
+    CONST:    "const",
+    CONTINUE: "continue",
+    DEC:      "--",
+    DEF:      "def",
     DEFAULT:  "default",
     DIV:      "/",
+    DIV_ASSIGN: "/=",
+    DO:       "do",
     DOT:      ".",
+    DOUBLE:   "double",
+    DOUBLE_LITERAL: "<DOUBLE_LITERAL>",
+    ELLIPSIS: "...",
+    ELSE:     "else",
+    ELVIS:    "?:",
+    ENUM:     "enum",
+    EQ:       "==",
+    EXTENDS:  "extends",
+    FALSE:    "false",
+    FAT_ARROW: "=>",
     FINAL:    "final",
+    FINALLY:  "finally",
+    FLOAT:    "float",
+    FLOAT_LITERAL: "<FLOAT_LITERAL>",
+    FOR:      "for",
+    GE:       ">=",
+    GOTO:     "goto",
     
     IDENT:    "<IDENT>",
+    IF:       "if",
+    IMPLEMENTS: "implements",
     INSTANCE_OF: "instanceof",
     IMPORT:   "import",
+    INC:      "++",
+    INFER_ASSIGN: ":=",
+    INT:      "int",
+    INTERFACE: "interface",
+    INT_LITERAL: "<INT_LITERAL>",
+    LANGLE:   "<",
     LCURL:    "{",
+    LONG:     "long",
+    LONG_LITERAL: "<LONG_LITERAL>",
     LPAR:     "(",
     LBRAC:    "[",
+    LE:       "<=",
     
     MATCH:    "match",
     MINUS:    "-",
+    MINUS_ASSIGN: "-=",
     NATIVE:   "native",
+    NE:       "!=",
+    NEW:      "new",
     NOT:      "!",
+    NULL:     "null",
 
     OR:        "|",
+    OR_ASSIGN: "|=",
+    OR_OR:    "||",
     PACKAGE:   "package",
     PERCENT:   "%",
+    PERCENT_ASSIGN: "%=",
     PLUS:      "+",
+    PLUS_ASSIGN: "+=",
+    PRIVATE:   "private",
     PROTECTED: "protected",
     PUBLIC:    "public",
     QNAME:     "<QNAME>",
     QUESTION:  "?",
+    RANGE:    "..",
+    RANGE_EXCL: "..<",
+    RANGLE:    ">",
     RETURN:    "return",
     
     RCURL:     "}",
     RPAR:   ")",
     RBRAC:  "]",
+    SAFE_DOT: "?.",
     SEMI:   ";",
+    SHL:      "<<",
+    SHL_ASSIGN: "<<=",
+    SHORT:    "short",
+    SHR_ASSIGN: ">>=",
+    SPREAD_DOT: "*.",
     STAR:   "*",
+    STAR_ASSIGN: "*=",
     STATIC: "static",
+    STRING_LITERAL: "<STRING_LITERAL>",
 
     STRICTFP:  "strictfp",
+    SUPER:     "super",
+    SWITCH:    "switch",
     SYNC:      "synchronized",
+    TEMPLATE_BEGIN: "<TEMPLATE_BEGIN>",
+    TEMPLATE_END:   "<TEMPLATE_END>",
+    TEMPLATE_MID:   "<TEMPLATE_MID>",
+    THIS:      "this",
+    THROW:     "throw",
+    THROWS:    "throws",
     TILD:      "~",
     TRANSIENT: "transient",
+    TRUE:      "true",
+    TRY:       "try",
+    USHR_ASSIGN: ">>>=",
+    VAL:       "val",
+    VOID:      "void",
     VOLATILE:  "volatile",
     
+    WHILE:     "while",
     XOR:    "^",
+    XOR_ASSIGN: "^=",
 }
 
 func (t TokenType) String() string {
@@ -1,8 +1,112 @@
 package main
 
 import . "fmt"
+import "os"
+import "io/ioutil"
+import "path"
+import "classfile"
+import "codegen"
 import K "compiler"
 
+const usage = "usage: korat build [-d dir] file.kt...\n" +
+              "       korat javap file.class...\n"
+
 func main() {
-    Printf("Hello world %d\n", K.EOF)
-}
\ No newline at end of file
+    ok := false
+    switch {
+        case len(os.Args) > 1 && os.Args[1] == "build":
+            ok = build(os.Args[2:])
+        case len(os.Args) > 2 && os.Args[1] == "javap":
+            ok = javap(os.Args[2:])
+        default:
+            Fprint(os.Stderr, usage)
+            os.Exit(2)
+    }
+    if !ok {
+        os.Exit(1)
+    }
+}
+
+//
+// build compiles each file into dir/<class>.class. Nothing is written
+// for a file with errors, but the other files are still compiled.
+//
+func build(args []string) bool {
+    dir := "."
+    files := []string{}
+    for i := 0; i < len(args); i++ {
+        switch {
+            case args[i] == "-d" && i+1 < len(args):
+                i++
+                dir = args[i]
+            case len(args[i]) > 0 && args[i][0] == '-':
+                Fprint(os.Stderr, usage)
+                return false
+            default:
+                files = append(files, args[i])
+        }
+    }
+    if len(files) == 0 {
+        Fprint(os.Stderr, usage)
+        return false
+    }
+    ok := true
+    for _, file := range files {
+        if !buildFile(file, dir) { ok = false }
+    }
+    return ok
+}
+
+func buildFile(file string, dir string) bool {
+    src, err := ioutil.ReadFile(file)
+    if err != nil {
+        Fprintf(os.Stderr, "korat: %s\n", err.String())
+        return false
+    }
+    unit, diags := K.ParseFile(file, string(src))
+    if !report(diags) { return false }
+    classes, diags := codegen.Generate(file, K.DesugarCaseClasses(unit))
+    if !report(diags) { return false }
+    for _, cf := range classes {
+        if err := write(cf, dir); err != nil {
+            Fprintf(os.Stderr, "korat: %s\n", err.String())
+            return false
+        }
+    }
+    return true
+}
+
+// report prints diagnostics, telling whether there were no errors
+func report(diags []*K.Diagnostic) bool {
+    ok := true
+    for _, d := range diags {
+        Fprintln(os.Stderr, d.String())
+        if d.Severity == K.SeverityError { ok = false }
+    }
+    return ok
+}
+
+func write(cf *classfile.ClassFile, dir string) os.Error {
+    file := path.Join(dir, cf.Name + ".class")
+    if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+        return err
+    }
+    return cf.WriteFile(file)
+}
+
+// javap disassembles each class file, going on past those it cannot read
+func javap(files []string) bool {
+    ok := true
+    for i, file := range files {
+        cf, err := classfile.ReadFile(file)
+        if err != nil {
+            Fprintf(os.Stderr, "korat: %s\n", err.String())
+            ok = false
+            continue
+        }
+        if i > 0 { Println() }
+        Printf("Classfile %s\n", file)
+        classfile.Disassemble(os.Stdout, cf)
+    }
+    return ok
+}
@@ -15,8 +15,17 @@ func NewStringBuffer() *StringBuffer {
     return r
 }
 
+// room for n more bytes plus the terminating 0
+func (S *StringBuffer) grow(n int) {
+    if S.index + n + 1 <= len(S.bytes) { return }
+    b := make([]byte, 2*len(S.bytes) + n)
+    copy(b, S.bytes[0:S.index])
+    S.bytes = b
+}
+
 func (S *StringBuffer) Append(ch int) *StringBuffer {
     // fmt.Printf("append: %c", ch)
+    S.grow(utf8.UTFMax)
     w := utf8.EncodeRune(S.bytes[S.index:], ch)
     S.index +=w
     return S
@@ -25,6 +34,7 @@ func (S *StringBuffer) Append(ch int) *StringBuffer {
 func (S *StringBuffer) AppendStr(s string) *StringBuffer {
     // fmt.Printf("append: %c", ch)
     for _,ch := range s {
+        S.grow(utf8.UTFMax)
         w := utf8.EncodeRune(S.bytes[S.index:], ch)
         S.index +=w
     }
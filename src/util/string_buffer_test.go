@@ -17,4 +17,16 @@ func TestStringBuffer(t *testing.T) {
     if b.String() != "abcกขคxyz" {
         t.Fatalf("string buffer error")
     }
-}
\ No newline at end of file
+}
+
+func TestStringBufferGrow(t *testing.T) {
+    b := util.NewStringBuffer()
+    s := ""
+    for i := 0; i < 1000; i++ {
+        b.AppendStr("กขค")
+        s = s + "กขค"
+    }
+    if b.String() != s {
+        t.Fatalf("string buffer error")
+    }
+}
@@ -0,0 +1,22 @@
+CompilationUnit:
+    package a.b
+
+    import java.util.*
+    import static java.lang.Math.max
+
+    class A {
+    }
+
+    case class B {
+    }
+
+expect:
+    UNIT(
+        PACKAGE(QNAME('a.b')),
+        IMPORTS(
+            IMPORT(QNAME('java.util.*')),
+            IMPORT_STATIC(QNAME('java.lang.Math.max'))
+        ),
+        CLASS(MODIFIERS,IDENT('A'),MEMBERS),
+        CASE_CLASS(MODIFIERS,IDENT('B'),MEMBERS)
+    )
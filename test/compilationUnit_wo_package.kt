@@ -0,0 +1,12 @@
+CompilationUnit:
+    class A {
+    }
+    class B {
+    }
+
+expect:
+    UNIT(
+        IMPORTS,
+        CLASS(MODIFIERS,IDENT('A'),MEMBERS),
+        CLASS(MODIFIERS,IDENT('B'),MEMBERS)
+    )
@@ -0,0 +1,8 @@
+Expression:
+    (long) -x + (Map<K, V>) m
+
+expect:
+    BIN_OP('+',
+      CAST(TYPE('long'),U_MINUS(IDENT('x'))),
+      CAST(TYPE('Map',TYPE_ARGS(TYPE('K'),TYPE('V'))),IDENT('m'))
+    )
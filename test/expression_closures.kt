@@ -0,0 +1,77 @@
+MethodBodyDecl:
+    {
+        f := x -> x * 2
+        add := (int a, int b) -> a + b
+        g := () -> { return 1 }
+        list.each { println(it) }
+        list.each { println it }
+        list.each { String s -> print s, "$s " }
+        list.inject(0) { acc, x -> acc + x }
+        run { -> done() }
+        run { String s = it; println s }
+        ref := Foo::bar
+        make := String::new
+    }
+
+expect:
+    METHOD_BODY(
+      INFER_ASSIGN(
+        LOCAL_VAR('f'),
+        LAMBDA(ARGS(ARG(TYPE('java.lang.Object'),IDENT('x'),<nil>)),BIN_OP('*',IDENT('x'),INT_LITERAL('2')))
+      ),
+      INFER_ASSIGN(
+        LOCAL_VAR('add'),
+        LAMBDA(
+          ARGS(ARG(TYPE('int'),IDENT('a'),<nil>),ARG(TYPE('int'),IDENT('b'),<nil>)),
+          BIN_OP('+',IDENT('a'),IDENT('b'))
+        )
+      ),
+      INFER_ASSIGN(LOCAL_VAR('g'),LAMBDA(ARGS,BLOCK(RETURN(INT_LITERAL('1'))))),
+      STMT(
+        CALL('each',IDENT('list'),ARGUMENTS(
+          CLOSURE(
+            ARGS(ARG(TYPE('java.lang.Object'),IDENT('it'),<nil>)),
+            BLOCK(STMT(CALL('println',<nil>,ARGUMENTS(IDENT('it')))))
+          )
+        ))
+      ),
+      STMT(
+        CALL('each',IDENT('list'),ARGUMENTS(
+          CLOSURE(
+            ARGS(ARG(TYPE('java.lang.Object'),IDENT('it'),<nil>)),
+            BLOCK(STMT(CALL('println',<nil>,ARGUMENTS(IDENT('it')))))
+          )
+        ))
+      ),
+      STMT(
+        CALL('each',IDENT('list'),ARGUMENTS(
+          CLOSURE(
+            ARGS(ARG(TYPE('String'),IDENT('s'),<nil>)),
+            BLOCK(STMT(CALL('print',<nil>,ARGUMENTS(IDENT('s'),INTERPOLATED_STRING(IDENT('s'),STRING_LITERAL('" "'))))))
+          )
+        ))
+      ),
+      STMT(
+        CALL('inject',IDENT('list'),ARGUMENTS(
+          INT_LITERAL('0'),
+          CLOSURE(
+            ARGS(ARG(TYPE('java.lang.Object'),IDENT('acc'),<nil>),ARG(TYPE('java.lang.Object'),IDENT('x'),<nil>)),
+            BLOCK(STMT(BIN_OP('+',IDENT('acc'),IDENT('x'))))
+          )
+        ))
+      ),
+      STMT(CALL('run',<nil>,ARGUMENTS(CLOSURE(ARGS,BLOCK(STMT(CALL('done',<nil>,ARGUMENTS))))))),
+      STMT(
+        CALL('run',<nil>,ARGUMENTS(
+          CLOSURE(
+            ARGS(ARG(TYPE('java.lang.Object'),IDENT('it'),<nil>)),
+            BLOCK(
+              LOCAL_VAR_DECL(MODIFIERS,TYPE('String'),VAR('s',IDENT('it'))),
+              STMT(CALL('println',<nil>,ARGUMENTS(IDENT('s'))))
+            )
+          )
+        ))
+      ),
+      INFER_ASSIGN(LOCAL_VAR('ref'),METHOD_REF('bar',IDENT('Foo'))),
+      INFER_ASSIGN(LOCAL_VAR('make'),METHOD_REF('new',IDENT('String')))
+    )
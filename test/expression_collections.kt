@@ -0,0 +1,38 @@
+MethodBodyDecl:
+    {
+        xs := [1, 2, 3]
+        empty := []
+        m := [a: 1, "b c": 2,
+              (k): x ? y : z,]
+        none := [:]
+        for (i : 1..n + 1) print(i)
+        slice := xs[0..<len]
+        nested := [[1], [x: [2]]]
+    }
+
+expect:
+    METHOD_BODY(
+      INFER_ASSIGN(LOCAL_VAR('xs'),LIST_LITERAL(INT_LITERAL('1'),INT_LITERAL('2'),INT_LITERAL('3'))),
+      INFER_ASSIGN(LOCAL_VAR('empty'),LIST_LITERAL),
+      INFER_ASSIGN(
+        LOCAL_VAR('m'),
+        MAP_LITERAL(
+          ENTRY(STRING_LITERAL('"a"'),INT_LITERAL('1')),
+          ENTRY(STRING_LITERAL('"b c"'),INT_LITERAL('2')),
+          ENTRY(IDENT('k'),TERNARY(IDENT('x'),IDENT('y'),IDENT('z')))
+        )
+      ),
+      INFER_ASSIGN(LOCAL_VAR('none'),MAP_LITERAL),
+      FOR_EACH(
+        MODIFIERS,
+        TYPE('java.lang.Object'),
+        IDENT('i'),
+        RANGE('..',INT_LITERAL('1'),BIN_OP('+',IDENT('n'),INT_LITERAL('1'))),
+        STMT(CALL('print',<nil>,ARGUMENTS(IDENT('i'))))
+      ),
+      INFER_ASSIGN(LOCAL_VAR('slice'),INDEX(IDENT('xs'),RANGE('..<',INT_LITERAL('0'),IDENT('len')))),
+      INFER_ASSIGN(
+        LOCAL_VAR('nested'),
+        LIST_LITERAL(LIST_LITERAL(INT_LITERAL('1')),MAP_LITERAL(ENTRY(STRING_LITERAL('"x"'),LIST_LITERAL(INT_LITERAL('2')))))
+      )
+    )
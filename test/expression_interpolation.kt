@@ -0,0 +1,29 @@
+MethodBodyDecl:
+    {
+        greet := "Hello ${user.name}, you have $count items"
+        s := "${a + b}${"[${m["k"]}]"} costs \$5"
+        t := "$a$b"
+    }
+
+expect:
+    METHOD_BODY(
+      INFER_ASSIGN(
+        LOCAL_VAR('greet'),
+        INTERPOLATED_STRING(
+          STRING_LITERAL('"Hello "'),
+          FIELD_ACCESS('name',IDENT('user')),
+          STRING_LITERAL('", you have "'),
+          IDENT('count'),
+          STRING_LITERAL('" items"')
+        )
+      ),
+      INFER_ASSIGN(
+        LOCAL_VAR('s'),
+        INTERPOLATED_STRING(
+          BIN_OP('+',IDENT('a'),IDENT('b')),
+          INTERPOLATED_STRING(STRING_LITERAL('"["'),INDEX(IDENT('m'),STRING_LITERAL('"k"')),STRING_LITERAL('"]"')),
+          STRING_LITERAL('" costs $5"')
+        )
+      ),
+      INFER_ASSIGN(LOCAL_VAR('t'),INTERPOLATED_STRING(IDENT('a'),IDENT('b')))
+    )
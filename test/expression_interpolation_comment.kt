@@ -0,0 +1,17 @@
+MethodBodyDecl:
+    {
+        s := "$a // b $c /* d */" // a comment
+        t := "$n    items"
+    }
+
+expect:
+    METHOD_BODY(
+      INFER_ASSIGN(
+        LOCAL_VAR('s'),
+        INTERPOLATED_STRING(IDENT('a'),STRING_LITERAL('" // b "'),IDENT('c'),STRING_LITERAL('" /* d */"'))
+      ),
+      INFER_ASSIGN(
+        LOCAL_VAR('t'),
+        INTERPOLATED_STRING(IDENT('n'),STRING_LITERAL('"    items"'))
+      )
+    )
@@ -0,0 +1,16 @@
+Expression:
+    f("n=", 10L * 0x1F, 'c', 1.5f, .5e1, true, null)
+
+expect:
+    CALL('f',
+      <nil>,
+      ARGUMENTS(
+        STRING_LITERAL('"n="'),
+        BIN_OP('*',LONG_LITERAL('10L'),INT_LITERAL('0x1F')),
+        CHAR_LITERAL(''c''),
+        FLOAT_LITERAL('1.5f'),
+        DOUBLE_LITERAL('.5e1'),
+        BOOLEAN_LITERAL('true'),
+        NULL_LITERAL('null')
+      )
+    )
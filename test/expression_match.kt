@@ -0,0 +1,38 @@
+Expression:
+    shape match {
+        case Circle(_, r) if r > 0 => area(r)
+        case geom.Rect(Point(x, _), w: Int) =>
+            log(x)
+            w
+        case _: String => 0
+        case 1 | -1 | 'c' => one
+        case other => other
+    }
+
+expect:
+    MATCH(
+      IDENT('shape'),
+      CASE_CLAUSE(
+        PATTERN('constructor',TYPE('Circle'),PATTERN('wildcard'),PATTERN('bind',IDENT('r'))),
+        GUARD(BIN_OP('>',IDENT('r'),INT_LITERAL('0'))),
+        BLOCK(STMT(CALL('area',<nil>,ARGUMENTS(IDENT('r')))))
+      ),
+      CASE_CLAUSE(
+        PATTERN('constructor',
+          TYPE('geom.Rect'),
+          PATTERN('constructor',TYPE('Point'),PATTERN('bind',IDENT('x')),PATTERN('wildcard')),
+          PATTERN('type',TYPE('Int'),IDENT('w'))
+        ),
+        BLOCK(STMT(CALL('log',<nil>,ARGUMENTS(IDENT('x')))),STMT(IDENT('w')))
+      ),
+      CASE_CLAUSE(PATTERN('type',TYPE('String')),BLOCK(STMT(INT_LITERAL('0')))),
+      CASE_CLAUSE(
+        PATTERN('alternative',
+          PATTERN('literal',INT_LITERAL('1')),
+          PATTERN('literal',U_MINUS(INT_LITERAL('1'))),
+          PATTERN('literal',CHAR_LITERAL(''c''))
+        ),
+        BLOCK(STMT(IDENT('one')))
+      ),
+      CASE_CLAUSE(PATTERN('bind',IDENT('other')),BLOCK(STMT(IDENT('other'))))
+    )
@@ -0,0 +1,26 @@
+MethodBodyDecl:
+    {
+        c := a?.b?.c()
+        name := user?.name ?: "anonymous"
+        x := p ?: q ?: r
+        names := people*.name
+        sizes := lists*.size().sum()
+    }
+
+expect:
+    METHOD_BODY(
+      INFER_ASSIGN(
+        LOCAL_VAR('c'),
+        SAFE_NAV(CALL('c',SAFE_NAV(FIELD_ACCESS('b',IDENT('a'))),ARGUMENTS))
+      ),
+      INFER_ASSIGN(
+        LOCAL_VAR('name'),
+        ELVIS(SAFE_NAV(FIELD_ACCESS('name',IDENT('user'))),STRING_LITERAL('"anonymous"'))
+      ),
+      INFER_ASSIGN(LOCAL_VAR('x'),ELVIS(IDENT('p'),ELVIS(IDENT('q'),IDENT('r')))),
+      INFER_ASSIGN(LOCAL_VAR('names'),SPREAD(FIELD_ACCESS('name',IDENT('people')))),
+      INFER_ASSIGN(
+        LOCAL_VAR('sizes'),
+        CALL('sum',SPREAD(CALL('size',IDENT('lists'),ARGUMENTS)),ARGUMENTS)
+      )
+    )
@@ -0,0 +1,13 @@
+Expression:
+    x += a >> b >>> c << d >= e
+
+expect:
+    ASSIGN_EXPR('+=',IDENT('x'),
+      BIN_OP('>=',
+        BIN_OP('<<',
+          BIN_OP('>>>',
+            BIN_OP('>>',IDENT('a'),IDENT('b')),
+            IDENT('c')),
+          IDENT('d')),
+        IDENT('e'))
+    )
@@ -0,0 +1,15 @@
+Expression:
+    a || b && c | d ^ e & f == g
+
+expect:
+    BIN_OP('||',IDENT('a'),
+      BIN_OP('&&',IDENT('b'),
+        BIN_OP('|',IDENT('c'),
+          BIN_OP('^',IDENT('d'),
+            BIN_OP('&',IDENT('e'),
+              BIN_OP('==',IDENT('f'),IDENT('g'))
+            )
+          )
+        )
+      )
+    )
@@ -0,0 +1,21 @@
+Expression:
+    x = c ? (Foo) this.a.b(y, z)[i] : new Bar(q)
+
+expect:
+    ASSIGN_EXPR('=',
+      IDENT('x'),
+      TERNARY(
+        IDENT('c'),
+        CAST(
+          TYPE('Foo'),
+          INDEX(
+            CALL('b',
+              FIELD_ACCESS('a',THIS),
+              ARGUMENTS(IDENT('y'),IDENT('z'))
+            ),
+            IDENT('i')
+          )
+        ),
+        NEW(TYPE('Bar'),ARGUMENTS(IDENT('q')))
+      )
+    )
@@ -0,0 +1,16 @@
+MethodDecl:
+    static void printf(Comparator<? super T> c, String format, Object... args) {
+    }
+
+expect:
+    METHOD(
+      MODIFIERS(STATIC),
+      TYPE('void'),
+      IDENT('printf'),
+      ARGS(
+        ARG(TYPE('Comparator',TYPE_ARGS(WILDCARD('super',TYPE('T')))),IDENT('c'),<nil>),
+        ARG(TYPE('String'),IDENT('format'),<nil>),
+        ARG(TYPE('Object',DIM('1')),IDENT('args'),<nil>,VARARGS)
+      ),
+      METHOD_BODY
+    )
@@ -0,0 +1,14 @@
+MethodDecl:
+   public static void main(String[] args){
+   }
+
+expect:
+    METHOD(
+        MODIFIERS(PUBLIC,STATIC),
+        TYPE('void'),
+        IDENT('main'),
+        ARGS(
+            ARG(TYPE('String',DIM('1')),IDENT('args'),<nil>)
+        ),
+        METHOD_BODY
+    )
@@ -0,0 +1,29 @@
+MethodBodyDecl:
+    {
+        for (int i = 0, j; i < n; i++, j--) sum += i
+        for (x : xs) {
+        }
+        for (final String s : names) print(s)
+        for (;;) break
+    }
+
+expect:
+    METHOD_BODY(
+      FOR(
+        FOR_INIT(
+          LOCAL_VAR_DECL(MODIFIERS,TYPE('int'),VAR('i',INT_LITERAL('0')),VAR('j'))
+        ),
+        BIN_OP('<',IDENT('i'),IDENT('n')),
+        FOR_UPDATE(POST_INC(IDENT('i')),POST_DEC(IDENT('j'))),
+        STMT(ASSIGN_EXPR('+=',IDENT('sum'),IDENT('i')))
+      ),
+      FOR_EACH(MODIFIERS,TYPE('java.lang.Object'),IDENT('x'),IDENT('xs'),BLOCK),
+      FOR_EACH(
+        MODIFIERS(FINAL),
+        TYPE('String'),
+        IDENT('s'),
+        IDENT('names'),
+        STMT(CALL('print',<nil>,ARGUMENTS(IDENT('s'))))
+      ),
+      FOR(FOR_INIT,<nil>,FOR_UPDATE,BREAK)
+    )
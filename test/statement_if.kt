@@ -0,0 +1,18 @@
+Statement:
+    if (a < b) {
+        return a
+    }
+    else if (a == b)
+        return
+    else throw e
+
+expect:
+    IF(
+      BIN_OP('<',IDENT('a'),IDENT('b')),
+      BLOCK(RETURN(IDENT('a'))),
+      IF(
+        BIN_OP('==',IDENT('a'),IDENT('b')),
+        RETURN,
+        THROW(IDENT('e'))
+      )
+    )
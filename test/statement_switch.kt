@@ -0,0 +1,23 @@
+Statement:
+    switch (c) {
+        case 'a':
+        case 'b':
+            n++
+            break
+        default:
+            do n-- while (n > 0)
+    }
+
+expect:
+    SWITCH(
+      IDENT('c'),
+      CASE_GROUP(
+        CASE(CHAR_LITERAL(''a'')),
+        CASE(CHAR_LITERAL(''b'')),
+        BLOCK(STMT(POST_INC(IDENT('n'))),BREAK)
+      ),
+      CASE_GROUP(
+        DEFAULT,
+        BLOCK(DO(STMT(POST_DEC(IDENT('n'))),BIN_OP('>',IDENT('n'),INT_LITERAL('0'))))
+      )
+    )
@@ -0,0 +1,22 @@
+Statement:
+    try {
+        a, b := f()
+        x, y = g()
+    } catch (IOException e) {
+        throw e
+    }
+    catch (final Exception e) {
+    } finally {
+        close()
+    }
+
+expect:
+    TRY(
+      BLOCK(
+        MULTI_ASSIGN(':=',VARS(LOCAL_VAR('a'),LOCAL_VAR('b')),CALL('f',<nil>,ARGUMENTS)),
+        MULTI_ASSIGN('=',VARS(IDENT('x'),IDENT('y')),CALL('g',<nil>,ARGUMENTS))
+      ),
+      CATCH(MODIFIERS,TYPE('IOException'),IDENT('e'),BLOCK(THROW(IDENT('e')))),
+      CATCH(MODIFIERS(FINAL),TYPE('Exception'),IDENT('e'),BLOCK),
+      FINALLY(BLOCK(STMT(CALL('close',<nil>,ARGUMENTS))))
+    )
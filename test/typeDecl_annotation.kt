@@ -0,0 +1,15 @@
+TypeDecl:
+    public @interface Retry {
+        int times() default 3
+        String[] on()
+    }
+
+expect:
+    ANNOTATION_TYPE(
+      MODIFIERS(PUBLIC),
+      IDENT('Retry'),
+      MEMBERS(
+        ANNOTATION_METHOD(MODIFIERS,TYPE('int'),IDENT('times'),DEFAULT(INT_LITERAL('3'))),
+        ANNOTATION_METHOD(MODIFIERS,TYPE('String',DIM('1')),IDENT('on'))
+      )
+    )
@@ -0,0 +1,45 @@
+TypeDecl:
+    @Entity(name = "users", tags = {"a", "b"})
+    @javax.annotation.Generated("korat")
+    class User {
+        @Id @Column(nullable = false, check = @Check(1))
+        long id
+        @Override
+        String toString(@NonNull Object o) {
+            @Suppress int n = 0
+        }
+    }
+
+expect:
+    CLASS(
+      MODIFIERS(
+        ANNOTATION('Entity',
+          ELEMENT('name',STRING_LITERAL('"users"')),
+          ELEMENT('tags',ARRAY_INIT(STRING_LITERAL('"a"'),STRING_LITERAL('"b"')))
+        ),
+        ANNOTATION('javax.annotation.Generated',ELEMENT('value',STRING_LITERAL('"korat"')))
+      ),
+      IDENT('User'),
+      MEMBERS(
+        FIELD(
+          MODIFIERS(
+            ANNOTATION('Id'),
+            ANNOTATION('Column',
+              ELEMENT('nullable',BOOLEAN_LITERAL('false')),
+              ELEMENT('check',ANNOTATION('Check',ELEMENT('value',INT_LITERAL('1'))))
+            )
+          ),
+          TYPE('long'),
+          VAR('id')
+        ),
+        METHOD(
+          MODIFIERS(ANNOTATION('Override')),
+          TYPE('String'),
+          IDENT('toString'),
+          ARGS(ARG(TYPE('Object'),IDENT('o'),ANNOTATIONS(ANNOTATION('NonNull')))),
+          METHOD_BODY(
+            LOCAL_VAR_DECL(MODIFIERS(ANNOTATION('Suppress')),TYPE('int'),VAR('n',INT_LITERAL('0')))
+          )
+        )
+      )
+    )
@@ -4,6 +4,7 @@ TypeDecl:
 
 expect:
     CLASS(
+      MODIFIERS,
       IDENT('A'),
       MEMBERS
     )
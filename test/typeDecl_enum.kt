@@ -0,0 +1,27 @@
+TypeDecl:
+    enum Color implements Named {
+        RED("r"),
+        GREEN("g") {
+            label() { }
+        },
+        BLUE
+        ;
+        name() {
+        }
+    }
+
+expect:
+    ENUM(
+      MODIFIERS,
+      IDENT('Color'),
+      IMPLEMENTS(TYPE('Named')),
+      ENUM_CONSTANTS(
+        ENUM_CONSTANT('RED',ARGUMENTS(STRING_LITERAL('"r"'))),
+        ENUM_CONSTANT('GREEN',
+          ARGUMENTS(STRING_LITERAL('"g"')),
+          MEMBERS(METHOD(MODIFIERS,<nil>,IDENT('label'),ARGS,METHOD_BODY))
+        ),
+        ENUM_CONSTANT('BLUE')
+      ),
+      MEMBERS(METHOD(MODIFIERS,<nil>,IDENT('name'),ARGS,METHOD_BODY))
+    )
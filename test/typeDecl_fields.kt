@@ -0,0 +1,37 @@
+TypeDecl:
+    class Counter {
+        static int total = 0, max
+        name = "c"
+        String[] tags
+        static {
+            total = 1
+        }
+        {
+            max = 2
+        }
+        Counter(String name) {
+            this.name = name
+        }
+        String[] tags() {
+        }
+    }
+
+expect:
+    CLASS(
+      MODIFIERS,
+      IDENT('Counter'),
+      MEMBERS(
+        FIELD(MODIFIERS(STATIC),TYPE('int'),VAR('total',INT_LITERAL('0')),VAR('max')),
+        FIELD(MODIFIERS,TYPE('java.lang.Object'),VAR('name',STRING_LITERAL('"c"'))),
+        FIELD(MODIFIERS,TYPE('String',DIM('1')),VAR('tags')),
+        INIT_BLOCK(MODIFIERS(STATIC),BLOCK(ASSIGN(IDENT('total'),INT_LITERAL('1')))),
+        INIT_BLOCK(MODIFIERS,BLOCK(ASSIGN(IDENT('max'),INT_LITERAL('2')))),
+        CONSTRUCTOR(
+          MODIFIERS,
+          IDENT('Counter'),
+          ARGS(ARG(TYPE('String'),IDENT('name'),<nil>)),
+          METHOD_BODY(STMT(ASSIGN_EXPR('=',FIELD_ACCESS('name',THIS),IDENT('name'))))
+        ),
+        METHOD(MODIFIERS,TYPE('String',DIM('1')),IDENT('tags'),ARGS,METHOD_BODY)
+      )
+    )
@@ -0,0 +1,32 @@
+TypeDecl:
+    public abstract class Box<T extends Comparable & java.io.Serializable, U> extends Base implements A, b.C {
+        static class Inner {
+        }
+        interface Visitor<R> extends A, B {
+            R visit(Box b)
+        }
+    }
+
+expect:
+    CLASS(
+      MODIFIERS(PUBLIC,ABSTRACT),
+      IDENT('Box'),
+      TYPE_PARAMS(
+        TYPE_PARAM('T',TYPE('Comparable'),TYPE('java.io.Serializable')),
+        TYPE_PARAM('U')
+      ),
+      EXTENDS(TYPE('Base')),
+      IMPLEMENTS(TYPE('A'),TYPE('b.C')),
+      MEMBERS(
+        CLASS(MODIFIERS(STATIC),IDENT('Inner'),MEMBERS),
+        INTERFACE(
+          MODIFIERS,
+          IDENT('Visitor'),
+          TYPE_PARAMS(TYPE_PARAM('R')),
+          EXTENDS(TYPE('A'),TYPE('B')),
+          MEMBERS(
+            INTERFACE_METHOD(MODIFIERS,TYPE('R'),IDENT('visit'),ARGS(ARG(TYPE('Box'),IDENT('b'),<nil>)))
+          )
+        )
+      )
+    )
@@ -7,6 +7,7 @@ TypeDecl:
     
 expect:
     CLASS(
+        MODIFIERS,
         IDENT('A'),
         MEMBERS(
             METHOD(
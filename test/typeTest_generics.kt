@@ -0,0 +1,11 @@
+Type:
+    java.util.Map<String, List<? extends Foo>>[]
+
+expect:
+    TYPE('java.util.Map',
+      TYPE_ARGS(
+        TYPE('String'),
+        TYPE('List',TYPE_ARGS(WILDCARD('extends',TYPE('Foo'))))
+      ),
+      DIM('1')
+    )
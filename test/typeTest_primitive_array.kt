@@ -0,0 +1,5 @@
+Type:
+    int[][][]
+
+expect:
+    TYPE('int',DIM('3'))